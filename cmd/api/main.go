@@ -8,8 +8,10 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/cloud-lada/backend/internal/location"
+	"github.com/cloud-lada/backend/internal/sensor"
 	"github.com/cloud-lada/backend/internal/statistics"
 	"github.com/cloud-lada/backend/internal/status"
 	"github.com/cloud-lada/backend/pkg/closers"
@@ -23,8 +25,10 @@ var version = "dev"
 
 func main() {
 	var (
-		databaseURL string
-		port        int
+		databaseURL           string
+		port                  int
+		sensorRefreshInterval time.Duration
+		locationTolerance     time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -41,11 +45,18 @@ func main() {
 			defer closers.Close(db)
 
 			logger := log.Default()
+			sensors := sensor.NewPostgresRepository(db)
+			registry, err := sensor.NewRegistry(ctx, sensors, logger)
+			if err != nil {
+				return fmt.Errorf("failed to load sensors: %w", err)
+			}
+
 			router := mux.NewRouter()
 			api := router.PathPrefix("/api").Subrouter()
 
-			statistics.NewHTTP(statistics.NewPostgresRepository(db)).Register(api)
-			location.NewHTTP(location.NewPostgresRepository(db)).Register(api)
+			sensor.NewHTTP(sensors).Register(api)
+			statistics.NewHTTP(statistics.NewPostgresRepository(db), registry).Register(api)
+			location.NewHTTP(location.NewPostgresRepository(db, locationTolerance), logger).Register(api)
 			status.NewHTTP(status.NewPostgresRepository(db)).Register(api)
 
 			svr := &http.Server{
@@ -54,6 +65,9 @@ func main() {
 			}
 
 			grp, ctx := errgroup.WithContext(ctx)
+			grp.Go(func() error {
+				return registry.Run(ctx, sensorRefreshInterval)
+			})
 			grp.Go(func() error {
 				return svr.ListenAndServe()
 			})
@@ -70,6 +84,8 @@ func main() {
 	flags := cmd.PersistentFlags()
 	flags.IntVar(&port, "port", 5000, "The port to listen for HTTP requests from")
 	flags.StringVar(&databaseURL, "database-url", "", "The URL of the database to read data from")
+	flags.DurationVar(&sensorRefreshInterval, "sensor-refresh-interval", time.Minute, "How often to reload the sensor registry from the database")
+	flags.DurationVar(&locationTolerance, "location-tolerance", time.Second, "The maximum time between a latitude and longitude reading for them to be paired into a location")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	if err := cmd.ExecuteContext(ctx); err != nil {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cloud-lada/backend/internal/dump"
+	"github.com/cloud-lada/backend/internal/location"
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/cloud-lada/backend/pkg/blob"
 	"github.com/cloud-lada/backend/pkg/closers"
@@ -26,6 +27,9 @@ func main() {
 		blobStoreURL string
 		databaseURL  string
 		dumpDate     string
+		vehicle      string
+		timezone     string
+		tolerance    time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -34,7 +38,17 @@ func main() {
 		Version: version,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
-			date, err := time.Parse(dateFormat, dumpDate)
+			zone, err := time.LoadLocation(timezone)
+			if err != nil {
+				return fmt.Errorf("invalid timezone: %w", err)
+			}
+
+			// Default to yesterday, as it is in the chosen time zone.
+			if dumpDate == "" {
+				dumpDate = time.Now().In(zone).AddDate(0, 0, -1).Format(dateFormat)
+			}
+
+			date, err := time.ParseInLocation(dateFormat, dumpDate, zone)
 			if err != nil {
 				return fmt.Errorf("invalid dump date: %w", err)
 			}
@@ -54,11 +68,13 @@ func main() {
 			logger := log.Default()
 			dumper := dump.New(dump.Config{
 				Date:     date,
+				Vehicle:  vehicle,
 				Readings: reading.NewPostgresRepository(db),
 				Blobs:    blobs,
+				Track:    location.NewPostgresRepository(db, tolerance),
 			})
 
-			logger.Println("Creating dump for", dumpDate)
+			logger.Println("Creating dump of", vehicle, "for", dumpDate, "in", zone)
 			return dumper.Dump(ctx)
 		},
 	}
@@ -66,7 +82,10 @@ func main() {
 	flags := cmd.PersistentFlags()
 	flags.StringVar(&blobStoreURL, "blob-store-url", "", "The URL of the blob store to persist dumps to")
 	flags.StringVar(&databaseURL, "database-url", "", "The URL of the database to read data from")
-	flags.StringVar(&dumpDate, "dump-date", time.Now().Add(-time.Hour*24).Format(dateFormat), "The date to dump data for, expects YYYY-MM-DD format")
+	flags.StringVar(&vehicle, "vehicle", reading.DefaultVehicle, "The vehicle to dump data for")
+	flags.StringVar(&dumpDate, "dump-date", "", "The date to dump data for, expects YYYY-MM-DD format. Defaults to yesterday")
+	flags.StringVar(&timezone, "timezone", "UTC", "The IANA time zone used to determine the start & end of the dump date")
+	flags.DurationVar(&tolerance, "location-tolerance", time.Second, "The maximum time between a latitude and longitude reading for them to be paired into a location")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	if err := cmd.ExecuteContext(ctx); err != nil {
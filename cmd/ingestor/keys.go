@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/apikey"
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+// keysCommand returns the command used to manage the API keys stored in the database at the given URL.
+func keysCommand(databaseURL *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the API keys devices use to upload readings",
+	}
+
+	cmd.AddCommand(
+		issueKeyCommand(databaseURL),
+		revokeKeyCommand(databaseURL),
+		listKeysCommand(databaseURL),
+	)
+
+	return cmd
+}
+
+func issueKeyCommand(databaseURL *string) *cobra.Command {
+	var (
+		label    string
+		vehicle  string
+		deviceID string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "issue",
+		Short: "Issues a new API key, the key is only displayed once",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if label == "" {
+				return errors.New("a label is required")
+			}
+
+			db, err := openKeys(cmd, *databaseURL)
+			if err != nil {
+				return err
+			}
+			defer closers.Close(db)
+
+			repo := apikey.NewPostgresRepository(db)
+
+			key, secret, err := apikey.New(label, vehicle, deviceID)
+			if err != nil {
+				return fmt.Errorf("failed to generate key: %w", err)
+			}
+
+			if err = repo.Create(ctx, key); err != nil {
+				return fmt.Errorf("failed to store key: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "ID: ", key.ID)
+			fmt.Fprintln(cmd.OutOrStdout(), "Key:", secret)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&label, "label", "", "A description of the key, such as the device it is issued to")
+	flags.StringVar(&vehicle, "vehicle", reading.DefaultVehicle, "The vehicle that readings uploaded with the key belong to")
+	flags.StringVar(&deviceID, "device-id", "", "The identifier of the device the key is issued to")
+
+	return cmd
+}
+
+func revokeKeyCommand(databaseURL *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke [id]",
+		Short: "Revokes an API key, preventing it from being used",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openKeys(cmd, *databaseURL)
+			if err != nil {
+				return err
+			}
+			defer closers.Close(db)
+
+			repo := apikey.NewPostgresRepository(db)
+
+			key, err := repo.Revoke(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to revoke key: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "Revoked key", key.ID, "at", key.RevokedAt.Format(time.RFC3339))
+			return nil
+		},
+	}
+}
+
+func listKeysCommand(databaseURL *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Lists all API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openKeys(cmd, *databaseURL)
+			if err != nil {
+				return err
+			}
+			defer closers.Close(db)
+
+			repo := apikey.NewPostgresRepository(db)
+
+			keys, err := repo.List(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to list keys: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tLABEL\tVEHICLE\tDEVICE\tCREATED\tREVOKED")
+			for _, key := range keys {
+				revoked := "-"
+				if key.Revoked() {
+					revoked = key.RevokedAt.Format(time.RFC3339)
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					key.ID,
+					key.Label,
+					key.Vehicle,
+					key.DeviceID,
+					key.CreatedAt.Format(time.RFC3339),
+					revoked,
+				)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// openKeys connects to the database that API keys are stored in.
+func openKeys(cmd *cobra.Command, databaseURL string) (*sql.DB, error) {
+	if databaseURL == "" {
+		return nil, errors.New("a database url is required to manage keys")
+	}
+
+	db, err := postgres.Open(cmd.Context(), databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
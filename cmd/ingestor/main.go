@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/cloud-lada/backend/internal/apikey"
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/internal/sensor"
+	"github.com/cloud-lada/backend/pkg/blob"
 	"github.com/cloud-lada/backend/pkg/closers"
 	"github.com/cloud-lada/backend/pkg/event"
 	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/cloud-lada/backend/pkg/postgres"
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -24,7 +32,19 @@ func main() {
 	var (
 		eventWriterURL string
 		apiKey         string
+		apiKeys        map[string]string
 		port           int
+		batchSize      int
+		batchInterval  time.Duration
+		spoolDir       string
+		spoolInterval  time.Duration
+		databaseURL    string
+		blobStoreURL   string
+		signingKeys    map[string]string
+		signingWindow  time.Duration
+		signingMaxBody int64
+		requireSigning bool
+		sensorRefresh  time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -41,10 +61,141 @@ func main() {
 			defer closers.Close(writer)
 
 			logger := log.Default()
+			grp, ctx := errgroup.WithContext(ctx)
+
+			var events reading.EventWriter = writer
+			if spoolDir != "" {
+				spool, err := event.NewSpool(writer, spoolDir, logger)
+				if err != nil {
+					return err
+				}
+
+				grp.Go(func() error {
+					return spool.Replay(ctx, spoolInterval)
+				})
+
+				events = spool
+			}
+
+			// Upload sessions & asynchronous jobs are optional, they require a database to track their progress.
+			var db *sql.DB
+			if databaseURL != "" {
+				db, err = postgres.Open(ctx, databaseURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to database: %w", err)
+				}
+				defer closers.Close(db)
+			}
+
+			var sessions reading.SessionRepository
+			if db != nil {
+				sessions = reading.NewPostgresSessionRepository(db)
+			}
+
+			// Readings are validated against the sensor registry when a database is available, otherwise the
+			// built-in sensors are used.
+			var sensors reading.SensorRegistry = reading.DefaultSensorRules
+			if db != nil {
+				registry, err := sensor.NewRegistry(ctx, sensor.NewPostgresRepository(db), logger)
+				if err != nil {
+					return fmt.Errorf("failed to load sensors: %w", err)
+				}
+
+				grp.Go(func() error {
+					return registry.Run(ctx, sensorRefresh)
+				})
+
+				sensors = registry
+			}
+
+			var jobs reading.JobRepository
+			var blobs reading.BlobStore
+			if blobStoreURL != "" {
+				if db == nil {
+					return errors.New("a database is required for asynchronous ingest jobs")
+				}
+
+				bucket, err := blob.Open(ctx, blobStoreURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to blob storage: %w", err)
+				}
+				defer closers.Close(bucket)
+
+				jobs = reading.NewPostgresJobRepository(db)
+				blobs = bucket
+
+				worker := reading.NewJobWorker(reading.JobWorkerConfig{
+					Jobs:          jobs,
+					Blobs:         blobs,
+					Events:        events,
+					Logger:        logger,
+					Producer:      "ingestor/" + version,
+					BatchSize:     batchSize,
+					BatchInterval: batchInterval,
+					Sensors:       sensors,
+				})
+
+				grp.Go(func() error {
+					return worker.Run(ctx)
+				})
+			}
+
+			// Each API key identifies the vehicle that readings are ingested for. The single key flag predates
+			// support for multiple vehicles, so its key belongs to the default vehicle.
+			keys := make(map[string]string, len(apiKeys)+1)
+			for key, vehicle := range apiKeys {
+				keys[key] = vehicle
+			}
+			if apiKey != "" {
+				keys[apiKey] = reading.DefaultVehicle
+			}
+
+			// Keys issued using the keys subcommand are stored in the database, these are checked after those given
+			// as flags.
+			stores := []middleware.KeyStore{middleware.StaticKeys(keys)}
+			if db != nil {
+				stores = append(stores, apikey.NewPostgresRepository(db))
+			}
+
+			// Signed requests are verified using the signing keys, unsigned requests fall back to API keys unless
+			// signing is required.
+			auth := middleware.KeyStores(stores...)
+			switch {
+			case len(signingKeys) > 0:
+				keys, err := parseSigningKeys(signingKeys)
+				if err != nil {
+					return err
+				}
+
+				signed := middleware.HMAC(middleware.HMACConfig{
+					Keys:        keys,
+					Window:      signingWindow,
+					MaxBodySize: signingMaxBody,
+				})
+
+				if requireSigning {
+					auth = signed
+				} else {
+					auth = middleware.Signed(signed, auth)
+				}
+			case requireSigning:
+				return errors.New("signing keys are required when signing is required")
+			}
+
 			router := mux.NewRouter()
-			router.Use(middleware.APIKey(apiKey))
+			router.Use(auth)
 
-			handler := reading.NewHTTP(writer, logger)
+			handler := reading.NewHTTP(reading.HTTPConfig{
+				Events:        events,
+				Sessions:      sessions,
+				Jobs:          jobs,
+				Blobs:         blobs,
+				Logger:        logger,
+				Producer:      "ingestor/" + version,
+				BatchSize:     batchSize,
+				BatchInterval: batchInterval,
+				Sensors:       sensors,
+			})
 			handler.Register(router)
 
 			svr := &http.Server{
@@ -52,7 +203,6 @@ func main() {
 				Handler: router,
 			}
 
-			grp, ctx := errgroup.WithContext(ctx)
 			grp.Go(func() error {
 				return svr.ListenAndServe()
 			})
@@ -69,7 +219,22 @@ func main() {
 	flags := cmd.PersistentFlags()
 	flags.IntVar(&port, "port", 5000, "The port to listen for HTTP requests from")
 	flags.StringVar(&eventWriterURL, "event-writer-url", "", "The URL of the event bus to send messages to")
-	flags.StringVar(&apiKey, "api-key", "", "The API key to use for basic authentication")
+	flags.StringVar(&apiKey, "api-key", "", "The API key to use for basic authentication for the default vehicle")
+	flags.StringToStringVar(&apiKeys, "api-keys", nil, "API keys to use for basic authentication, mapped to the vehicle each belongs to in key=vehicle format")
+	flags.IntVar(&batchSize, "batch-size", 1, "The maximum number of readings to publish to the event bus at once")
+	flags.DurationVar(&batchInterval, "batch-interval", time.Second, "The maximum amount of time readings can be buffered before publishing")
+	flags.StringVar(&spoolDir, "spool-dir", "", "The directory to spool readings to when the event bus is unavailable, disabled if empty")
+	flags.StringVar(&databaseURL, "database-url", "", "The URL of the database used to track upload sessions & store API keys, both are disabled if empty")
+	flags.StringVar(&blobStoreURL, "blob-store-url", "", "The URL of the blob store used to hold uploads for asynchronous ingest jobs, jobs are disabled if empty")
+	flags.DurationVar(&spoolInterval, "spool-interval", time.Second*30, "How often to replay spooled readings onto the event bus")
+	flags.StringToStringVar(&signingKeys, "signing-keys", nil, "Keys used to verify signed requests, in id=vehicle:secret format")
+	flags.DurationVar(&signingWindow, "signing-window", time.Minute*5, "How far a signed request's timestamp may differ from the current time")
+	flags.Int64Var(&signingMaxBody, "signing-max-body-size", 32<<20, "The maximum size of a signed request's body in bytes, which is held in memory while its signature is verified")
+	flags.BoolVar(&requireSigning, "require-signing", false, "Reject requests that are not signed using one of the signing keys")
+	flags.DurationVar(&sensorRefresh, "sensor-refresh-interval", time.Minute, "How often to reload the sensor registry from the database")
+	_ = flags.MarkDeprecated("api-key", "use --api-keys instead")
+
+	cmd.AddCommand(keysCommand(&databaseURL))
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	if err := cmd.ExecuteContext(ctx); err != nil {
@@ -77,3 +242,22 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseSigningKeys converts the values of the signing keys flag into a middleware.StaticSigningKeys. Each value is
+// expected to be in vehicle:secret format.
+func parseSigningKeys(values map[string]string) (middleware.StaticSigningKeys, error) {
+	keys := make(middleware.StaticSigningKeys, len(values))
+	for id, value := range values {
+		vehicle, secret, ok := strings.Cut(value, ":")
+		if !ok || vehicle == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key %q, expected vehicle:secret format", id)
+		}
+
+		keys[id] = middleware.SigningKey{
+			Secret:      []byte(secret),
+			Credentials: middleware.Credentials{Vehicle: vehicle},
+		}
+	}
+
+	return keys, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/cloud-lada/backend/pkg/closers"
@@ -21,6 +22,13 @@ func main() {
 	var (
 		eventReaderURL string
 		databaseURL    string
+		batchSize      int
+		batchInterval  time.Duration
+		maxInFlight    int
+		errorPolicy    string
+		deadLetterURL  string
+		maxAttempts    int
+		retryBackoff   time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -36,16 +44,37 @@ func main() {
 			}
 			defer closers.Close(db)
 
-			reader, err := event.NewReader(ctx, eventReaderURL)
+			var deadLetter *event.Writer
+			if deadLetterURL != "" {
+				deadLetter, err = event.NewWriter(ctx, deadLetterURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to dead-letter event bus: %w", err)
+				}
+				defer closers.Close(deadLetter)
+			}
+
+			logger := log.Default()
+			reader, err := event.NewReader(ctx, event.ReaderConfig{
+				URL:          eventReaderURL,
+				MaxInFlight:  maxInFlight,
+				ErrorPolicy:  event.ErrorPolicy(errorPolicy),
+				MaxAttempts:  maxAttempts,
+				RetryBackoff: retryBackoff,
+				DeadLetter:   deadLetter,
+				Logger:       logger,
+			})
 			if err != nil {
 				return fmt.Errorf("failed to create reader: %w", err)
 			}
 			defer closers.Close(reader)
 
-			logger := log.Default()
 			handler := reading.NewEventHandler(reading.NewPostgresRepository(db), logger)
 
 			logger.Println("Listening for events from", eventReaderURL)
+			if batchSize > 1 {
+				return reader.ReadBatch(ctx, batchSize, batchInterval, handler.HandleEvents)
+			}
+
 			return reader.Read(ctx, handler.HandleEvent)
 		},
 	}
@@ -53,6 +82,13 @@ func main() {
 	flags := cmd.PersistentFlags()
 	flags.StringVar(&eventReaderURL, "event-reader-url", "", "The URL of the event bus to read messages from")
 	flags.StringVar(&databaseURL, "database-url", "", "The URL of the database to persist data to")
+	flags.IntVar(&batchSize, "batch-size", 1, "The maximum number of readings to persist at once")
+	flags.DurationVar(&batchInterval, "batch-interval", time.Second, "The maximum amount of time to wait for a batch to fill before persisting it")
+	flags.IntVar(&maxInFlight, "max-in-flight", 1, "The maximum number of events (or batches) to persist concurrently")
+	flags.StringVar(&errorPolicy, "error-policy", string(event.ErrorPolicyStop), "How to behave when persisting an event fails, one of 'stop' or 'continue'")
+	flags.StringVar(&deadLetterURL, "dead-letter-url", "", "The URL of the event bus to publish events to when they fail to persist")
+	flags.IntVar(&maxAttempts, "max-attempts", 3, "The number of times to attempt persisting an event before it is considered failed")
+	flags.DurationVar(&retryBackoff, "retry-backoff", time.Millisecond*100, "How long to wait before retrying a failed event, doubling after each attempt")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	if err := cmd.ExecuteContext(ctx); err != nil {
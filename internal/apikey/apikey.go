@@ -0,0 +1,74 @@
+// Package apikey provides all components required to manage the API keys used to authenticate devices uploading
+// readings. It includes key generation & the persistence layer.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// The Key type describes an API key. The key itself is never stored, only its hash, so it can only be obtained
+	// at the time it is issued.
+	Key struct {
+		// The unique identifier of the key, used to revoke it.
+		ID string `json:"id"`
+		// The SHA-256 hash of the key, hex encoded.
+		Hash string `json:"-"`
+		// A human-readable description of the key, such as the device it was issued to.
+		Label string `json:"label"`
+		// The identifier of the vehicle that readings uploaded using the key belong to.
+		Vehicle string `json:"vehicle"`
+		// The identifier of the device the key was issued to, if any.
+		DeviceID string `json:"device_id,omitempty"`
+		// The time at which the key was issued.
+		CreatedAt time.Time `json:"created_at"`
+		// The time at which the key was revoked, if it has been.
+		RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	}
+)
+
+// ErrKeyNotFound is the error returned when an API key does not exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// The number of random bytes used to generate each key.
+const keySize = 32
+
+// New generates a new API key for a vehicle & device. It returns the Key to be stored, alongside the key itself
+// which should be given to the device and cannot be recovered later.
+func New(label, vehicle, deviceID string) (Key, string, error) {
+	buf := make([]byte, keySize)
+	if _, err := rand.Read(buf); err != nil {
+		return Key{}, "", err
+	}
+
+	// The key is used as the basic authentication username, so it must not contain a colon.
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+
+	return Key{
+		ID:        uuid.NewString(),
+		Hash:      Hash(secret),
+		Label:     label,
+		Vehicle:   vehicle,
+		DeviceID:  deviceID,
+		CreatedAt: time.Now().UTC(),
+	}, secret, nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of an API key. As keys are randomly generated with high entropy, a fast
+// hash is sufficient and allows keys to be looked up directly by their hash.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Revoked returns true if the Key has been revoked.
+func (k Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,34 @@
+package apikey_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloud-lada/backend/internal/apikey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	key, secret, err := apikey.New("front logger", "lada", "logger-1")
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, key.ID)
+	assert.EqualValues(t, "front logger", key.Label)
+	assert.EqualValues(t, "lada", key.Vehicle)
+	assert.EqualValues(t, "logger-1", key.DeviceID)
+	assert.NotZero(t, key.CreatedAt)
+	assert.False(t, key.Revoked())
+
+	// Keys are used as basic authentication usernames, which cannot contain colons.
+	assert.NotEmpty(t, secret)
+	assert.False(t, strings.Contains(secret, ":"))
+	assert.EqualValues(t, apikey.Hash(secret), key.Hash)
+	assert.NotEqual(t, secret, key.Hash)
+
+	_, other, err := apikey.New("front logger", "lada", "logger-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
@@ -0,0 +1,172 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/cloud-lada/backend/pkg/postgres"
+	"github.com/google/uuid"
+)
+
+type (
+	// The PostgresRepository type is used to persist API keys into a PostgreSQL instance. It implements the
+	// middleware.KeyStore interface so it can be used to authenticate requests.
+	PostgresRepository struct {
+		db *sql.DB
+	}
+)
+
+// NewPostgresRepository returns a new instance of the PostgresRepository type that will perform queries against
+// the provided sql.DB instance.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const keyColumns = `id, hash, label, vehicle, device_id, created_at, revoked_at`
+
+// Create a new API key.
+func (pr *PostgresRepository) Create(ctx context.Context, key Key) error {
+	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `INSERT INTO api_key (` + keyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+		_, err := tx.ExecContext(ctx, q,
+			key.ID,
+			key.Hash,
+			key.Label,
+			key.Vehicle,
+			key.DeviceID,
+			key.CreatedAt,
+			key.RevokedAt,
+		)
+
+		return err
+	})
+}
+
+// Get an API key by its identifier. Returns ErrKeyNotFound if the key does not exist.
+func (pr *PostgresRepository) Get(ctx context.Context, id string) (Key, error) {
+	// Key identifiers are always UUIDs, Postgres would reject anything else with an error rather than find no rows.
+	if _, err := uuid.Parse(id); err != nil {
+		return Key{}, ErrKeyNotFound
+	}
+
+	var key Key
+	err := postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		const q = `SELECT ` + keyColumns + ` FROM api_key WHERE id = $1`
+
+		key, err = scanKey(tx.QueryRowContext(ctx, q, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrKeyNotFound
+		}
+
+		return err
+	})
+
+	return key, err
+}
+
+// List all API keys, including those that have been revoked, in the order they were issued.
+func (pr *PostgresRepository) List(ctx context.Context) ([]Key, error) {
+	keys := make([]Key, 0)
+	err := postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `SELECT ` + keyColumns + ` FROM api_key ORDER BY created_at`
+
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return err
+		}
+		defer closers.Close(rows)
+
+		for rows.Next() {
+			key, err := scanKey(rows)
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, key)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		return rows.Close()
+	})
+
+	return keys, err
+}
+
+// Revoke an API key, preventing it from being used to authenticate any further requests. Revoking an already revoked
+// key has no effect. Returns ErrKeyNotFound if the key does not exist.
+func (pr *PostgresRepository) Revoke(ctx context.Context, id string) (Key, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return Key{}, ErrKeyNotFound
+	}
+
+	var key Key
+	err := postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		const q = `
+			UPDATE api_key SET revoked_at = COALESCE(revoked_at, $2)
+			WHERE id = $1
+			RETURNING ` + keyColumns
+
+		key, err = scanKey(tx.QueryRowContext(ctx, q, id, time.Now().UTC()))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrKeyNotFound
+		}
+
+		return err
+	})
+
+	return key, err
+}
+
+// Lookup returns the credentials associated with an API key. Returns middleware.ErrInvalidKey if the key does not
+// exist or has been revoked.
+func (pr *PostgresRepository) Lookup(ctx context.Context, secret string) (middleware.Credentials, error) {
+	var credentials middleware.Credentials
+	err := postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `SELECT vehicle, device_id FROM api_key WHERE hash = $1 AND revoked_at IS NULL`
+
+		err := tx.QueryRowContext(ctx, q, Hash(secret)).Scan(&credentials.Vehicle, &credentials.DeviceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return middleware.ErrInvalidKey
+		}
+
+		return err
+	})
+
+	return credentials, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row scanner) (Key, error) {
+	var key Key
+	var revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.Hash,
+		&key.Label,
+		&key.Vehicle,
+		&key.DeviceID,
+		&key.CreatedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return key, err
+	}
+
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,79 @@
+package apikey_test
+
+import (
+	"testing"
+
+	"github.com/cloud-lada/backend/internal/apikey"
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/cloud-lada/backend/pkg/testutil"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := apikey.NewPostgresRepository(db)
+
+	key, secret, err := apikey.New("front logger", "lada", "logger-1")
+	require.NoError(t, err)
+
+	t.Run("It should create a key", func(t *testing.T) {
+		require.NoError(t, repo.Create(ctx, key))
+
+		actual, err := repo.Get(ctx, key.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, key.Hash, actual.Hash)
+		assert.EqualValues(t, key.Vehicle, actual.Vehicle)
+		assert.EqualValues(t, key.DeviceID, actual.DeviceID)
+	})
+
+	t.Run("It should list keys", func(t *testing.T) {
+		keys, err := repo.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.EqualValues(t, key.ID, keys[0].ID)
+	})
+
+	t.Run("It should look up the credentials for a key", func(t *testing.T) {
+		actual, err := repo.Lookup(ctx, secret)
+		require.NoError(t, err)
+		assert.EqualValues(t, middleware.Credentials{Vehicle: "lada", DeviceID: "logger-1"}, actual)
+	})
+
+	t.Run("It should return an error for an unknown key", func(t *testing.T) {
+		_, err := repo.Lookup(ctx, "unknown")
+		assert.ErrorIs(t, err, middleware.ErrInvalidKey)
+	})
+
+	t.Run("It should revoke a key", func(t *testing.T) {
+		actual, err := repo.Revoke(ctx, key.ID)
+		require.NoError(t, err)
+		assert.True(t, actual.Revoked())
+
+		_, err = repo.Lookup(ctx, secret)
+		assert.ErrorIs(t, err, middleware.ErrInvalidKey)
+	})
+
+	t.Run("It should return an error when revoking an unknown key", func(t *testing.T) {
+		_, err := repo.Revoke(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+
+		_, err = repo.Revoke(ctx, "not-a-uuid")
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+	})
+
+	t.Run("It should return an error when getting an unknown key", func(t *testing.T) {
+		_, err := repo.Get(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+
+		_, err = repo.Get(ctx, "not-a-uuid")
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+	})
+}
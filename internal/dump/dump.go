@@ -9,6 +9,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/cloud-lada/backend/internal/location"
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/cloud-lada/backend/pkg/closers"
 )
@@ -17,16 +18,25 @@ type (
 	// The Config type contains fields used to configure the Dumper.
 	Config struct {
 		Date     time.Time
+		Vehicle  string
 		Readings Repository
 		Blobs    Sink
+		// The source of the vehicle's route, if set the route is also exported in each location.Format.
+		Track TrackRepository
 	}
 
 	// The Repository interface describes types that can iterate over reading data in a database.
 	Repository interface {
-		ForEachOnDate(ctx context.Context, date time.Time, fn reading.ForEachFunc) error
+		ForEachOnDate(ctx context.Context, vehicle string, date time.Time, fn reading.ForEachFunc) error
 	}
 
-	// The Sink interface describes types that provide keyed blobs where sensor data can be written.
+	// The TrackRepository interface describes types that can iterate over the route of a vehicle in a database.
+	TrackRepository interface {
+		ForEachTrackPoint(ctx context.Context, vehicle string, from, to time.Time, fn location.ForEachFunc) error
+	}
+
+	// The Sink interface describes types that provide keyed blobs where sensor data can be written. A blob is stored
+	// once its writer is closed, and discarded if the context given to NewWriter is cancelled before then.
 	Sink interface {
 		NewWriter(ctx context.Context, name string) (io.WriteCloser, error)
 	}
@@ -35,7 +45,9 @@ type (
 	Dumper struct {
 		readings Repository
 		blobs    Sink
+		track    TrackRepository
 		date     time.Time
+		vehicle  string
 	}
 )
 
@@ -45,15 +57,31 @@ func New(config Config) *Dumper {
 	return &Dumper{
 		readings: config.Readings,
 		blobs:    config.Blobs,
+		track:    config.Track,
+		vehicle:  config.Vehicle,
 		// We want to get all the data for a given day, so we need to start at 00:00:00 for that specific day.
 		date: time.Date(config.Date.Year(), config.Date.Month(), config.Date.Day(), 0, 0, 0, 0, config.Date.Location()),
 	}
 }
 
-// Dump JSON-encoded readings for the configured date into the blob storage provider. Dumps will be JSON streams
-// similar to how they are originally presented to the ingestor.
+// Dump JSON-encoded readings for the configured vehicle & date into the blob storage provider. Dumps will be JSON
+// streams similar to how they are originally presented to the ingestor. Each vehicle's dumps are stored under a
+// prefix matching its identifier. If a TrackRepository is configured, the route driven on the date is also written
+// alongside the readings as GPX and KML documents.
 func (d *Dumper) Dump(ctx context.Context) error {
-	name := d.date.Format("2006-01-02.json.gz")
+	if err := d.dumpReadings(ctx); err != nil {
+		return err
+	}
+
+	if d.track == nil {
+		return nil
+	}
+
+	return d.dumpTrack(ctx, location.FormatGPX, location.FormatKML)
+}
+
+func (d *Dumper) dumpReadings(ctx context.Context) error {
+	name := d.vehicle + "/" + d.date.Format("2006-01-02.json.gz")
 	blob, err := d.blobs.NewWriter(ctx, name)
 	if err != nil {
 		return fmt.Errorf("failed to open blob: %w", err)
@@ -64,7 +92,7 @@ func (d *Dumper) Dump(ctx context.Context) error {
 	defer closers.Close(archive)
 
 	encoder := json.NewEncoder(archive)
-	return d.readings.ForEachOnDate(ctx, d.date, func(ctx context.Context, reading reading.Reading) error {
+	return d.readings.ForEachOnDate(ctx, d.vehicle, d.date, func(ctx context.Context, reading reading.Reading) error {
 		if err = encoder.Encode(reading); err != nil {
 			return err
 		}
@@ -72,3 +100,55 @@ func (d *Dumper) Dump(ctx context.Context) error {
 		return archive.Flush()
 	})
 }
+
+// dumpTrack writes the route driven on the configured date in each of the formats, iterating over the route once.
+// The blobs are only stored once every format has been written in full, otherwise they are discarded.
+func (d *Dumper) dumpTrack(ctx context.Context, formats ...location.Format) error {
+	// Cancelling the context given to the Sink discards any blob that has not yet been closed, so returning early
+	// never leaves a truncated track behind.
+	blobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blobs := make([]io.WriteCloser, len(formats))
+	writers := make([]location.TrackWriter, len(formats))
+	for i, format := range formats {
+		name := d.vehicle + "/" + d.date.Format("2006-01-02") + "." + string(format)
+		blob, err := d.blobs.NewWriter(blobCtx, name)
+		if err != nil {
+			return fmt.Errorf("failed to open blob: %w", err)
+		}
+
+		blobs[i] = blob
+		writers[i], err = location.NewTrackWriter(blob, format, d.vehicle)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := d.track.ForEachTrackPoint(ctx, d.vehicle, d.date, d.date.AddDate(0, 0, 1), func(ctx context.Context, point location.TrackPoint) error {
+		for _, writer := range writers {
+			if err := writer.Write(point); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, writer := range writers {
+		if err = writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	for _, blob := range blobs {
+		if err = blob.Close(); err != nil {
+			return fmt.Errorf("failed to close blob: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cloud-lada/backend/internal/dump"
+	"github.com/cloud-lada/backend/internal/location"
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,16 +31,19 @@ func TestDumper_Dump(t *testing.T) {
 			Date: time.Now(),
 			Seed: []reading.Reading{
 				{
+					Vehicle:   "lada",
 					Sensor:    reading.SensorTypeSpeed,
 					Value:     100,
 					Timestamp: time.Now().UTC(),
 				},
 				{
+					Vehicle:   "lada",
 					Sensor:    reading.SensorTypeSpeed,
 					Value:     200,
 					Timestamp: time.Now().UTC(),
 				},
 				{
+					Vehicle:   "lada",
 					Sensor:    reading.SensorTypeSpeed,
 					Value:     300,
 					Timestamp: time.Now().UTC(),
@@ -62,6 +66,7 @@ func TestDumper_Dump(t *testing.T) {
 
 			config := dump.Config{
 				Date:     tc.Date,
+				Vehicle:  "lada",
 				Readings: readings,
 				Blobs:    blobs,
 			}
@@ -72,7 +77,7 @@ func TestDumper_Dump(t *testing.T) {
 				return
 			}
 
-			assert.EqualValues(t, tc.Date.Format("2006-01-02.json.gz"), blobs.name)
+			assert.EqualValues(t, "lada/"+tc.Date.Format("2006-01-02.json.gz"), blobs.name)
 
 			reader, err := gzip.NewReader(blobs.buffer)
 			require.NoError(t, err)
@@ -88,3 +93,105 @@ func TestDumper_Dump(t *testing.T) {
 		})
 	}
 }
+
+func TestDumper_DumpTimezone(t *testing.T) {
+	t.Parallel()
+
+	location, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	readings := &MockRepository{}
+	blobs := &MockSink{buffer: bytes.NewBuffer([]byte{})}
+
+	// Midday UTC on the 13th is still the morning of the 13th in New York.
+	date := time.Date(2022, 3, 13, 12, 0, 0, 0, time.UTC).In(location)
+
+	err = dump.New(dump.Config{
+		Date:     date,
+		Vehicle:  "lada",
+		Readings: readings,
+		Blobs:    blobs,
+	}).Dump(ctx)
+	require.NoError(t, err)
+
+	expected := time.Date(2022, 3, 13, 0, 0, 0, 0, location)
+	assert.True(t, expected.Equal(readings.date))
+	assert.EqualValues(t, location, readings.date.Location())
+	assert.EqualValues(t, "lada/2022-03-13.json.gz", blobs.name)
+}
+
+func TestDumper_DumpTrack(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	date := time.Date(2022, 4, 23, 0, 0, 0, 0, time.UTC)
+	speed := 80.0
+
+	readings := &MockRepository{}
+	track := &MockTrackRepository{
+		points: []location.TrackPoint{
+			{
+				Location: location.Location{Latitude: 51, Longitude: 50, Timestamp: date.Add(time.Hour)},
+				Speed:    &speed,
+			},
+			{
+				Location: location.Location{Latitude: 51.1, Longitude: 50.1, Timestamp: date.Add(time.Hour * 2)},
+			},
+		},
+	}
+	blobs := &MockSink{blobs: make(map[string]*bytes.Buffer)}
+
+	err := dump.New(dump.Config{
+		Date:     date,
+		Vehicle:  "lada",
+		Readings: readings,
+		Blobs:    blobs,
+		Track:    track,
+	}).Dump(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, date.Equal(track.from))
+	assert.True(t, date.AddDate(0, 0, 1).Equal(track.to))
+
+	require.Contains(t, blobs.blobs, "lada/2022-04-23.json.gz")
+	require.Contains(t, blobs.blobs, "lada/2022-04-23.gpx")
+	require.Contains(t, blobs.blobs, "lada/2022-04-23.kml")
+
+	gpx := blobs.blobs["lada/2022-04-23.gpx"].String()
+	assert.Contains(t, gpx, `<trkpt lat="51" lon="50"><time>2022-04-23T01:00:00Z</time>`)
+	assert.Contains(t, gpx, `<trkpt lat="51.1" lon="50.1"><time>2022-04-23T02:00:00Z</time></trkpt>`)
+
+	kml := blobs.blobs["lada/2022-04-23.kml"].String()
+	assert.Contains(t, kml, "<gx:coord>50 51 0</gx:coord>")
+	assert.Contains(t, kml, "<gx:coord>50.1 51.1 0</gx:coord>")
+}
+
+func TestDumper_DumpTrackError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	date := time.Date(2022, 4, 23, 0, 0, 0, 0, time.UTC)
+
+	track := &MockTrackRepository{
+		err: io.EOF,
+		points: []location.TrackPoint{
+			{Location: location.Location{Latitude: 51, Longitude: 50, Timestamp: date.Add(time.Hour)}},
+		},
+	}
+	blobs := &MockSink{blobs: make(map[string]*bytes.Buffer)}
+
+	err := dump.New(dump.Config{
+		Date:     date,
+		Vehicle:  "lada",
+		Readings: &MockRepository{},
+		Blobs:    blobs,
+		Track:    track,
+	}).Dump(ctx)
+	require.ErrorIs(t, err, io.EOF)
+
+	// The truncated tracks should be discarded rather than stored.
+	assert.Contains(t, blobs.blobs, "lada/2022-04-23.json.gz")
+	assert.NotContains(t, blobs.blobs, "lada/2022-04-23.gpx")
+	assert.NotContains(t, blobs.blobs, "lada/2022-04-23.kml")
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/cloud-lada/backend/internal/location"
 	"github.com/cloud-lada/backend/internal/reading"
 )
 
@@ -13,28 +14,60 @@ type (
 	MockRepository struct {
 		err      error
 		readings []reading.Reading
+		date     time.Time
+	}
+
+	MockTrackRepository struct {
+		err    error
+		points []location.TrackPoint
+		from   time.Time
+		to     time.Time
 	}
 
 	MockSink struct {
 		name   string
 		buffer *bytes.Buffer
+		blobs  map[string]*bytes.Buffer
 	}
 
 	NoopCloser struct {
 		io.Writer
 	}
+
+	// MockBlob only stores its contents within the MockSink once closed, and discards them if its context was
+	// cancelled first.
+	MockBlob struct {
+		*bytes.Buffer
+		ctx  context.Context
+		name string
+		sink *MockSink
+	}
 )
 
+func (m *MockBlob) Close() error {
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+
+	m.sink.blobs[m.name] = m.Buffer
+	return nil
+}
+
 func (n *NoopCloser) Close() error {
 	return nil
 }
 
 func (m *MockSink) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
 	m.name = name
+	if m.blobs != nil {
+		return &MockBlob{Buffer: bytes.NewBuffer([]byte{}), ctx: ctx, name: name, sink: m}, nil
+	}
+
 	return &NoopCloser{Writer: m.buffer}, nil
 }
 
-func (m *MockRepository) ForEachOnDate(ctx context.Context, date time.Time, fn reading.ForEachFunc) error {
+func (m *MockRepository) ForEachOnDate(ctx context.Context, vehicle string, date time.Time, fn reading.ForEachFunc) error {
+	m.date = date
 	for _, r := range m.readings {
 		if err := fn(ctx, r); err != nil {
 			return err
@@ -43,3 +76,15 @@ func (m *MockRepository) ForEachOnDate(ctx context.Context, date time.Time, fn r
 
 	return m.err
 }
+
+func (m *MockTrackRepository) ForEachTrackPoint(ctx context.Context, vehicle string, from, to time.Time, fn location.ForEachFunc) error {
+	m.from = from
+	m.to = to
+	for _, point := range m.points {
+		if err := fn(ctx, point); err != nil {
+			return err
+		}
+	}
+
+	return m.err
+}
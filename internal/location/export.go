@@ -0,0 +1,244 @@
+package location
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/units"
+)
+
+type (
+	// The TrackPoint type describes a Location along with the speed of the vehicle when it was there. The Speed is
+	// nil when no speed reading was recorded close enough to the Location.
+	TrackPoint struct {
+		Location
+		Speed *float64 `json:"speed,omitempty"`
+	}
+
+	// The ForEachFunc type is a function invoked for each TrackPoint when iterating over a track.
+	ForEachFunc func(ctx context.Context, point TrackPoint) error
+
+	// The Format type describes a file format that a track can be exported as.
+	Format string
+
+	// The TrackWriter interface describes types that encode a stream of TrackPoint values into a Format. Close must
+	// be called once all points have been written to complete the document, it does not close the underlying writer.
+	TrackWriter interface {
+		Write(point TrackPoint) error
+		Close() error
+	}
+
+	// The GPXWriter type is a TrackWriter that encodes points as a GPX 1.1 track. Speeds are written in metres per
+	// second using the Garmin TrackPointExtension.
+	//
+	// https://www.topografix.com/GPX/1/1/
+	GPXWriter struct {
+		w io.Writer
+	}
+
+	// The KMLWriter type is a TrackWriter that encodes points as a KML gx:MultiTrack. Speeds are written in kilometres
+	// per hour as extended data. The extended data of a gx:Track follows all of its points, so speeds are buffered until
+	// the track is complete. To bound the buffer, points are split into consecutive gx:Track elements of up to 1000
+	// points each, which are joined together when displayed.
+	//
+	// https://developers.google.com/kml/documentation/kmlreference#gxmultitrack
+	KMLWriter struct {
+		w      io.Writer
+		points int
+		speeds bytes.Buffer
+	}
+)
+
+// Constants for export formats.
+const (
+	FormatGPX = Format("gpx")
+	FormatKML = Format("kml")
+)
+
+// ParseFormat parses a Format from its name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatGPX, FormatKML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// ContentType returns the MIME type of documents in the Format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// NewTrackWriter returns a TrackWriter that writes a track with the given name to w in the Format.
+func NewTrackWriter(w io.Writer, format Format, name string) (TrackWriter, error) {
+	switch format {
+	case FormatGPX:
+		return NewGPXWriter(w, name)
+	case FormatKML:
+		return NewKMLWriter(w, name)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// NewGPXWriter returns a new instance of the GPXWriter type that writes a track with the given name to w. The start
+// of the document is written immediately.
+func NewGPXWriter(w io.Writer, name string) (*GPXWriter, error) {
+	const header = xml.Header +
+		`<gpx version="1.1" creator="cloud-lada" xmlns="http://www.topografix.com/GPX/1/1" ` +
+		`xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">` + "\n" +
+		"<trk>\n<name>%s</name>\n<trkseg>\n"
+
+	if _, err := fmt.Fprintf(w, header, escape(name)); err != nil {
+		return nil, err
+	}
+
+	return &GPXWriter{w: w}, nil
+}
+
+// Write a TrackPoint to the GPX document.
+func (g *GPXWriter) Write(point TrackPoint) error {
+	_, err := fmt.Fprintf(g.w, `<trkpt lat="%s" lon="%s"><time>%s</time>`,
+		formatFloat(point.Latitude),
+		formatFloat(point.Longitude),
+		point.Timestamp.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return err
+	}
+
+	if point.Speed != nil {
+		// Speed readings are stored in kilometres per hour, GPX expects metres per second.
+		speed, err := units.Convert(*point.Speed, units.KilometresPerHour, units.MetresPerSecond)
+		if err != nil {
+			return err
+		}
+
+		const extension = "<extensions><gpxtpx:TrackPointExtension><gpxtpx:speed>%s</gpxtpx:speed></gpxtpx:TrackPointExtension></extensions>"
+		if _, err = fmt.Fprintf(g.w, extension, formatFloat(speed)); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(g.w, "</trkpt>\n")
+	return err
+}
+
+// Close writes the end of the GPX document.
+func (g *GPXWriter) Close() error {
+	_, err := io.WriteString(g.w, "</trkseg>\n</trk>\n</gpx>\n")
+	return err
+}
+
+// The maximum number of points within each gx:Track written by a KMLWriter.
+const kmlTrackSize = 1000
+
+// NewKMLWriter returns a new instance of the KMLWriter type that writes a track with the given name to w. The start
+// of the document is written immediately.
+func NewKMLWriter(w io.Writer, name string) (*KMLWriter, error) {
+	const header = xml.Header +
+		`<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">` + "\n" +
+		"<Document>\n<name>%[1]s</name>\n" +
+		`<Schema id="track"><gx:SimpleArrayField name="speed" type="float"><displayName>Speed (km/h)</displayName></gx:SimpleArrayField></Schema>` + "\n" +
+		"<Placemark>\n<name>%[1]s</name>\n<gx:MultiTrack>\n<gx:interpolate>1</gx:interpolate>\n"
+
+	if _, err := fmt.Fprintf(w, header, escape(name)); err != nil {
+		return nil, err
+	}
+
+	return &KMLWriter{w: w}, nil
+}
+
+// Write a TrackPoint to the KML document.
+func (k *KMLWriter) Write(point TrackPoint) error {
+	if k.points == 0 {
+		if _, err := io.WriteString(k.w, "<gx:Track>\n"); err != nil {
+			return err
+		}
+	}
+
+	// A gx:Track may interleave the time and coordinates of each point. Tracks are clamped to the ground, so the
+	// altitude of each coordinate is always zero.
+	_, err := fmt.Fprintf(k.w, "<when>%s</when>\n<gx:coord>%s %s 0</gx:coord>\n",
+		point.Timestamp.UTC().Format(time.RFC3339Nano),
+		formatFloat(point.Longitude),
+		formatFloat(point.Latitude),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Every point needs a value so that speeds line up with their coordinates, even if the speed is unknown.
+	if point.Speed != nil {
+		fmt.Fprintf(&k.speeds, "<gx:value>%s</gx:value>\n", formatFloat(*point.Speed))
+	} else {
+		k.speeds.WriteString("<gx:value/>\n")
+	}
+
+	k.points++
+	if k.points < kmlTrackSize {
+		return nil
+	}
+
+	return k.endTrack()
+}
+
+// Close writes the buffered speeds of the current track followed by the end of the KML document.
+func (k *KMLWriter) Close() error {
+	if err := k.endTrack(); err != nil {
+		return err
+	}
+
+	const footer = "</gx:MultiTrack>\n</Placemark>\n</Document>\n</kml>\n"
+	_, err := io.WriteString(k.w, footer)
+	return err
+}
+
+// endTrack writes the buffered speeds as the extended data of the current gx:Track and closes it, if one is open.
+func (k *KMLWriter) endTrack() error {
+	if k.points == 0 {
+		return nil
+	}
+
+	const extendedData = `<ExtendedData><SchemaData schemaUrl="#track"><gx:SimpleArrayData name="speed">` + "\n"
+	if _, err := io.WriteString(k.w, extendedData); err != nil {
+		return err
+	}
+
+	if _, err := k.speeds.WriteTo(k.w); err != nil {
+		return err
+	}
+
+	const footer = "</gx:SimpleArrayData></SchemaData></ExtendedData>\n</gx:Track>\n"
+	if _, err := io.WriteString(k.w, footer); err != nil {
+		return err
+	}
+
+	k.points = 0
+	k.speeds.Reset()
+	return nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func escape(value string) string {
+	var buf bytes.Buffer
+	// Writes to a bytes.Buffer cannot fail.
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
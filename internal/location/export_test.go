@@ -0,0 +1,135 @@
+package location_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/location"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackWriter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	speed := 36.0
+	points := []location.TrackPoint{
+		{
+			Location: location.Location{Latitude: 51, Longitude: 50, Timestamp: now},
+			Speed:    &speed,
+		},
+		{
+			Location: location.Location{Latitude: 51.1, Longitude: 50.1, Timestamp: now.Add(time.Second)},
+		},
+	}
+
+	tt := []struct {
+		Name     string
+		Format   location.Format
+		Expected []string
+	}{
+		{
+			Name:   "It should write a GPX track",
+			Format: location.FormatGPX,
+			Expected: []string{
+				"<name>lada &amp; co</name>",
+				`<trkpt lat="51" lon="50"><time>2022-04-23T12:00:00Z</time>`,
+				// Speeds are converted to metres per second.
+				"<gpxtpx:speed>10</gpxtpx:speed>",
+				`<trkpt lat="51.1" lon="50.1"><time>2022-04-23T12:00:01Z</time></trkpt>`,
+			},
+		},
+		{
+			Name:   "It should write a KML track",
+			Format: location.FormatKML,
+			Expected: []string{
+				"<name>lada &amp; co</name>",
+				"<when>2022-04-23T12:00:00Z</when>\n<gx:coord>50 51 0</gx:coord>\n<when>2022-04-23T12:00:01Z</when>\n<gx:coord>50.1 51.1 0</gx:coord>",
+				"<gx:value>36</gx:value>\n<gx:value/>",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := location.NewTrackWriter(&buf, tc.Format, "lada & co")
+			require.NoError(t, err)
+
+			for _, point := range points {
+				require.NoError(t, writer.Write(point))
+			}
+			require.NoError(t, writer.Close())
+
+			actual := buf.String()
+			for _, expected := range tc.Expected {
+				assert.Contains(t, actual, expected)
+			}
+
+			// The document should be well-formed XML.
+			decoder := xml.NewDecoder(&buf)
+			for {
+				_, err = decoder.Token()
+				if err != nil {
+					break
+				}
+			}
+			assert.EqualError(t, err, "EOF")
+		})
+	}
+}
+
+func TestKMLWriter_Split(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writer, err := location.NewKMLWriter(&buf, "lada")
+	require.NoError(t, err)
+
+	// Long tracks should be split so that the speeds of each part can be written as soon as it is complete.
+	now := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 1500; i++ {
+		point := location.TrackPoint{Location: location.Location{Latitude: 51, Longitude: 50, Timestamp: now}}
+		require.NoError(t, writer.Write(point))
+	}
+
+	assert.Equal(t, 1, strings.Count(buf.String(), "</gx:Track>"))
+	require.NoError(t, writer.Close())
+
+	actual := buf.String()
+	assert.Equal(t, 2, strings.Count(actual, "<gx:Track>"))
+	assert.Equal(t, 2, strings.Count(actual, "</gx:Track>"))
+	assert.Equal(t, 1500, strings.Count(actual, "<gx:value/>"))
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Value        string
+		Expected     location.Format
+		ExpectsError bool
+	}{
+		{Name: "It should parse GPX", Value: "gpx", Expected: location.FormatGPX},
+		{Name: "It should parse KML", Value: "kml", Expected: location.FormatKML},
+		{Name: "It should return an error for unknown formats", Value: "shp", ExpectsError: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := location.ParseFormat(tc.Value)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
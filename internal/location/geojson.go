@@ -0,0 +1,65 @@
+package location
+
+import (
+	"time"
+)
+
+type (
+	// The FeatureCollection type is a GeoJSON feature collection.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc7946#section-3.3
+	FeatureCollection struct {
+		Type     string    `json:"type"`
+		Features []Feature `json:"features"`
+	}
+
+	// The Feature type is a GeoJSON feature.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc7946#section-3.2
+	Feature struct {
+		Type       string                 `json:"type"`
+		Geometry   Geometry               `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+
+	// The Geometry type is a GeoJSON geometry. Coordinates are given as longitude, latitude pairs.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc7946#section-3.1
+	Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates [][]float64 `json:"coordinates"`
+	}
+)
+
+// NewTrack returns a FeatureCollection containing a single LineString Feature made up of the locations. The timestamp
+// of each location is included in the "coordTimes" property of the Feature. A LineString must contain at least two
+// positions, so the FeatureCollection has no features when there are fewer locations than that.
+func NewTrack(vehicle string, points []Location) FeatureCollection {
+	if len(points) < 2 {
+		return FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	}
+
+	coordinates := make([][]float64, len(points))
+	times := make([]time.Time, len(points))
+	for i, point := range points {
+		coordinates[i] = []float64{point.Longitude, point.Latitude}
+		times[i] = point.Timestamp
+	}
+
+	return FeatureCollection{
+		Type: "FeatureCollection",
+		Features: []Feature{
+			{
+				Type: "Feature",
+				Geometry: Geometry{
+					Type:        "LineString",
+					Coordinates: coordinates,
+				},
+				Properties: map[string]interface{}{
+					"vehicle":    vehicle,
+					"coordTimes": times,
+				},
+			},
+		},
+	}
+}
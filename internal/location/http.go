@@ -3,8 +3,15 @@ package location
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/cloud-lada/backend/pkg/units"
 	"github.com/gorilla/mux"
 )
 
@@ -12,37 +19,304 @@ type (
 	// The HTTP type contains HTTP request handlers that serve location data.
 	HTTP struct {
 		location Repository
+		logger   *log.Logger
 	}
 
 	// The Repository interface describes types that can query location database from persistent
 	// storage.
 	Repository interface {
-		Latest(ctx context.Context) (Location, error)
+		Latest(ctx context.Context, vehicle string) (Location, error)
+		Track(ctx context.Context, vehicle string, from, to time.Time) ([]Location, error)
+		ForEachTrackPoint(ctx context.Context, vehicle string, from, to time.Time, fn ForEachFunc) error
+		Distance(ctx context.Context, vehicle string, from, to time.Time) (float64, error)
+		DailyDistance(ctx context.Context, vehicle string, from, to time.Time) ([]DailyDistance, error)
 	}
 )
 
 // NewHTTP returns a new instance of the HTTP type that will serve location data queried from the
-// Repository implementation.
-func NewHTTP(location Repository) *HTTP {
-	return &HTTP{location: location}
+// Repository implementation. Errors that can't be returned to the client are written to the logger.
+func NewHTTP(location Repository, logger *log.Logger) *HTTP {
+	return &HTTP{location: location, logger: logger}
 }
 
-// Latest handles an inbound HTTP GET request that returns the latest location stored within the Repository.
+// Latest handles an inbound HTTP GET request that returns the latest location of a vehicle stored within the
+// Repository. Returns a 404 if the vehicle has no location.
 func (h *HTTP) Latest(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.location.Latest(r.Context())
+	location, err := h.location.Latest(r.Context(), mux.Vars(r)["vehicle"])
+	switch {
+	case errors.Is(err, ErrNoLocation):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(location); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+const (
+	// MaxTrackRange is the longest range of time a track can be requested or exported for.
+	MaxTrackRange = time.Hour * 24 * 31
+	// MaxDistanceDays is the largest number of dates daily distances can be requested for.
+	MaxDistanceDays = 366
+)
+
+// Track handles an inbound HTTP GET request that returns the route driven by a vehicle within a range of time as a
+// GeoJSON FeatureCollection. The track is simplified using the tolerance, in metres, given by the optional "tolerance"
+// query parameter.
+func (h *HTTP) Track(w http.ResponseWriter, r *http.Request) {
+	vehicle := mux.Vars(r)["vehicle"]
+	query := r.URL.Query()
+
+	from, to, err := parseRange(query, MaxTrackRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tolerance float64
+	if value := query.Get("tolerance"); value != "" {
+		tolerance, err = strconv.ParseFloat(value, 64)
+		if err != nil || tolerance < 0 {
+			http.Error(w, "tolerance must be a non-negative number of metres", http.StatusBadRequest)
+			return
+		}
+	}
+
+	points, err := h.location.Track(r.Context(), vehicle, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err = json.NewEncoder(w).Encode(NewTrack(vehicle, Simplify(points, tolerance))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Export handles an inbound HTTP GET request that streams the route driven by a vehicle within a range of time as a
+// document in the Format given by the "format" path parameter, for use in mapping tools such as Google Earth.
+func (h *HTTP) Export(w http.ResponseWriter, r *http.Request) {
+	vehicle := mux.Vars(r)["vehicle"]
+
+	format, err := ParseFormat(mux.Vars(r)["format"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	from, to, err := parseRange(r.URL.Query(), MaxTrackRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", vehicle, from.Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Once the start of the document has been written the status code can no longer be changed, so any later errors
+	// can only be reported by abandoning the document.
+	writer, err := NewTrackWriter(w, format, vehicle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.location.ForEachTrackPoint(r.Context(), vehicle, from, to, func(ctx context.Context, point TrackPoint) error {
+		return writer.Write(point)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		// Aborting the connection prevents the response from being terminated cleanly, so clients don't mistake a
+		// truncated document for a complete one.
+		h.logger.Printf("failed to export track for vehicle %s: %v", vehicle, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Distance handles an inbound HTTP GET request that returns the distance travelled by a vehicle. When no range is given
+// in the query parameters, the total distance the vehicle has travelled is returned. Distances are returned in
+// kilometres, or converted to the units given in the "units" query parameter.
+func (h *HTTP) Distance(w http.ResponseWriter, r *http.Request) {
+	vehicle := mux.Vars(r)["vehicle"]
+	query := r.URL.Query()
+
+	prefs, err := units.ParsePreferences(query["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var from, to time.Time
+	if query.Get("date") != "" || query.Get("from") != "" || query.Get("to") != "" {
+		from, to, err = parseRange(query, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metres, err := h.location.Distance(r.Context(), vehicle, from, to)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	distance := Distance{Unit: prefs.For(units.Kilometres)}
+	if distance.Distance, err = units.Convert(metres, units.Metres, distance.Unit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err = json.NewEncoder(w).Encode(stats); err != nil {
+	if err = json.NewEncoder(w).Encode(distance); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// DailyDistance handles an inbound HTTP GET request that returns the distance travelled by a vehicle on each date
+// within a range. The range is given by the "from" and "to" query parameters as YYYY-MM-DD formatted dates, both
+// inclusive, with "to" defaulting to the current date. The boundaries of each date are determined using the IANA time
+// zone given by the "tz" query parameter. Distances are returned in kilometres, or converted to the units given in the
+// "units" query parameter.
+func (h *HTTP) DailyDistance(w http.ResponseWriter, r *http.Request) {
+	const dateFormat = "2006-01-02"
+
+	vehicle := mux.Vars(r)["vehicle"]
+	query := r.URL.Query()
+
+	prefs, err := units.ParsePreferences(query["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	location, err := parseLocation(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := time.ParseInLocation(dateFormat, query.Get("from"), location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().In(location)
+	if value := query.Get("to"); value != "" {
+		if to, err = time.ParseInLocation(dateFormat, value, location); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The end of the range is inclusive, so the range ends at the start of the following date.
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, location).AddDate(0, 0, 1)
+
+	switch {
+	case !from.Before(to):
+		http.Error(w, "start of range must not be after its end", http.StatusBadRequest)
+		return
+	case from.AddDate(0, 0, MaxDistanceDays).Before(to):
+		http.Error(w, fmt.Sprintf("range cannot contain more than %d dates", MaxDistanceDays), http.StatusBadRequest)
+		return
+	}
+
+	days, err := h.location.DailyDistance(r.Context(), vehicle, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	distances := DailyDistances{Unit: prefs.For(units.Kilometres), Days: days}
+	for i, day := range distances.Days {
+		if distances.Days[i].Distance, err = units.Convert(day.Distance, units.Metres, distances.Unit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(distances); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseLocation parses the IANA time zone given by the "tz" query parameter, defaulting to UTC.
+func parseLocation(query url.Values) (*time.Location, error) {
+	tz := query.Get("tz")
+	switch tz {
+	case "":
+		return time.UTC, nil
+	case "Local":
+		// This is the time zone of the server rather than an IANA time zone, so the same request would return
+		// different results depending on where the API is deployed.
+		return nil, fmt.Errorf("unknown time zone %s", tz)
+	default:
+		return time.LoadLocation(tz)
+	}
+}
+
+// parseRange parses the range of time a request is for from its query parameters. The range is given either by the
+// "date" query parameter, as a YYYY-MM-DD formatted date whose boundaries are determined using the IANA time zone given
+// by the "tz" query parameter, or by the "from" and "to" query parameters as RFC 3339 timestamps. When "to" is not
+// given, it defaults to the current time. Ranges longer than the limit are rejected, unless the limit is zero.
+func parseRange(query url.Values, limit time.Duration) (time.Time, time.Time, error) {
+	if date := query.Get("date"); date != "" {
+		location, err := parseLocation(query)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		from, err := time.ParseInLocation("2006-01-02", date, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		return from, from.AddDate(0, 0, 1), nil
+	}
+
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	switch {
+	case !from.Before(to):
+		return time.Time{}, time.Time{}, errors.New("start of range must be before its end")
+	case limit > 0 && to.Sub(from) > limit:
+		return time.Time{}, time.Time{}, fmt.Errorf("range cannot be longer than %s", limit)
+	default:
+		return from, to, nil
+	}
+}
+
 // Register the HTTP routes into the given router.
 func (h *HTTP) Register(router *mux.Router) {
-	router.HandleFunc("/location/latest", h.Latest).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/location/latest", h.Latest).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/location/track", h.Track).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/location/export/{format}", h.Export).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/location/distance", h.Distance).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/location/distance/daily", h.DailyDistance).Methods(http.MethodGet)
 }
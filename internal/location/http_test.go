@@ -3,11 +3,14 @@ package location_test
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/cloud-lada/backend/internal/location"
+	"github.com/cloud-lada/backend/pkg/units"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,9 +31,16 @@ func TestHTTP_Latest(t *testing.T) {
 			Expected: location.Location{
 				Longitude: 50,
 				Latitude:  51,
+				Timestamp: time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC),
 			},
 			ExpectedCode: http.StatusOK,
 		},
+		{
+			Name:         "It should return a 404 if the vehicle has no location",
+			Error:        location.ErrNoLocation,
+			ExpectsError: true,
+			ExpectedCode: http.StatusNotFound,
+		},
 		{
 			Name:         "It should return return errors from the repository",
 			Error:        io.EOF,
@@ -42,13 +52,13 @@ func TestHTTP_Latest(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			repo := &MockRepository{location: tc.Expected, err: tc.Error}
-			api := location.NewHTTP(repo)
+			api := location.NewHTTP(repo, log.New(io.Discard, "", 0))
 
 			router := mux.NewRouter()
 			api.Register(router)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/location/latest", nil)
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/location/latest", nil)
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
@@ -62,3 +72,413 @@ func TestHTTP_Latest(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTP_Track(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	track := []location.Location{
+		{Latitude: 51, Longitude: 50, Timestamp: now},
+		{Latitude: 51.0001, Longitude: 50.01, Timestamp: now.Add(time.Second)},
+		{Latitude: 51, Longitude: 50.02, Timestamp: now.Add(time.Second * 2)},
+	}
+
+	tt := []struct {
+		Name                string
+		Query               string
+		Track               []location.Location
+		Error               error
+		ExpectedCode        int
+		ExpectedCoordinates [][]float64
+	}{
+		{
+			Name:         "It should return the track as GeoJSON",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z",
+			Track:        track,
+			ExpectedCode: http.StatusOK,
+			ExpectedCoordinates: [][]float64{
+				{50, 51},
+				{50.01, 51.0001},
+				{50.02, 51},
+			},
+		},
+		{
+			Name:         "It should simplify the track",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z&tolerance=100",
+			Track:        track,
+			ExpectedCode: http.StatusOK,
+			ExpectedCoordinates: [][]float64{
+				{50, 51},
+				{50.02, 51},
+			},
+		},
+		{
+			Name:         "It should return the track for a date",
+			Query:        "?date=2022-04-23&tz=Europe/Moscow",
+			Track:        track,
+			ExpectedCode: http.StatusOK,
+			ExpectedCoordinates: [][]float64{
+				{50, 51},
+				{50.01, 51.0001},
+				{50.02, 51},
+			},
+		},
+		{
+			Name:         "It should return no features for a track of a single point",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z",
+			Track:        track[:1],
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return no features for an empty track",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z",
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return an error for an unknown time zone",
+			Query:        "?date=2022-04-23&tz=Mars/Olympus_Mons",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for a missing start time",
+			Query:        "?to=2022-04-24T00:00:00Z",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for an inverted range",
+			Query:        "?from=2022-04-24T00:00:00Z&to=2022-04-23T00:00:00Z",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for a range that is too long",
+			Query:        "?from=2022-01-01T00:00:00Z&to=2022-04-24T00:00:00Z",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for a negative tolerance",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z&tolerance=-1",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return errors from the repository",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z",
+			Error:        io.EOF,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{track: tc.Track, err: tc.Error}
+			api := location.NewHTTP(repo, log.New(io.Discard, "", 0))
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/location/track"+tc.Query, nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectedCode != http.StatusOK {
+				return
+			}
+
+			assert.EqualValues(t, "application/geo+json", w.Header().Get("Content-Type"))
+
+			var actual location.FeatureCollection
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, "FeatureCollection", actual.Type)
+			if len(tc.ExpectedCoordinates) == 0 {
+				assert.NotNil(t, actual.Features)
+				assert.Empty(t, actual.Features)
+				return
+			}
+
+			require.Len(t, actual.Features, 1)
+
+			feature := actual.Features[0]
+			assert.EqualValues(t, "LineString", feature.Geometry.Type)
+			assert.EqualValues(t, tc.ExpectedCoordinates, feature.Geometry.Coordinates)
+			assert.EqualValues(t, "lada", feature.Properties["vehicle"])
+			assert.Len(t, feature.Properties["coordTimes"], len(tc.ExpectedCoordinates))
+		})
+	}
+}
+
+func TestHTTP_Export(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	points := []location.TrackPoint{
+		{Location: location.Location{Latitude: 51, Longitude: 50, Timestamp: now}},
+		{Location: location.Location{Latitude: 51.1, Longitude: 50.1, Timestamp: now.Add(time.Second)}},
+	}
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name                string
+		Path                string
+		Error               error
+		ExpectsAbort        bool
+		ExpectedCode        int
+		ExpectedContentType string
+		ExpectedFilename    string
+		ExpectedFrom        time.Time
+		ExpectedTo          time.Time
+		Expected            string
+	}{
+		{
+			Name:                "It should export the track as GPX",
+			Path:                "/vehicles/lada/location/export/gpx?from=2022-04-23T00:00:00Z&to=2022-04-24T00:00:00Z",
+			ExpectedCode:        http.StatusOK,
+			ExpectedContentType: "application/gpx+xml",
+			ExpectedFilename:    `attachment; filename="lada-2022-04-23.gpx"`,
+			ExpectedFrom:        time.Date(2022, 4, 23, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:          time.Date(2022, 4, 24, 0, 0, 0, 0, time.UTC),
+			Expected:            `<trkpt lat="51.1" lon="50.1">`,
+		},
+		{
+			Name:                "It should export the track for a date as KML",
+			Path:                "/vehicles/lada/location/export/kml?date=2022-04-23&tz=Europe/Moscow",
+			ExpectedCode:        http.StatusOK,
+			ExpectedContentType: "application/vnd.google-earth.kml+xml",
+			ExpectedFilename:    `attachment; filename="lada-2022-04-23.kml"`,
+			ExpectedFrom:        time.Date(2022, 4, 23, 0, 0, 0, 0, moscow),
+			ExpectedTo:          time.Date(2022, 4, 24, 0, 0, 0, 0, moscow),
+			Expected:            "<gx:coord>50.1 51.1 0</gx:coord>",
+		},
+		{
+			Name:         "It should abort the response for errors from the repository",
+			Path:         "/vehicles/lada/location/export/gpx?date=2022-04-23",
+			Error:        io.EOF,
+			ExpectsAbort: true,
+		},
+		{
+			Name:         "It should return a 404 for unknown formats",
+			Path:         "/vehicles/lada/location/export/shp?date=2022-04-23",
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:         "It should return an error for an invalid range",
+			Path:         "/vehicles/lada/location/export/gpx?date=23-04-2022",
+			ExpectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{points: points, err: tc.Error}
+			api := location.NewHTTP(repo, log.New(io.Discard, "", 0))
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+
+			if tc.ExpectsAbort {
+				assert.PanicsWithValue(t, http.ErrAbortHandler, func() { router.ServeHTTP(w, r) })
+				return
+			}
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectedCode != http.StatusOK {
+				return
+			}
+
+			assert.EqualValues(t, tc.ExpectedContentType, w.Header().Get("Content-Type"))
+			assert.EqualValues(t, tc.ExpectedFilename, w.Header().Get("Content-Disposition"))
+			assert.True(t, tc.ExpectedFrom.Equal(repo.from))
+			assert.True(t, tc.ExpectedTo.Equal(repo.to))
+			assert.Contains(t, w.Body.String(), tc.Expected)
+		})
+	}
+}
+
+func TestHTTP_Distance(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Query        string
+		Distance     float64
+		Error        error
+		ExpectedCode int
+		Expected     location.Distance
+		ExpectedFrom time.Time
+		ExpectedTo   time.Time
+	}{
+		{
+			Name:         "It should return the total distance",
+			Distance:     12500,
+			ExpectedCode: http.StatusOK,
+			Expected:     location.Distance{Distance: 12.5, Unit: units.Kilometres},
+		},
+		{
+			Name:         "It should return the distance within a range",
+			Query:        "?from=2022-04-23T00:00:00Z&to=2022-05-23T00:00:00Z",
+			Distance:     12500,
+			ExpectedCode: http.StatusOK,
+			Expected:     location.Distance{Distance: 12.5, Unit: units.Kilometres},
+			ExpectedFrom: time.Date(2022, 4, 23, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 5, 23, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "It should return the distance on a date",
+			Query:        "?date=2022-04-23",
+			Distance:     12500,
+			ExpectedCode: http.StatusOK,
+			Expected:     location.Distance{Distance: 12.5, Unit: units.Kilometres},
+			ExpectedFrom: time.Date(2022, 4, 23, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 4, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "It should convert the distance",
+			Query:        "?units=imperial",
+			Distance:     1609.344,
+			ExpectedCode: http.StatusOK,
+			Expected:     location.Distance{Distance: 1, Unit: units.Miles},
+		},
+		{
+			Name:         "It should return an error for unknown units",
+			Query:        "?units=furlongs",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for an invalid range",
+			Query:        "?from=yesterday",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return errors from the repository",
+			Error:        io.EOF,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{distance: tc.Distance, err: tc.Error}
+			api := location.NewHTTP(repo, log.New(io.Discard, "", 0))
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/location/distance"+tc.Query, nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectedCode != http.StatusOK {
+				return
+			}
+
+			assert.True(t, tc.ExpectedFrom.Equal(repo.from))
+			assert.True(t, tc.ExpectedTo.Equal(repo.to))
+
+			var actual location.Distance
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, tc.Expected.Unit, actual.Unit)
+			assert.InDelta(t, tc.Expected.Distance, actual.Distance, 0.000001)
+		})
+	}
+}
+
+func TestHTTP_DailyDistance(t *testing.T) {
+	t.Parallel()
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	days := []location.DailyDistance{
+		{Date: "2022-04-23", Distance: 1500},
+		{Date: "2022-04-24", Distance: 0},
+	}
+
+	tt := []struct {
+		Name         string
+		Query        string
+		Error        error
+		ExpectedCode int
+		Expected     location.DailyDistances
+		ExpectedFrom time.Time
+		ExpectedTo   time.Time
+	}{
+		{
+			Name:         "It should return the distance on each date",
+			Query:        "?from=2022-04-23&to=2022-04-24&tz=Europe/Moscow",
+			ExpectedCode: http.StatusOK,
+			Expected: location.DailyDistances{
+				Unit: units.Kilometres,
+				Days: []location.DailyDistance{
+					{Date: "2022-04-23", Distance: 1.5},
+					{Date: "2022-04-24", Distance: 0},
+				},
+			},
+			ExpectedFrom: time.Date(2022, 4, 23, 0, 0, 0, 0, moscow),
+			ExpectedTo:   time.Date(2022, 4, 25, 0, 0, 0, 0, moscow),
+		},
+		{
+			Name:         "It should return an error for a missing start date",
+			Query:        "?to=2022-04-24",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for an inverted range",
+			Query:        "?from=2022-04-24&to=2022-04-23",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for too many dates",
+			Query:        "?from=2020-01-01&to=2022-04-23",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for an unknown time zone",
+			Query:        "?from=2022-04-23&tz=Mars/Olympus_Mons",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return an error for the local time zone",
+			Query:        "?from=2022-04-23&tz=Local",
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return errors from the repository",
+			Query:        "?from=2022-04-23&to=2022-04-24",
+			Error:        io.EOF,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// Copy the days, as the handler converts their distances in place.
+			repo := &MockRepository{days: append([]location.DailyDistance{}, days...), err: tc.Error}
+			api := location.NewHTTP(repo, log.New(io.Discard, "", 0))
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/location/distance/daily"+tc.Query, nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectedCode != http.StatusOK {
+				return
+			}
+
+			assert.True(t, tc.ExpectedFrom.Equal(repo.from))
+			assert.True(t, tc.ExpectedTo.Equal(repo.to))
+
+			var actual location.DailyDistances
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
@@ -1,10 +1,125 @@
 // Package location provides the full application stack for location data. Including transport & querying.
 package location
 
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/units"
+)
+
 type (
-	// The Location type describes a point on the globe as a latitude and longitude.
+	// The Location type describes a point on the globe as a latitude and longitude, along with the time the vehicle
+	// was there. A Location is only produced from a latitude and longitude recorded at the same time, or within the
+	// tolerance of a Repository, in which case the Timestamp is that of the later reading.
 	Location struct {
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
+		Latitude  float64   `json:"latitude"`
+		Longitude float64   `json:"longitude"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+
+	// The Distance type describes how far a vehicle has travelled, in the given Unit.
+	Distance struct {
+		Distance float64    `json:"distance"`
+		Unit     units.Unit `json:"unit"`
+	}
+
+	// The DailyDistance type describes how far a vehicle travelled on a single date, formatted as YYYY-MM-DD.
+	DailyDistance struct {
+		Date     string  `json:"date"`
+		Distance float64 `json:"distance"`
+	}
+
+	// The DailyDistances type describes how far a vehicle travelled on each of a range of dates, in the given Unit.
+	DailyDistances struct {
+		Unit units.Unit      `json:"unit"`
+		Days []DailyDistance `json:"days"`
 	}
 )
+
+// ErrNoLocation is the error returned when a vehicle has no paired latitude and longitude readings.
+var ErrNoLocation = errors.New("no location")
+
+// The mean radius of the Earth in metres.
+const earthRadius = 6371008.8
+
+// Simplify the track formed by the locations using the Douglas-Peucker algorithm. Points are removed when they are
+// within the tolerance, in metres, of the line between the points either side of them. The first and last points are
+// always kept. A tolerance of zero or less returns the points unmodified.
+func Simplify(points []Location, tolerance float64) []Location {
+	if tolerance <= 0 || len(points) < 3 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	// Segments are processed using a stack rather than recursion, tracks can contain a large number of points.
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		segment := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		first, last := segment[0], segment[1]
+		index, furthest := -1, 0.0
+		for i := first + 1; i < last; i++ {
+			distance := distanceToSegment(points[i], points[first], points[last])
+			if distance > furthest {
+				index, furthest = i, distance
+			}
+		}
+
+		if index == -1 || furthest <= tolerance {
+			continue
+		}
+
+		keep[index] = true
+		stack = append(stack, [2]int{first, index}, [2]int{index, last})
+	}
+
+	out := make([]Location, 0)
+	for i, point := range points {
+		if keep[i] {
+			out = append(out, point)
+		}
+	}
+
+	return out
+}
+
+// distanceToSegment returns the distance, in metres, between the point and the closest point on the line segment
+// between start and end. Locations are projected onto a plane centred on the start of the segment, which is accurate
+// enough for the short segments between readings.
+func distanceToSegment(point, start, end Location) float64 {
+	project := func(l Location) (float64, float64) {
+		x := radians(l.Longitude-start.Longitude) * math.Cos(radians(start.Latitude)) * earthRadius
+		y := radians(l.Latitude-start.Latitude) * earthRadius
+		return x, y
+	}
+
+	px, py := project(point)
+	ex, ey := project(end)
+
+	length := ex*ex + ey*ey
+	if length == 0 {
+		return math.Hypot(px, py)
+	}
+
+	// Find how far along the segment the closest point is, clamped to the ends of the segment.
+	t := math.Max(0, math.Min(1, (px*ex+py*ey)/length))
+	return math.Hypot(px-t*ex, py-t*ey)
+}
+
+// haversine returns the great-circle distance, in metres, between two locations.
+func haversine(a, b Location) float64 {
+	h := math.Pow(math.Sin(radians(b.Latitude-a.Latitude)/2), 2) +
+		math.Cos(radians(a.Latitude))*math.Cos(radians(b.Latitude))*math.Pow(math.Sin(radians(b.Longitude-a.Longitude)/2), 2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,78 @@
+package location_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/location"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	point := func(latitude, longitude float64, i int) location.Location {
+		return location.Location{
+			Latitude:  latitude,
+			Longitude: longitude,
+			Timestamp: now.Add(time.Second * time.Duration(i)),
+		}
+	}
+
+	// A track heading east along the equator, with a small deviation of roughly 11 metres at the second point and
+	// a large deviation of roughly 1.1 kilometres at the fourth.
+	track := []location.Location{
+		point(0, 0, 0),
+		point(0.0001, 0.01, 1),
+		point(0, 0.02, 2),
+		point(0.01, 0.03, 3),
+		point(0, 0.04, 4),
+		point(0, 0.05, 5),
+	}
+
+	tt := []struct {
+		Name      string
+		Points    []location.Location
+		Tolerance float64
+		Expected  []location.Location
+	}{
+		{
+			Name:      "It should not simplify with a tolerance of zero",
+			Points:    track,
+			Tolerance: 0,
+			Expected:  track,
+		},
+		{
+			Name:      "It should remove points within the tolerance",
+			Points:    track,
+			Tolerance: 50,
+			Expected:  []location.Location{track[0], track[2], track[3], track[4], track[5]},
+		},
+		{
+			Name:      "It should keep only the end points with a large tolerance",
+			Points:    track,
+			Tolerance: 5000,
+			Expected:  []location.Location{track[0], track[5]},
+		},
+		{
+			Name:      "It should keep every point with a small tolerance",
+			Points:    track,
+			Tolerance: 1,
+			Expected:  []location.Location{track[0], track[1], track[2], track[3], track[4], track[5]},
+		},
+		{
+			Name:      "It should handle tracks too short to simplify",
+			Points:    track[:2],
+			Tolerance: 5000,
+			Expected:  track[:2],
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := location.Simplify(tc.Points, tc.Tolerance)
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package location_test
 
 import (
 	"context"
+	"time"
 
 	"github.com/cloud-lada/backend/internal/location"
 )
@@ -9,10 +10,44 @@ import (
 type (
 	MockRepository struct {
 		location location.Location
+		track    []location.Location
+		points   []location.TrackPoint
+		distance float64
+		days     []location.DailyDistance
+		from     time.Time
+		to       time.Time
 		err      error
 	}
 )
 
-func (m *MockRepository) Latest(ctx context.Context) (location.Location, error) {
+func (m *MockRepository) Latest(ctx context.Context, vehicle string) (location.Location, error) {
 	return m.location, m.err
 }
+
+func (m *MockRepository) Track(ctx context.Context, vehicle string, from, to time.Time) ([]location.Location, error) {
+	return m.track, m.err
+}
+
+func (m *MockRepository) ForEachTrackPoint(ctx context.Context, vehicle string, from, to time.Time, fn location.ForEachFunc) error {
+	m.from = from
+	m.to = to
+	for _, point := range m.points {
+		if err := fn(ctx, point); err != nil {
+			return err
+		}
+	}
+
+	return m.err
+}
+
+func (m *MockRepository) Distance(ctx context.Context, vehicle string, from, to time.Time) (float64, error) {
+	m.from = from
+	m.to = to
+	return m.distance, m.err
+}
+
+func (m *MockRepository) DailyDistance(ctx context.Context, vehicle string, from, to time.Time) ([]location.DailyDistance, error) {
+	m.from = from
+	m.to = to
+	return m.days, m.err
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync"
+	"time"
 
+	"github.com/cloud-lada/backend/pkg/closers"
 	"github.com/cloud-lada/backend/pkg/postgres"
 )
 
@@ -12,74 +15,355 @@ type (
 	// The PostgresRepository is a Repository implementation that queries location data from a postgres-compatible
 	// database.
 	PostgresRepository struct {
-		db *sql.DB
+		db        *sql.DB
+		tolerance time.Duration
+
+		mu        sync.Mutex
+		odometers map[string]odometer
+	}
+
+	// The odometer type caches the distance a vehicle travelled before a point in time, so that its total distance can
+	// be found without measuring every segment of its history.
+	odometer struct {
+		distance float64
+		until    time.Time
+		expires  time.Time
 	}
 )
 
 // NewPostgresRepository returns a new instance of the PostgresRepository type that will perform queries against
-// the provided sql.DB instance.
-func NewPostgresRepository(db *sql.DB) *PostgresRepository {
-	return &PostgresRepository{db: db}
+// the provided sql.DB instance. Latitude and longitude readings are paired into a Location when their timestamps are
+// within the tolerance of each other.
+func NewPostgresRepository(db *sql.DB, tolerance time.Duration) *PostgresRepository {
+	return &PostgresRepository{
+		db:        db,
+		tolerance: tolerance,
+		odometers: make(map[string]odometer),
+	}
 }
 
-// Latest returns the most recent location data stored within the database.
-func (r *PostgresRepository) Latest(ctx context.Context) (Location, error) {
+// This query pairs each latitude reading with the longitude reading closest to it in time, as long as it is within
+// the tolerance. Latitudes without a longitude close enough to them are excluded, so a Location is never made up of
+// readings taken at different points of a journey. Pairing is one-to-one, a longitude is only paired with the latitude
+// closest to it in time (the earliest, if several are equally close). The timestamp of each pair is that of its later
+// reading.
+const pairedQuery = `
+	SELECT
+		latitude.value AS latitude,
+		longitude.value AS longitude,
+		GREATEST(latitude.timestamp, longitude.timestamp) AS timestamp
+	FROM reading AS latitude
+	JOIN LATERAL (
+		SELECT candidate.value, candidate.timestamp FROM reading AS candidate
+		WHERE
+			candidate.vehicle = latitude.vehicle
+			AND candidate.sensor = 'location_longitude'
+			AND candidate.timestamp >= latitude.timestamp - make_interval(secs => $2)
+			AND candidate.timestamp <= latitude.timestamp + make_interval(secs => $2)
+		ORDER BY ABS(EXTRACT(EPOCH FROM candidate.timestamp - latitude.timestamp)) ASC, candidate.timestamp ASC
+		FETCH FIRST ROW ONLY
+	) AS longitude ON TRUE
+	WHERE
+		latitude.vehicle = $1
+		AND latitude.sensor = 'location_latitude'
+		AND NOT EXISTS (
+			SELECT 1 FROM reading AS other
+			WHERE
+				other.vehicle = latitude.vehicle
+				AND other.sensor = 'location_latitude'
+				AND other.timestamp >= longitude.timestamp - make_interval(secs => $2)
+				AND other.timestamp <= longitude.timestamp + make_interval(secs => $2)
+				AND (
+					ABS(EXTRACT(EPOCH FROM other.timestamp - longitude.timestamp)) <
+						ABS(EXTRACT(EPOCH FROM latitude.timestamp - longitude.timestamp))
+					OR (
+						ABS(EXTRACT(EPOCH FROM other.timestamp - longitude.timestamp)) =
+							ABS(EXTRACT(EPOCH FROM latitude.timestamp - longitude.timestamp))
+						AND other.timestamp < latitude.timestamp
+					)
+				)
+		)
+`
+
+// Latest returns the most recent Location for a vehicle stored within the database. Returns ErrNoLocation if the
+// vehicle has no paired latitude and longitude readings.
+func (r *PostgresRepository) Latest(ctx context.Context, vehicle string) (Location, error) {
 	var location Location
-	var err error
+	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		// As pairing is one-to-one, the most recent latitude also has the most recent pair timestamp. Ordering by
+		// the latitude allows the query to stop at the first pair rather than pairing every reading.
+		q := pairedQuery + `
+			ORDER BY latitude.timestamp DESC
+			FETCH FIRST ROW ONLY
+		`
+
+		row := tx.QueryRowContext(ctx, q, vehicle, r.tolerance.Seconds())
+		err := row.Scan(&location.Latitude, &location.Longitude, &location.Timestamp)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoLocation
+		default:
+			return err
+		}
+	})
 
-	err = postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
-		location.Latitude, err = r.latestLatitude(ctx, tx)
+	return location, err
+}
+
+// Track returns the Location of a vehicle at each time a latitude and longitude were recorded within a range,
+// ordered by time. The range includes the start time and excludes the end time.
+func (r *PostgresRepository) Track(ctx context.Context, vehicle string, from, to time.Time) ([]Location, error) {
+	out := make([]Location, 0)
+	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		q := pairedQuery + `
+			AND latitude.timestamp >= $3
+			AND latitude.timestamp < $4
+			ORDER BY timestamp ASC
+		`
+
+		rows, err := tx.QueryContext(ctx, q, vehicle, r.tolerance.Seconds(), from, to)
 		if err != nil {
 			return err
 		}
+		defer closers.Close(rows)
 
-		location.Longitude, err = r.latestLongitude(ctx, tx)
-		return err
+		for rows.Next() {
+			var location Location
+			if err = rows.Scan(&location.Latitude, &location.Longitude, &location.Timestamp); err != nil {
+				return err
+			}
+
+			out = append(out, location)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		return rows.Close()
 	})
 
-	return location, err
+	return out, err
+}
+
+// ForEachTrackPoint iterates through the TrackPoint of a vehicle at each time a latitude and longitude were recorded
+// within a range, ordered by time. Each Location is paired with the speed reading closest to it in time, as long as it
+// is within the tolerance. The range includes the start time and excludes the end time. For each TrackPoint, the
+// ForEachFunc is invoked. Iteration will stop when there are no more points, the context is cancelled or the
+// ForEachFunc returns an error.
+func (r *PostgresRepository) ForEachTrackPoint(ctx context.Context, vehicle string, from, to time.Time, fn ForEachFunc) error {
+	return postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		q := `
+			SELECT paired.latitude, paired.longitude, paired.timestamp, speed.value
+			FROM (` + pairedQuery + `
+				AND latitude.timestamp >= $3
+				AND latitude.timestamp < $4
+			) AS paired
+			LEFT JOIN LATERAL (
+				SELECT value FROM reading
+				WHERE
+					vehicle = $1
+					AND sensor = 'speed'
+					AND timestamp >= paired.timestamp - make_interval(secs => $2)
+					AND timestamp <= paired.timestamp + make_interval(secs => $2)
+				ORDER BY ABS(EXTRACT(EPOCH FROM timestamp - paired.timestamp)) ASC
+				FETCH FIRST ROW ONLY
+			) AS speed ON TRUE
+			ORDER BY paired.timestamp ASC
+		`
+
+		rows, err := tx.QueryContext(ctx, q, vehicle, r.tolerance.Seconds(), from, to)
+		if err != nil {
+			return err
+		}
+		defer closers.Close(rows)
+
+		for rows.Next() {
+			var point TrackPoint
+			var speed sql.NullFloat64
+			if err = rows.Scan(&point.Latitude, &point.Longitude, &point.Timestamp, &speed); err != nil {
+				return err
+			}
+
+			if speed.Valid {
+				point.Speed = &speed.Float64
+			}
+
+			if err = fn(ctx, point); err != nil {
+				return err
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		return rows.Close()
+	})
 }
 
-func (r *PostgresRepository) latestLatitude(ctx context.Context, tx *sql.Tx) (float64, error) {
-	const q = `
-		SELECT value FROM reading
-		WHERE sensor = 'location_latitude'
-		ORDER BY timestamp DESC
+// The minimum distance, in metres, from the last position at which the vehicle moved for it to be considered moving
+// again. Smaller movements are treated as noise from the GPS receiver rather than distance travelled.
+const minSegmentDistance = 10
+
+// This query returns each position of a vehicle within a range, ordered by time. Positions are taken from the
+// location_bucket continuous aggregate, which contains the position of each vehicle at the end of every 10 second
+// interval. Intervals where the latitude and longitude were not recorded within the tolerance of each other are
+// ignored. The last position before the range is included so that the movement into the range is counted. A NULL start
+// or end leaves that end of the range unbounded. The positions are not materialized, so that the range is applied when
+// querying the location_bucket view rather than to every position.
+const positionQuery = `
+	WITH positions AS NOT MATERIALIZED (
+		SELECT bucket, latitude, longitude FROM location_bucket
+		WHERE
+			vehicle = $1
+			AND latitude IS NOT NULL
+			AND longitude IS NOT NULL
+			AND latitude_timestamp >= longitude_timestamp - make_interval(secs => $2)
+			AND latitude_timestamp <= longitude_timestamp + make_interval(secs => $2)
+	)
+	(
+		SELECT * FROM positions
+		WHERE $3::TIMESTAMPTZ IS NOT NULL AND bucket < $3
+		ORDER BY bucket DESC
 		FETCH FIRST ROW ONLY
-	`
+	)
+	UNION ALL
+	(
+		SELECT * FROM positions
+		WHERE ($3::TIMESTAMPTZ IS NULL OR bucket >= $3) AND ($4::TIMESTAMPTZ IS NULL OR bucket < $4)
+	)
+	ORDER BY bucket ASC
+`
+
+// forEachSegment invokes fn with the distance, in metres, a vehicle moved at each of its positions within a range. The
+// distance is measured from the last position at which the vehicle moved, rather than the previous position, so noise
+// from the GPS receiver while stationary is ignored without also ignoring slow movement that is split across several
+// positions.
+func (r *PostgresRepository) forEachSegment(ctx context.Context, tx *sql.Tx, vehicle string, from, to time.Time, fn func(bucket time.Time, distance float64)) error {
+	rows, err := tx.QueryContext(ctx, positionQuery, vehicle, r.tolerance.Seconds(), nullTime(from), nullTime(to))
+	if err != nil {
+		return err
+	}
+	defer closers.Close(rows)
 
-	var value float64
-	row := tx.QueryRowContext(ctx, q)
+	var last Location
+	var moved bool
+	for rows.Next() {
+		var position Location
+		if err = rows.Scan(&position.Timestamp, &position.Latitude, &position.Longitude); err != nil {
+			return err
+		}
 
-	err := row.Scan(&value)
-	switch {
-	case errors.Is(err, sql.ErrNoRows):
-		return 0, nil
-	case err != nil:
-		return 0, err
-	default:
-		return value, nil
+		if !moved {
+			last, moved = position, true
+			continue
+		}
+
+		distance := haversine(last, position)
+		if distance < minSegmentDistance {
+			continue
+		}
+
+		fn(position.Timestamp, distance)
+		last = position
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
 	}
+
+	return rows.Close()
 }
 
-func (r *PostgresRepository) latestLongitude(ctx context.Context, tx *sql.Tx) (float64, error) {
-	const q = `
-		SELECT value FROM reading
-		WHERE sensor = 'location_longitude'
-		ORDER BY timestamp DESC
-		FETCH FIRST ROW ONLY
-	`
+// How long the distance travelled before the odometer's cutoff is cached for. Readings can be uploaded long after they
+// were recorded, so the cache must expire for them to be included in a vehicle's total distance.
+const odometerCacheDuration = time.Minute * 15
+
+// How long before the time the odometer is cached that its cutoff is. Distance travelled after the cutoff is always
+// measured, so that readings uploaded shortly after they were recorded are included immediately.
+const odometerCutoff = time.Hour
+
+// Distance returns the distance, in metres, a vehicle travelled within a range. The range includes the start time and
+// excludes the end time. A zero start or end time leaves that end of the range unbounded, so passing two zero times
+// returns the total distance the vehicle has travelled. The total distance travelled up to an hour before it was
+// measured is cached for 15 minutes, so readings uploaded more than an hour after they were recorded may take up to 15
+// minutes to be included in it.
+func (r *PostgresRepository) Distance(ctx context.Context, vehicle string, from, to time.Time) (float64, error) {
+	if !from.IsZero() || !to.IsZero() {
+		return r.distance(ctx, vehicle, from, to)
+	}
+
+	now := time.Now()
+
+	r.mu.Lock()
+	cached, ok := r.odometers[vehicle]
+	r.mu.Unlock()
+
+	if !ok || now.After(cached.expires) {
+		until := now.Add(-odometerCutoff)
+		distance, err := r.distance(ctx, vehicle, time.Time{}, until)
+		if err != nil {
+			return 0, err
+		}
+
+		cached = odometer{distance: distance, until: until, expires: now.Add(odometerCacheDuration)}
 
-	var value float64
-	row := tx.QueryRowContext(ctx, q)
+		r.mu.Lock()
+		r.odometers[vehicle] = cached
+		r.mu.Unlock()
+	}
 
-	err := row.Scan(&value)
-	switch {
-	case errors.Is(err, sql.ErrNoRows):
-		return 0, nil
-	case err != nil:
+	// The position query includes the last position before the cutoff, so movement across it is counted once.
+	recent, err := r.distance(ctx, vehicle, cached.until, time.Time{})
+	if err != nil {
 		return 0, err
-	default:
-		return value, nil
 	}
+
+	return cached.distance + recent, nil
+}
+
+func (r *PostgresRepository) distance(ctx context.Context, vehicle string, from, to time.Time) (float64, error) {
+	var total float64
+	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		return r.forEachSegment(ctx, tx, vehicle, from, to, func(_ time.Time, distance float64) {
+			total += distance
+		})
+	})
+
+	return total, err
+}
+
+// DailyDistance returns the distance, in metres, a vehicle travelled on each date within a range. The boundaries of
+// each date are determined using the location of the start time. Dates on which the vehicle did not move have a
+// distance of zero.
+func (r *PostgresRepository) DailyDistance(ctx context.Context, vehicle string, from, to time.Time) ([]DailyDistance, error) {
+	const dateFormat = "2006-01-02"
+
+	distances := make(map[string]float64)
+	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		return r.forEachSegment(ctx, tx, vehicle, from, to, func(bucket time.Time, distance float64) {
+			distances[bucket.In(from.Location()).Format(dateFormat)] += distance
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DailyDistance, 0)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateFormat)
+		out = append(out, DailyDistance{Date: date, Distance: distances[date]})
+	}
+
+	return out, nil
+}
+
+// nullTime returns nil for a zero time, so that it is passed to a query as NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
 }
@@ -1,6 +1,7 @@
 package location_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -21,19 +22,116 @@ func TestPostgresRepository_Latest(t *testing.T) {
 	db := testutil.Postgres(t, ctx)
 
 	readings := reading.NewPostgresRepository(db)
-	locations := location.NewPostgresRepository(db)
+	locations := location.NewPostgresRepository(db, time.Second)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	t.Run("It should return an error if the vehicle has no location", func(t *testing.T) {
+		_, err := locations.Latest(ctx, "lada")
+		assert.ErrorIs(t, err, location.ErrNoLocation)
+	})
 
 	// Insert readings that we can query
 	seed := []reading.Reading{
 		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     50,
+			Timestamp: now,
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     51,
+			Timestamp: now.Add(time.Millisecond * 200),
+		},
+		{
+			// A more recent latitude without a longitude close enough to it should not be paired.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     60,
+			Timestamp: now.Add(time.Minute),
+		},
+	}
+
+	for _, s := range seed {
+		require.NoError(t, readings.Save(ctx, s))
+	}
+
+	t.Run("It should return the latest paired location", func(t *testing.T) {
+		actual, err := locations.Latest(ctx, "lada")
+		require.NoError(t, err)
+		assert.EqualValues(t, 50, actual.Latitude)
+		assert.EqualValues(t, 51, actual.Longitude)
+		assert.True(t, now.Add(time.Millisecond*200).Equal(actual.Timestamp))
+	})
+}
+
+func TestPostgresRepository_Track(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+
+	readings := reading.NewPostgresRepository(db)
+	locations := location.NewPostgresRepository(db, time.Second)
+
+	from := time.Date(2022, 4, 23, 12, 0, 0, 0, time.UTC)
+	seed := []reading.Reading{
+		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeLocationLatitude,
 			Value:     50,
-			Timestamp: time.Now(),
+			Timestamp: from,
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeLocationLongitude,
 			Value:     51,
-			Timestamp: time.Now(),
+			Timestamp: from,
+		},
+		{
+			// A latitude without a longitude close enough to it should not be included in the track.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     60,
+			Timestamp: from.Add(time.Second * 10),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     50.1,
+			Timestamp: from.Add(time.Second * 20),
+		},
+		{
+			// Readings within the tolerance of each other should be paired.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     51.1,
+			Timestamp: from.Add(time.Second*20 + time.Millisecond*500),
+		},
+		{
+			// A latitude whose closest longitude is closer to another latitude should not be paired with it again.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     50.2,
+			Timestamp: from.Add(time.Second*21 + time.Millisecond*200),
+		},
+		{
+			// Readings outside of the range should not be included in the track.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     70,
+			Timestamp: from.Add(time.Hour),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     71,
+			Timestamp: from.Add(time.Hour),
 		},
 	}
 
@@ -41,14 +139,206 @@ func TestPostgresRepository_Latest(t *testing.T) {
 		require.NoError(t, readings.Save(ctx, s))
 	}
 
-	t.Run("It should return the latest location", func(t *testing.T) {
-		expected := location.Location{
-			Longitude: 51,
-			Latitude:  50,
+	t.Run("It should return paired locations within the range", func(t *testing.T) {
+		actual, err := locations.Track(ctx, "lada", from, from.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+
+		assert.EqualValues(t, 50, actual[0].Latitude)
+		assert.EqualValues(t, 51, actual[0].Longitude)
+		assert.True(t, from.Equal(actual[0].Timestamp))
+
+		assert.EqualValues(t, 50.1, actual[1].Latitude)
+		assert.EqualValues(t, 51.1, actual[1].Longitude)
+		assert.True(t, from.Add(time.Second*20+time.Millisecond*500).Equal(actual[1].Timestamp))
+	})
+}
+
+func TestPostgresRepository_ForEachTrackPoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+
+	readings := reading.NewPostgresRepository(db)
+	locations := location.NewPostgresRepository(db, time.Second)
+
+	from := time.Date(2022, 4, 24, 12, 0, 0, 0, time.UTC)
+	seed := []reading.Reading{
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     50,
+			Timestamp: from,
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     51,
+			Timestamp: from,
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     80,
+			Timestamp: from.Add(time.Millisecond * 100),
+		},
+		{
+			// A location without a speed close enough to it should have no speed.
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     50.1,
+			Timestamp: from.Add(time.Minute),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     51.1,
+			Timestamp: from.Add(time.Minute),
+		},
+	}
+
+	for _, s := range seed {
+		require.NoError(t, readings.Save(ctx, s))
+	}
+
+	t.Run("It should iterate over paired locations with their speed", func(t *testing.T) {
+		var actual []location.TrackPoint
+		err := locations.ForEachTrackPoint(ctx, "lada", from, from.Add(time.Hour), func(ctx context.Context, point location.TrackPoint) error {
+			actual = append(actual, point)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+
+		assert.EqualValues(t, 50, actual[0].Latitude)
+		assert.EqualValues(t, 51, actual[0].Longitude)
+		require.NotNil(t, actual[0].Speed)
+		assert.EqualValues(t, 80, *actual[0].Speed)
+
+		assert.EqualValues(t, 50.1, actual[1].Latitude)
+		assert.Nil(t, actual[1].Speed)
+	})
+}
+
+func TestPostgresRepository_Distance(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+
+	readings := reading.NewPostgresRepository(db)
+	locations := location.NewPostgresRepository(db, time.Second)
+
+	// Drive east along the equator, moving a hundredth of a degree, roughly 1113 metres, each minute. The last
+	// position is recorded just after midnight.
+	from := time.Date(2022, 4, 25, 23, 57, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		timestamp := from.Add(time.Minute * time.Duration(i))
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "odometer",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     0,
+			Timestamp: timestamp,
+		}))
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "odometer",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     float64(i) / 100,
+			Timestamp: timestamp,
+		}))
+	}
+
+	const segment = 1111.95
+
+	t.Run("It should return the total distance", func(t *testing.T) {
+		actual, err := locations.Distance(ctx, "odometer", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.InDelta(t, segment*3, actual, 1)
+	})
+
+	t.Run("It should include the movement into the range", func(t *testing.T) {
+		actual, err := locations.Distance(ctx, "odometer", from.Add(time.Minute), from.Add(time.Minute*2))
+		require.NoError(t, err)
+		assert.InDelta(t, segment, actual, 1)
+	})
+
+	t.Run("It should return the distance on each date", func(t *testing.T) {
+		day := time.Date(2022, 4, 25, 0, 0, 0, 0, time.UTC)
+		actual, err := locations.DailyDistance(ctx, "odometer", day, day.AddDate(0, 0, 3))
+		require.NoError(t, err)
+		require.Len(t, actual, 3)
+
+		assert.EqualValues(t, "2022-04-25", actual[0].Date)
+		assert.InDelta(t, segment*2, actual[0].Distance, 1)
+		assert.EqualValues(t, "2022-04-26", actual[1].Date)
+		assert.InDelta(t, segment, actual[1].Distance, 1)
+		assert.EqualValues(t, "2022-04-27", actual[2].Date)
+		assert.Zero(t, actual[2].Distance)
+	})
+
+	t.Run("It should include recent movement in the cached total distance", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "odometer",
+			Sensor:    reading.SensorTypeLocationLatitude,
+			Value:     0,
+			Timestamp: now,
+		}))
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "odometer",
+			Sensor:    reading.SensorTypeLocationLongitude,
+			Value:     0.04,
+			Timestamp: now,
+		}))
+
+		actual, err := locations.Distance(ctx, "odometer", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.InDelta(t, segment*4, actual, 1)
+	})
+
+	// Creep east along the equator, moving half a ten-thousandth of a degree, roughly 5.6 metres, every 10 seconds,
+	// which is too short to count as movement on its own. The next vehicle jitters back and forth by the same amount
+	// without going anywhere.
+	start := time.Date(2022, 4, 20, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= 12; i++ {
+		timestamp := start.Add(time.Second * 10 * time.Duration(i))
+		positions := map[string]float64{
+			"slow":       float64(i) * 0.00005,
+			"stationary": float64(i%2) * 0.00005,
+		}
+
+		for vehicle, longitude := range positions {
+			require.NoError(t, readings.Save(ctx, reading.Reading{
+				Vehicle:   vehicle,
+				Sensor:    reading.SensorTypeLocationLatitude,
+				Value:     0,
+				Timestamp: timestamp,
+			}))
+			require.NoError(t, readings.Save(ctx, reading.Reading{
+				Vehicle:   vehicle,
+				Sensor:    reading.SensorTypeLocationLongitude,
+				Value:     longitude,
+				Timestamp: timestamp,
+			}))
 		}
+	}
+
+	t.Run("It should count slow, steady movement", func(t *testing.T) {
+		actual, err := locations.Distance(ctx, "slow", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.InDelta(t, segment*0.06, actual, 0.1)
+	})
 
-		actual, err := locations.Latest(ctx)
+	t.Run("It should ignore noise while stationary", func(t *testing.T) {
+		actual, err := locations.Distance(ctx, "stationary", start, start.Add(time.Hour))
 		require.NoError(t, err)
-		assert.EqualValues(t, expected, actual)
+		assert.Zero(t, actual)
 	})
 }
@@ -0,0 +1,138 @@
+package reading
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// The decoder interface describes types that can decode individual readings from a stream. Implementations
+	// should return io.EOF once there are no more readings to decode.
+	decoder interface {
+		Decode(reading *Reading) error
+	}
+
+	// The jsonDecoder type is a decoder implementation that reads a stream of JSON-encoded readings.
+	jsonDecoder struct {
+		decoder *json.Decoder
+	}
+
+	// The csvDecoder type is a decoder implementation that reads CSV-encoded readings. Each row is expected to
+	// contain the sensor, value and RFC 3339 timestamp in that order. A header row naming those columns is optional.
+	csvDecoder struct {
+		reader *csv.Reader
+		first  bool
+	}
+)
+
+// Content types supported when ingesting readings.
+const (
+	contentTypeJSONStream = "application/stream+json"
+	contentTypeCSV        = "text/csv"
+)
+
+// The columns of a CSV header row, in order.
+var csvHeader = []string{"sensor", "value", "timestamp"}
+
+// newDecoder returns the decoder implementation for the given content type that will read readings from the
+// io.Reader.
+func newDecoder(contentType string, r io.Reader) decoder {
+	switch contentType {
+	case contentTypeCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = 3
+		reader.TrimLeadingSpace = true
+		reader.ReuseRecord = true
+
+		return &csvDecoder{reader: reader, first: true}
+	default:
+		return &jsonDecoder{decoder: json.NewDecoder(r)}
+	}
+}
+
+// decodeLine decodes a single reading from a line of the given content type. Returns io.EOF if the line contains no
+// reading, such as a blank line or CSV header, or an error if the line contains anything after the reading.
+func decodeLine(contentType string, line []byte, reading *Reading) error {
+	decoder := newDecoder(contentType, bytes.NewReader(line))
+	if err := decoder.Decode(reading); err != nil {
+		return err
+	}
+
+	var extra Reading
+	if err := decoder.Decode(&extra); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected content after reading")
+	}
+
+	return nil
+}
+
+func (d *jsonDecoder) Decode(reading *Reading) error {
+	return d.decoder.Decode(reading)
+}
+
+func (d *csvDecoder) Decode(reading *Reading) error {
+	record, err := d.reader.Read()
+	if err != nil {
+		return err
+	}
+
+	// Most tools that output CSV will include a header row, so we skip the first row if it is one.
+	if d.first {
+		d.first = false
+		if isCSVHeader(record) {
+			return d.Decode(reading)
+		}
+	}
+
+	value, err := strconv.ParseFloat(record[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %w", record[1], err)
+	}
+
+	// ParseFloat accepts values such as "NaN" and "Inf", which can't be represented in JSON so would fail to be
+	// published or echoed back as invalid readings.
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("invalid value %q: value must be a finite number", record[1])
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, record[2])
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", record[2], err)
+	}
+
+	*reading = Reading{
+		Sensor:    SensorType(record[0]),
+		Value:     value,
+		Timestamp: timestamp,
+	}
+
+	return nil
+}
+
+// isCSVHeader returns true if the record names each of the CSV columns. Column names are case-insensitive, and a
+// leading byte order mark, as written by some spreadsheet software, is ignored.
+func isCSVHeader(record []string) bool {
+	if len(record) != len(csvHeader) {
+		return false
+	}
+
+	for i, column := range record {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+
+		if !strings.EqualFold(strings.TrimSpace(column), csvHeader[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+
+	"github.com/cloud-lada/backend/pkg/event"
 )
 
 type (
@@ -17,6 +19,7 @@ type (
 	// The Repository interface describes types that can store readings.
 	Repository interface {
 		Save(ctx context.Context, reading Reading) error
+		SaveBatch(ctx context.Context, readings []Reading) error
 	}
 )
 
@@ -26,18 +29,60 @@ func NewEventHandler(readings Repository, logger *log.Logger) *EventHandler {
 	return &EventHandler{logger: logger, readings: readings}
 }
 
-// HandleEvent handles an inbound JSON payload. It expects the payload to be unmarshallable into a storage.Reading
+// HandleEvent handles an inbound event. It expects the event body to be unmarshallable into a storage.Reading
 // type. Once decoded, the reading is persisted via the Repository implementation.
-func (h *EventHandler) HandleEvent(ctx context.Context, message json.RawMessage) error {
-	var request Reading
-	if err := json.Unmarshal(message, &request); err != nil {
-		return fmt.Errorf("failed to unmarshal reading: %w", err)
+func (h *EventHandler) HandleEvent(ctx context.Context, envelope event.Envelope) error {
+	request, err := decode(envelope)
+	if err != nil {
+		return err
 	}
 
-	if err := h.readings.Save(ctx, request); err != nil {
+	if err = h.readings.Save(ctx, request); err != nil {
 		return fmt.Errorf("failed to store reading: %w", err)
 	}
 
-	h.logger.Println("Persisted reading:", request)
+	h.logger.Println("Persisted reading:", request, "from event", envelope.ID)
+	return nil
+}
+
+// HandleEvents handles a batch of inbound events. It expects each event body to be unmarshallable into a
+// storage.Reading type. Once decoded, all readings are persisted at once via the Repository implementation.
+func (h *EventHandler) HandleEvents(ctx context.Context, envelopes []event.Envelope) error {
+	readings := make([]Reading, len(envelopes))
+	for i, envelope := range envelopes {
+		reading, err := decode(envelope)
+		if err != nil {
+			return err
+		}
+
+		readings[i] = reading
+	}
+
+	if err := h.readings.SaveBatch(ctx, readings); err != nil {
+		return fmt.Errorf("failed to store readings: %w", err)
+	}
+
+	h.logger.Println("Persisted", len(readings), "readings")
 	return nil
 }
+
+func decode(envelope event.Envelope) (Reading, error) {
+	var reading Reading
+
+	switch envelope.Version {
+	case "", "1":
+		// Events published before envelopes were introduced have no version, but they share the schema of the first
+		// version. Neither contain a vehicle, as they were published when only a single vehicle was supported.
+		reading.Vehicle = DefaultVehicle
+	case SchemaVersion:
+		break
+	default:
+		return Reading{}, fmt.Errorf("unsupported schema version %q for event %s", envelope.Version, envelope.ID)
+	}
+
+	if err := json.Unmarshal(envelope.Body, &reading); err != nil {
+		return Reading{}, fmt.Errorf("failed to unmarshal reading: %w", err)
+	}
+
+	return reading, nil
+}
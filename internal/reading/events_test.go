@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/event"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,19 +19,37 @@ func TestEventHandler_HandleEvent(t *testing.T) {
 
 	tt := []struct {
 		Name         string
-		Data         json.RawMessage
+		Data         event.Envelope
 		Error        error
 		ExpectsError bool
 		Expected     reading.Reading
 	}{
 		{
 			Name: "It should store a reading",
-			Data: marshal(t, reading.Reading{
+			Data: event.Envelope{
+				Version: reading.SchemaVersion,
+				Body: marshal(t, reading.Reading{
+					Vehicle:   "support",
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				}),
+			},
+			Expected: reading.Reading{
+				Vehicle:   "support",
 				Sensor:    reading.SensorTypeSpeed,
 				Value:     100,
 				Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
-			}),
+			},
+		},
+		{
+			Name: "It should store a reading from the first schema version against the default vehicle",
+			Data: event.Envelope{
+				Version: "1",
+				Body:    []byte(`{"sensor":"speed","value":100,"timestamp":"2022-01-01T00:00:00Z"}`),
+			},
 			Expected: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
 				Sensor:    reading.SensorTypeSpeed,
 				Value:     100,
 				Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -38,16 +57,31 @@ func TestEventHandler_HandleEvent(t *testing.T) {
 		},
 		{
 			Name:         "It should return an error for an invalid reading",
-			Data:         []byte("this will not unmarshal"),
+			Data:         event.Envelope{Body: []byte("this will not unmarshal")},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error for an unsupported schema version",
+			Data: event.Envelope{
+				Version: "999",
+				Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				}),
+			},
 			ExpectsError: true,
 		},
 		{
 			Name: "It should return repository errors",
-			Data: marshal(t, reading.Reading{
-				Sensor:    reading.SensorTypeSpeed,
-				Value:     100,
-				Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
-			}),
+			Data: event.Envelope{
+				Version: reading.SchemaVersion,
+				Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				}),
+			},
 			Error:        io.EOF,
 			ExpectsError: true,
 		},
@@ -72,6 +106,88 @@ func TestEventHandler_HandleEvent(t *testing.T) {
 	}
 }
 
+func TestEventHandler_HandleEvents(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Data         []event.Envelope
+		Error        error
+		ExpectsError bool
+		Expected     []reading.Reading
+	}{
+		{
+			Name: "It should store a batch of readings",
+			Data: []event.Envelope{
+				{Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				})},
+				{Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeFuel,
+					Value:     50,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				})},
+			},
+			Expected: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Sensor:    reading.SensorTypeFuel,
+					Value:     50,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name: "It should return an error if any reading is invalid",
+			Data: []event.Envelope{
+				{Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				})},
+				{Body: []byte("this will not unmarshal")},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return repository errors",
+			Data: []event.Envelope{
+				{Body: marshal(t, reading.Reading{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     100,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				})},
+			},
+			Error:        io.EOF,
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			readings := &MockRepository{err: tc.Error}
+
+			handler := reading.NewEventHandler(readings, log.New(io.Discard, "", log.Flags()))
+
+			err := handler.HandleEvents(ctx, tc.Data)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.Expected, readings.savedBatch)
+		})
+	}
+}
+
 func marshal(t *testing.T, value interface{}) []byte {
 	t.Helper()
 
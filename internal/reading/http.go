@@ -1,56 +1,157 @@
 package reading
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"time"
 
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
 )
 
 type (
 	// The HTTP type is responsible for handling HTTP requests and publishing events onto an event sink.
 	HTTP struct {
-		writer EventWriter
-		logger *log.Logger
+		writer        EventWriter
+		sessions      SessionRepository
+		jobs          JobRepository
+		blobs         BlobStore
+		sensors       SensorRegistry
+		logger        *log.Logger
+		producer      string
+		batchSize     int
+		batchInterval time.Duration
+	}
+
+	// The HTTPConfig type contains fields used to configure the HTTP type.
+	HTTPConfig struct {
+		// The EventWriter implementation to publish readings to.
+		Events EventWriter
+		// The SessionRepository implementation used to track resumable upload sessions. If nil, the upload session
+		// endpoints are not registered.
+		Sessions SessionRepository
+		// The JobRepository implementation used to track asynchronous ingest jobs. If nil, readings are always
+		// ingested synchronously and the job endpoints are not registered.
+		Jobs JobRepository
+		// The BlobStore implementation used to store request bodies for asynchronous ingest jobs. Required if Jobs
+		// is set.
+		Blobs BlobStore
+		// The SensorRegistry implementation used to validate readings. Defaults to DefaultSensorRules.
+		Sensors SensorRegistry
+		// The Logger to write log messages to.
+		Logger *log.Logger
+		// The name of the application producing events, included in each event's envelope.
+		Producer string
+		// The maximum number of readings to publish at once. A value of one or fewer disables batching.
+		BatchSize int
+		// The maximum amount of time readings can wait within a batch before it is published.
+		BatchInterval time.Duration
 	}
 
 	// The EventWriter interface describes types that can publish messages onto an event stream.
 	EventWriter interface {
-		Write(ctx context.Context, message json.RawMessage) error
+		Write(ctx context.Context, envelope event.Envelope) error
+		WriteBatch(ctx context.Context, envelopes []event.Envelope) error
 	}
 )
 
-// NewHTTP returns a new instance of the HTTP type that will publish Reading events onto the provided
-// EventWriter implementation to the desired subject. The HTTP.Register method should be used to register
-// the handling methods onto an HTTP router.
-func NewHTTP(events EventWriter, logger *log.Logger) *HTTP {
-	return &HTTP{
-		writer: events,
-		logger: logger,
+// NewHTTP returns a new instance of the HTTP type that will publish Reading events onto the configured
+// EventWriter implementation. The HTTP.Register method should be used to register the handling methods onto
+// an HTTP router.
+func NewHTTP(config HTTPConfig) *HTTP {
+	h := &HTTP{
+		writer:        config.Events,
+		sessions:      config.Sessions,
+		jobs:          config.Jobs,
+		blobs:         config.Blobs,
+		sensors:       config.Sensors,
+		logger:        config.Logger,
+		producer:      config.Producer,
+		batchSize:     config.BatchSize,
+		batchInterval: config.BatchInterval,
+	}
+
+	if h.sensors == nil {
+		h.sensors = DefaultSensorRules
 	}
+
+	return h
 }
 
 type (
 	// The IngestResponse type is the response DTO when calling HTTP.Ingest. It contains an array of all readings
 	// that failed validation.
 	IngestResponse struct {
-		Invalid []Reading `json:"invalid,omitempty"`
+		Invalid []InvalidReading `json:"invalid,omitempty"`
+	}
+
+	// The InvalidReading type describes a reading that failed validation, its position within the request body and
+	// the reason it failed.
+	InvalidReading struct {
+		Reading
+		Row    int    `json:"row"`
+		Reason string `json:"reason"`
 	}
 )
 
 // Ingest readings from the request body, publishing each onto the configured EventWriter. This method expects
-// the request body to contain a JSON stream of individual readings. Each reading is validated then published.
+// the request body to contain either a JSON stream or CSV rows of individual readings, depending on the Content-Type
+// header. Each reading is validated then published. The request body may be compressed using gzip or zstd, as
+// specified in the Content-Encoding header. If any readings were spooled rather than published because the event bus
+// is unavailable, a 202 status code is returned.
+//
+// If the request contains a "Prefer: respond-async" header and asynchronous jobs are enabled, the request body is
+// stored and a Job is returned with a 202 status code instead. The readings are then published in the background by a
+// JobWorker.
 func (h *HTTP) Ingest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	decoder := json.NewDecoder(r.Body)
+
+	vehicle, ok := middleware.Vehicle(ctx)
+	if !ok {
+		http.Error(w, errNoVehicle.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if h.jobs != nil && preferAsync(r) {
+		h.enqueue(w, r, vehicle)
+		return
+	}
+
+	body, err := decodeBody(r.Header.Get("Content-Encoding"), r.Body)
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer closers.Close(body)
+
+	decoder := newDecoder(mediaType(r), body)
+	batch := event.NewBatch(h.writer, h.batchSize, h.batchInterval)
+
+	// All readings within the upload share the same ingestion time & device, which allows us to trace readings back
+	// to the upload that produced them.
+	ingestedAt := time.Now()
+	deviceID := deviceID(r)
 
 	var resp IngestResponse
+	var row int
+	var spooled bool
 
-	// For efficiency, read the contents of the stream one JSON-object at a time. This will allow the server
+	// For efficiency, read the contents of the stream one reading at a time. This will allow the server
 	// to publish readings without loading the entire payload in-memory. It could be that we go substantial
 	// amounts of time without an internet connection so there's a possibility of large uploads. Several days
 	// worth of readings could trigger an OOM.
@@ -62,6 +163,7 @@ ingest:
 			return
 		default:
 			var request Reading
+			row++
 
 			// We decode each reading one-by-one to ensure their format is correct.
 			err := decoder.Decode(&request)
@@ -69,31 +171,56 @@ ingest:
 			case errors.Is(err, io.EOF):
 				break ingest
 			case err != nil:
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				http.Error(w, fmt.Sprintf("row %d: %v", row, err), http.StatusBadRequest)
 				return
-			case !request.Valid():
-				resp.Invalid = append(resp.Invalid, request)
+			}
+
+			// The vehicle is determined by the credentials used to upload the readings, so any vehicle within the
+			// body itself is ignored.
+			request.Vehicle = vehicle
+			if err = request.Validate(h.sensors); err != nil {
+				resp.Invalid = append(resp.Invalid, InvalidReading{Reading: request, Row: row, Reason: err.Error()})
 				continue
 			}
 
-			data, err := json.Marshal(request)
+			envelope, err := newEnvelope(uuid.NewString(), h.producer, ingestedAt, deviceID, request)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			if err = h.writer.Write(ctx, data); err != nil {
+			err = batch.Write(ctx, envelope)
+			switch {
+			case errors.Is(err, event.ErrSpooled):
+				spooled = true
+			case err != nil:
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			h.logger.Println("Ingested reading:", request)
+			h.logger.Println("Ingested reading:", request, "as event", envelope.ID)
 		}
 	}
 
+	// Readings may still be buffered within the batch, so we need to make sure they've all been published before
+	// we respond.
+	err = batch.Flush(ctx)
+	switch {
+	case errors.Is(err, event.ErrSpooled):
+		spooled = true
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if len(resp.Invalid) > 0 {
+	switch {
+	case len(resp.Invalid) > 0:
 		w.WriteHeader(http.StatusBadRequest)
+	case spooled:
+		// Spooled readings have been durably accepted but not yet published, so we let the client know they
+		// don't need to retry while making it clear that processing will be delayed.
+		w.WriteHeader(http.StatusAccepted)
 	}
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -102,9 +229,113 @@ ingest:
 	}
 }
 
+// deviceID returns the identifier of the device performing the request. A device associated with the request's API
+// key takes precedence over the X-Device-ID header, as the header can be set to anything.
+func deviceID(r *http.Request) string {
+	if deviceID, ok := middleware.DeviceID(r.Context()); ok {
+		return deviceID
+	}
+
+	return r.Header.Get("X-Device-ID")
+}
+
+// newEnvelope returns the Envelope used to publish a Reading.
+func newEnvelope(id, producer string, ingestedAt time.Time, deviceID string, reading Reading) (event.Envelope, error) {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Version:    SchemaVersion,
+		ID:         id,
+		Producer:   producer,
+		IngestedAt: ingestedAt,
+		DeviceID:   deviceID,
+		Body:       data,
+	}, nil
+}
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errNoVehicle           = errors.New("no vehicle is associated with the provided credentials")
+)
+
+// decodeBody returns an io.ReadCloser implementation that decompresses the body based on the value of a
+// Content-Encoding header. Decompression is performed as the body is read, so the payload is never held in memory
+// in its entirety. Closing the returned io.ReadCloser does not close the underlying body.
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "zstd":
+		// The decoder is limited to a single goroutine & low memory mode as we only ever read the stream
+		// sequentially and want to avoid large allocations for very large uploads.
+		decoder, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// supportedEncoding returns true if decodeBody is able to decompress bodies using the given Content-Encoding.
+func supportedEncoding(encoding string) bool {
+	switch encoding {
+	case "", "identity", "gzip", "zstd":
+		return true
+	default:
+		return false
+	}
+}
+
+// mediaType returns the media type of the request's Content-Type header, without any parameters such as its charset.
+// Returns an empty string if the header is missing or malformed.
+func mediaType(r *http.Request) string {
+	parsed, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return parsed
+}
+
+// hasMediaType returns a mux.MatcherFunc that matches requests whose Content-Type header has one of the media types.
+func hasMediaType(mediaTypes ...string) mux.MatcherFunc {
+	return func(r *http.Request, _ *mux.RouteMatch) bool {
+		actual := mediaType(r)
+		for _, expected := range mediaTypes {
+			if actual == expected {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
 // Register the HTTP's routes onto the HTTP router.
 func (h *HTTP) Register(router *mux.Router) {
 	router.HandleFunc("/ingest", h.Ingest).
 		Methods(http.MethodPost).
-		Headers("Content-Type", "application/stream+json")
+		MatcherFunc(hasMediaType(contentTypeJSONStream, contentTypeCSV))
+
+	if h.sessions != nil {
+		router.HandleFunc("/ingest/sessions", h.CreateSession).Methods(http.MethodPost)
+		router.HandleFunc("/ingest/sessions/{id}", h.GetSession).Methods(http.MethodGet)
+		router.HandleFunc("/ingest/sessions/{id}", h.AppendSession).Methods(http.MethodPatch)
+		router.HandleFunc("/ingest/sessions/{id}/finalize", h.FinalizeSession).Methods(http.MethodPost)
+	}
+
+	if h.jobs != nil {
+		router.HandleFunc("/ingest/jobs/{id}", h.GetJob).Methods(http.MethodGet)
+	}
 }
@@ -2,6 +2,7 @@ package reading_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io"
 	"log"
@@ -11,7 +12,10 @@ import (
 	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/cloud-lada/backend/pkg/middleware"
 	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,14 +24,38 @@ func TestHTTP_Ingest(t *testing.T) {
 	t.Parallel()
 
 	tt := []struct {
-		Name         string
-		Readings     []reading.Reading
-		PublishError error
-		ExpectedCode int
+		Name            string
+		Readings        []reading.Reading
+		Encoding        string
+		BatchSize       int
+		PublishError    error
+		Anonymous       bool
+		KeyDeviceID     string
+		ExpectedCode    int
+		ExpectedBatches int
 	}{
 		{
-			Name:         "It should accept valid readings and publish them",
-			ExpectedCode: http.StatusOK,
+			Name:            "It should accept valid readings and publish them",
+			ExpectedCode:    http.StatusOK,
+			ExpectedBatches: 2,
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     70,
+					Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:            "It should publish readings in batches",
+			ExpectedCode:    http.StatusOK,
+			BatchSize:       2,
+			ExpectedBatches: 2,
 			Readings: []reading.Reading{
 				{
 					Sensor:    reading.SensorTypeSpeed,
@@ -39,6 +67,11 @@ func TestHTTP_Ingest(t *testing.T) {
 					Value:     70,
 					Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
 				},
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     75,
+					Timestamp: time.Date(2022, 1, 1, 0, 2, 0, 0, time.UTC),
+				},
 			},
 		},
 		{
@@ -53,6 +86,18 @@ func TestHTTP_Ingest(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:         "It should return accepted if readings were spooled",
+			ExpectedCode: http.StatusAccepted,
+			PublishError: event.ErrSpooled,
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
 		{
 			Name:         "It should return bad request if one or more readings are invalid",
 			ExpectedCode: http.StatusBadRequest,
@@ -69,25 +114,112 @@ func TestHTTP_Ingest(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:         "It should accept gzip encoded readings",
+			ExpectedCode: http.StatusOK,
+			Encoding:     "gzip",
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Sensor:    reading.SensorTypeFuel,
+					Value:     30,
+					Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should accept zstd encoded readings",
+			ExpectedCode: http.StatusOK,
+			Encoding:     "zstd",
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Sensor:    reading.SensorTypeFuel,
+					Value:     30,
+					Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should return unsupported media type for an unknown encoding",
+			ExpectedCode: http.StatusUnsupportedMediaType,
+			Encoding:     "br",
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should use the device associated with the API key",
+			ExpectedCode: http.StatusOK,
+			KeyDeviceID:  "logger",
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should return unauthorized if no vehicle is associated with the request",
+			ExpectedCode: http.StatusUnauthorized,
+			Anonymous:    true,
+			Readings: []reading.Reading{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			sink := &MockEventWriter{err: tc.PublishError}
-			h := reading.NewHTTP(sink, log.New(io.Discard, "", log.Flags()))
+			h := reading.NewHTTP(reading.HTTPConfig{
+				Events:        sink,
+				Logger:        log.New(io.Discard, "", log.Flags()),
+				BatchSize:     tc.BatchSize,
+				BatchInterval: time.Minute,
+			})
 
 			router := mux.NewRouter()
 			h.Register(router)
 
 			body := bytes.NewBuffer([]byte{})
-			encoder := json.NewEncoder(body)
+			writer := encode(t, body, tc.Encoding)
+			encoder := json.NewEncoder(writer)
 			for _, r := range tc.Readings {
 				require.NoError(t, encoder.Encode(r))
 			}
+			require.NoError(t, writer.Close())
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodPost, "/ingest", body)
 			r.Header.Set("Content-Type", "application/stream+json")
+			r.Header.Set("X-Device-ID", "test")
+			if tc.Encoding != "" {
+				r.Header.Set("Content-Encoding", tc.Encoding)
+			}
+			if !tc.Anonymous {
+				r = withVehicle(r, "lada")
+			}
+			if tc.KeyDeviceID != "" {
+				r = r.WithContext(middleware.WithDeviceID(r.Context(), tc.KeyDeviceID))
+			}
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
@@ -97,13 +229,251 @@ func TestHTTP_Ingest(t *testing.T) {
 			}
 
 			require.Len(t, sink.messages, len(tc.Readings))
+			if tc.ExpectedBatches > 0 {
+				assert.EqualValues(t, tc.ExpectedBatches, sink.batches)
+			}
+
+			expectedDeviceID := "test"
+			if tc.KeyDeviceID != "" {
+				expectedDeviceID = tc.KeyDeviceID
+			}
+
+			for i, message := range sink.messages {
+				var r reading.Reading
+
+				require.NoError(t, json.Unmarshal(message.Data, &r))
+
+				// The vehicle is always taken from the request context.
+				expected := tc.Readings[i]
+				expected.Vehicle = "lada"
+				assert.EqualValues(t, expected, r)
+				assert.EqualValues(t, reading.SchemaVersion, message.Envelope.Version)
+				assert.EqualValues(t, expectedDeviceID, message.Envelope.DeviceID)
+				assert.NotEmpty(t, message.Envelope.ID)
+				assert.NotZero(t, message.Envelope.IngestedAt)
+			}
+		})
+	}
+}
+
+func TestHTTP_IngestCSV(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name            string
+		ContentType     string
+		Body            string
+		ExpectedCode    int
+		ExpectedMessage string
+		ExpectedInvalid []reading.InvalidReading
+		Expected        []reading.Reading
+	}{
+		{
+			Name:         "It should accept valid rows and publish them",
+			ExpectedCode: http.StatusOK,
+			Body: "sensor,value,timestamp\n" +
+				"speed,65,2022-01-01T00:00:00Z\n" +
+				"fuel,30.5,2022-01-01T00:01:00Z\n",
+			Expected: []reading.Reading{
+				{
+					Vehicle:   "lada",
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Vehicle:   "lada",
+					Sensor:    reading.SensorTypeFuel,
+					Value:     30.5,
+					Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should accept rows without a header",
+			ExpectedCode: http.StatusOK,
+			Body:         "speed,65,2022-01-01T00:00:00Z\n",
+			Expected: []reading.Reading{
+				{
+					Vehicle:   "lada",
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should ignore parameters of the content type",
+			ContentType:  "text/csv; charset=utf-8",
+			ExpectedCode: http.StatusOK,
+			Body: "\ufeffSensor,Value,Timestamp\n" +
+				"speed,65,2022-01-01T00:00:00Z\n",
+			Expected: []reading.Reading{
+				{
+					Vehicle:   "lada",
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     65,
+					Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			Name:         "It should only skip a first row that names every column",
+			ExpectedCode: http.StatusBadRequest,
+			Body:         "sensor,65,2022-01-01T00:00:00Z\n",
+			ExpectedInvalid: []reading.InvalidReading{
+				{
+					Row:    1,
+					Reason: `unknown sensor "sensor"`,
+					Reading: reading.Reading{
+						Vehicle:   "lada",
+						Sensor:    "sensor",
+						Value:     65,
+						Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			Name:         "It should return bad request with row numbers for invalid rows",
+			ExpectedCode: http.StatusBadRequest,
+			Body: "sensor,value,timestamp\n" +
+				"speed,65,2022-01-01T00:00:00Z\n" +
+				"invalid_sensor,65,2022-01-01T00:00:00Z\n",
+			ExpectedInvalid: []reading.InvalidReading{
+				{
+					Row:    2,
+					Reason: `unknown sensor "invalid_sensor"`,
+					Reading: reading.Reading{
+						Vehicle:   "lada",
+						Sensor:    "invalid_sensor",
+						Value:     65,
+						Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			Name:         "It should return bad request with reasons for implausible values",
+			ExpectedCode: http.StatusBadRequest,
+			Body: "speed,-4000,2022-01-01T00:00:00Z\n" +
+				"location_latitude,700,2022-01-01T00:00:00Z\n",
+			ExpectedInvalid: []reading.InvalidReading{
+				{
+					Row:    1,
+					Reason: "value -4000 is outside of the range 0 to 250 for speed",
+					Reading: reading.Reading{
+						Vehicle:   "lada",
+						Sensor:    reading.SensorTypeSpeed,
+						Value:     -4000,
+						Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+				{
+					Row:    2,
+					Reason: "value 700 is outside of the range -90 to 90 for location_latitude",
+					Reading: reading.Reading{
+						Vehicle:   "lada",
+						Sensor:    reading.SensorTypeLocationLatitude,
+						Value:     700,
+						Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			Name:         "It should return bad request for malformed rows",
+			ExpectedCode: http.StatusBadRequest,
+			Body:         "speed,fast,2022-01-01T00:00:00Z\n",
+		},
+		{
+			Name:         "It should return bad request for rows with missing fields",
+			ExpectedCode: http.StatusBadRequest,
+			Body:         "speed,65\n",
+		},
+		{
+			Name:            "It should return bad request for rows whose value is not a number",
+			ExpectedCode:    http.StatusBadRequest,
+			ExpectedMessage: `row 1: invalid value "NaN": value must be a finite number`,
+			Body:            "speed,NaN,2022-01-01T00:00:00Z\n",
+		},
+		{
+			Name:            "It should return bad request for rows whose value is infinite",
+			ExpectedCode:    http.StatusBadRequest,
+			ExpectedMessage: `row 2: invalid value "-Inf": value must be a finite number`,
+			Body: "speed,65,2022-01-01T00:00:00Z\n" +
+				"speed,-Inf,2022-01-01T00:00:00Z\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			sink := &MockEventWriter{}
+			h := reading.NewHTTP(reading.HTTPConfig{
+				Events: sink,
+				Logger: log.New(io.Discard, "", log.Flags()),
+			})
+
+			router := mux.NewRouter()
+			h.Register(router)
+
+			w := httptest.NewRecorder()
+			contentType := tc.ContentType
+			if contentType == "" {
+				contentType = "text/csv"
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(tc.Body))
+			r.Header.Set("Content-Type", contentType)
+			r = withVehicle(r, "lada")
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+
+			if tc.ExpectedMessage != "" {
+				assert.Contains(t, w.Body.String(), tc.ExpectedMessage)
+			}
+
+			if tc.ExpectedInvalid != nil {
+				var resp reading.IngestResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.EqualValues(t, tc.ExpectedInvalid, resp.Invalid)
+				return
+			}
+
+			if tc.ExpectedCode >= http.StatusMultipleChoices {
+				return
+			}
+
+			require.Len(t, sink.messages, len(tc.Expected))
 
 			for i, message := range sink.messages {
 				var r reading.Reading
 
 				require.NoError(t, json.Unmarshal(message.Data, &r))
-				assert.EqualValues(t, tc.Readings[i], r)
+				assert.EqualValues(t, tc.Expected[i], r)
 			}
 		})
 	}
 }
+
+// withVehicle returns a copy of the request whose context contains the vehicle, as if it had passed through the
+// authentication middleware.
+func withVehicle(r *http.Request, vehicle string) *http.Request {
+	return r.WithContext(middleware.WithVehicle(r.Context(), vehicle))
+}
+
+func encode(t *testing.T, w io.Writer, encoding string) io.WriteCloser {
+	t.Helper()
+
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w)
+	case "zstd":
+		encoder, err := zstd.NewWriter(w)
+		require.NoError(t, err)
+		return encoder
+	default:
+		return &NoopCloser{Writer: w}
+	}
+}
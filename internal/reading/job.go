@@ -0,0 +1,227 @@
+package reading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type (
+	// The Job type describes an asynchronous ingest of readings. The request body is stored within blob storage and
+	// its readings are published in the background by a JobWorker.
+	Job struct {
+		// The unique identifier of the job.
+		ID string `json:"id"`
+		// The current status of the job.
+		Status JobStatus `json:"status"`
+		// The format of the readings within the upload, either a JSON stream or CSV.
+		ContentType string `json:"content_type"`
+		// The identifier of the vehicle that the readings belong to.
+		Vehicle string `json:"vehicle"`
+		// The compression algorithm used on the upload, if any.
+		ContentEncoding string `json:"content_encoding,omitempty"`
+		// The identifier of the device that performed the upload, if known.
+		DeviceID string `json:"device_id,omitempty"`
+		// The number of rows that have been processed so far.
+		Rows int `json:"rows"`
+		// The number of rows that contained valid readings and were published.
+		Valid int `json:"valid"`
+		// The number of rows that contained invalid readings.
+		Invalid int `json:"invalid"`
+		// Descriptions of rows that could not be published, and the reason the job failed if applicable. Limited to
+		// the first maxJobErrors errors.
+		Errors []string `json:"errors,omitempty"`
+		// The time at which the job was created.
+		CreatedAt time.Time `json:"created_at"`
+		// The time at which the job was last updated.
+		UpdatedAt time.Time `json:"updated_at"`
+		// The time at which the job finished, whether it completed or failed.
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+	}
+
+	// The JobStatus type describes the stage of processing a Job is at.
+	JobStatus string
+
+	// The JobRepository interface describes types that can persist the state of asynchronous ingest jobs.
+	JobRepository interface {
+		Create(ctx context.Context, job Job) error
+		Get(ctx context.Context, id string) (Job, error)
+		Claim(ctx context.Context, lease time.Duration) (Job, error)
+		Update(ctx context.Context, job Job, previous time.Time) error
+	}
+
+	// The BlobStore interface describes types that can store request bodies for asynchronous ingest jobs. A blob is
+	// stored once its writer is closed, and discarded if the context given to NewWriter is cancelled before then.
+	BlobStore interface {
+		NewWriter(ctx context.Context, name string) (io.WriteCloser, error)
+		NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+		Delete(ctx context.Context, name string) error
+	}
+)
+
+// Constants for job statuses.
+const (
+	JobStatusPending  = JobStatus("pending")
+	JobStatusRunning  = JobStatus("running")
+	JobStatusComplete = JobStatus("complete")
+	JobStatusFailed   = JobStatus("failed")
+)
+
+var (
+	// ErrJobNotFound is the error returned when an ingest job does not exist.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrNoJobs is the error returned by JobRepository.Claim when there are no jobs waiting to be processed.
+	ErrNoJobs = errors.New("no jobs to claim")
+	// ErrJobReclaimed is the error returned by JobRepository.Update when the job has been updated since it was last
+	// read, meaning its lease expired and it was claimed by another worker.
+	ErrJobReclaimed = errors.New("job has been reclaimed")
+)
+
+// The maximum number of errors recorded against a single job, this prevents a file full of invalid readings from
+// producing an enormous job.
+const maxJobErrors = 100
+
+func (j *Job) addError(err error) {
+	if len(j.Errors) < maxJobErrors {
+		j.Errors = append(j.Errors, err.Error())
+	}
+}
+
+// errors returns the job's errors, never returning nil so they are always stored as an array.
+func (j *Job) errors() []string {
+	if j.Errors == nil {
+		return []string{}
+	}
+
+	return j.Errors
+}
+
+func jobBlobName(id string) string {
+	return "ingest/" + id
+}
+
+// preferAsync returns true if the request contains a Prefer header asking for the request to be handled
+// asynchronously, as described in RFC 7240.
+func preferAsync(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(token), "respond-async") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// enqueue stores the request body within blob storage and creates a Job to publish its readings in the background.
+// The new job is returned with a 202 status code.
+func (h *HTTP) enqueue(w http.ResponseWriter, r *http.Request, vehicle string) {
+	ctx := r.Context()
+
+	// The body isn't decoded until a worker picks up the job, so we need to check that we'll be able to decode it
+	// before accepting it.
+	encoding := r.Header.Get("Content-Encoding")
+	if !supportedEncoding(encoding) {
+		http.Error(w, errUnsupportedEncoding.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	now := time.Now().UTC()
+	job := Job{
+		ID:              uuid.NewString(),
+		Status:          JobStatusPending,
+		ContentType:     mediaType(r),
+		Vehicle:         vehicle,
+		ContentEncoding: encoding,
+		DeviceID:        deviceID(r),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	// Cancelling the context given to the BlobStore discards the blob, so a partially received body is never stored.
+	blobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blob, err := h.blobs.NewWriter(blobCtx, jobBlobName(job.ID))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to open blob: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The body is stored exactly as it was received, compression included, to keep storage costs down.
+	if _, err = io.Copy(blob, r.Body); err != nil {
+		http.Error(w, fmt.Sprintf("failed to store body: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Blobs aren't guaranteed to be written until they're closed, so we can't rely on a deferred close here.
+	if err = blob.Close(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to store body: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.jobs.Create(ctx, job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Println("Created ingest job", job.ID)
+
+	w.Header().Set("Location", "/ingest/jobs/"+job.ID)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// GetJob handles an inbound HTTP GET request that returns the current state of an asynchronous ingest job. Jobs can
+// only be viewed using credentials for the vehicle that created them.
+func (h *HTTP) GetJob(w http.ResponseWriter, r *http.Request) {
+	vehicle, ok := middleware.Vehicle(r.Context())
+	if !ok {
+		http.Error(w, errNoVehicle.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	// Job identifiers are always UUIDs, so there's no need to query for anything else.
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, ErrJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	job, err := h.jobs.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case job.Vehicle != vehicle:
+		// Jobs belonging to other vehicles are treated as though they don't exist.
+		http.Error(w, ErrJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJob(w, http.StatusOK, job)
+}
+
+func writeJob(w http.ResponseWriter, code int, job Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
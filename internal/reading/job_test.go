@@ -0,0 +1,405 @@
+package reading_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP_IngestAsync(t *testing.T) {
+	t.Parallel()
+
+	body := line(t, reading.Reading{
+		Sensor:    reading.SensorTypeSpeed,
+		Value:     65,
+		Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	tt := []struct {
+		Name         string
+		Prefer       string
+		Encoding     string
+		BodyError    error
+		ExpectedCode int
+		ExpectsJob   bool
+	}{
+		{
+			Name:         "It should create a job when asynchronous processing is preferred",
+			Prefer:       "respond-async",
+			ExpectedCode: http.StatusAccepted,
+			ExpectsJob:   true,
+		},
+		{
+			Name:         "It should handle multiple preferences",
+			Prefer:       "return=minimal, respond-async; wait=10",
+			ExpectedCode: http.StatusAccepted,
+			ExpectsJob:   true,
+		},
+		{
+			Name:         "It should ingest synchronously when asynchronous processing is not preferred",
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return unsupported media type for an unknown encoding",
+			Prefer:       "respond-async",
+			Encoding:     "br",
+			ExpectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			Name:         "It should not store a body that could not be read in full",
+			Prefer:       "respond-async",
+			BodyError:    io.ErrUnexpectedEOF,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			sink := &MockEventWriter{}
+			jobs := &MockJobRepository{}
+			blobs := &MockBlobStore{}
+
+			h := reading.NewHTTP(reading.HTTPConfig{
+				Events: sink,
+				Jobs:   jobs,
+				Blobs:  blobs,
+				Logger: log.New(io.Discard, "", log.Flags()),
+			})
+
+			router := mux.NewRouter()
+			h.Register(router)
+
+			var reader io.Reader = bytes.NewReader(body)
+			if tc.BodyError != nil {
+				reader = io.MultiReader(reader, iotest.ErrReader(tc.BodyError))
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/ingest", reader)
+			r.Header.Set("Content-Type", "application/stream+json")
+			r.Header.Set("X-Device-ID", "test")
+			if tc.Prefer != "" {
+				r.Header.Set("Prefer", tc.Prefer)
+			}
+			if tc.Encoding != "" {
+				r.Header.Set("Content-Encoding", tc.Encoding)
+			}
+			r = withVehicle(r, "lada")
+
+			router.ServeHTTP(w, r)
+			require.EqualValues(t, tc.ExpectedCode, w.Code)
+
+			if !tc.ExpectsJob {
+				assert.Empty(t, jobs.jobs)
+				assert.Empty(t, blobs.blobs)
+				return
+			}
+
+			var job reading.Job
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&job))
+			assert.EqualValues(t, "/ingest/jobs/"+job.ID, w.Header().Get("Location"))
+			assert.EqualValues(t, reading.JobStatusPending, job.Status)
+			assert.EqualValues(t, "test", job.DeviceID)
+			assert.EqualValues(t, "lada", job.Vehicle)
+			assert.Contains(t, jobs.jobs, job.ID)
+			assert.EqualValues(t, body, blobs.blobs["ingest/"+job.ID])
+			assert.Empty(t, sink.messages)
+		})
+	}
+}
+
+func TestHTTP_GetJob(t *testing.T) {
+	t.Parallel()
+
+	job := reading.Job{
+		ID:          "e1b9a5b1-3b0c-4b4e-9a57-5a5b0d3f4b1e",
+		Status:      reading.JobStatusComplete,
+		ContentType: "application/stream+json",
+		Vehicle:     "lada",
+		Rows:        3,
+		Valid:       2,
+		Invalid:     1,
+		Errors:      []string{"row 2: invalid reading"},
+		CreatedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tt := []struct {
+		Name         string
+		ID           string
+		Vehicle      string
+		Error        error
+		ExpectedCode int
+		Expected     reading.Job
+	}{
+		{
+			Name:         "It should return a job",
+			ID:           job.ID,
+			Vehicle:      "lada",
+			ExpectedCode: http.StatusOK,
+			Expected:     job,
+		},
+		{
+			Name:         "It should return not found for an unknown job",
+			ID:           "a7f0c3c4-5b8e-4e0a-8e0e-0c6f3d1c2b3a",
+			Vehicle:      "lada",
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:         "It should return not found for an invalid identifier",
+			ID:           "not-a-uuid",
+			Vehicle:      "lada",
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:         "It should return not found for a job belonging to another vehicle",
+			ID:           job.ID,
+			Vehicle:      "support",
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:         "It should return unauthorized if no vehicle is associated with the request",
+			ID:           job.ID,
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should return internal server error for repository errors",
+			ID:           job.ID,
+			Vehicle:      "lada",
+			Error:        io.EOF,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			jobs := &MockJobRepository{
+				jobs: map[string]reading.Job{job.ID: job},
+				err:  tc.Error,
+			}
+
+			h := reading.NewHTTP(reading.HTTPConfig{
+				Jobs:   jobs,
+				Blobs:  &MockBlobStore{},
+				Logger: log.New(io.Discard, "", log.Flags()),
+			})
+
+			router := mux.NewRouter()
+			h.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/ingest/jobs/"+tc.ID, nil)
+			if tc.Vehicle != "" {
+				r = withVehicle(r, tc.Vehicle)
+			}
+
+			router.ServeHTTP(w, r)
+			require.EqualValues(t, tc.ExpectedCode, w.Code)
+
+			if tc.ExpectedCode >= http.StatusMultipleChoices {
+				return
+			}
+
+			var actual reading.Job
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
+
+func TestJobWorker_Run(t *testing.T) {
+	t.Parallel()
+
+	readings := []reading.Reading{
+		{
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     65,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Sensor:    "invalid_sensor",
+			Value:     65,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Sensor:    reading.SensorTypeFuel,
+			Value:     30,
+			Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+		},
+	}
+
+	var upload []byte
+	for _, r := range readings {
+		upload = append(upload, line(t, r)...)
+	}
+
+	tt := []struct {
+		Name              string
+		Body              []byte
+		Rows              int
+		Missing           bool
+		ExpectedStatus    reading.JobStatus
+		ExpectedRows      int
+		ExpectedValid     int
+		ExpectedInvalid   int
+		ExpectedPublished int
+		ExpectsDeleted    bool
+	}{
+		{
+			Name:              "It should publish valid readings from a job",
+			Body:              upload,
+			ExpectedStatus:    reading.JobStatusComplete,
+			ExpectedRows:      3,
+			ExpectedValid:     2,
+			ExpectedInvalid:   1,
+			ExpectedPublished: 2,
+			ExpectsDeleted:    true,
+		},
+		{
+			Name:              "It should skip rows that were processed before the job was reclaimed",
+			Body:              upload,
+			Rows:              2,
+			ExpectedStatus:    reading.JobStatusComplete,
+			ExpectedRows:      3,
+			ExpectedValid:     1,
+			ExpectedPublished: 1,
+			ExpectsDeleted:    true,
+		},
+		{
+			Name:              "It should fail a job containing a malformed row",
+			Body:              append(line(t, readings[0]), []byte("this will not decode\n")...),
+			ExpectedStatus:    reading.JobStatusFailed,
+			ExpectedRows:      1,
+			ExpectedValid:     1,
+			ExpectedPublished: 1,
+		},
+		{
+			Name:           "It should fail a job whose body does not exist",
+			Missing:        true,
+			ExpectedStatus: reading.JobStatusFailed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+
+			job := reading.Job{
+				ID:          "e1b9a5b1-3b0c-4b4e-9a57-5a5b0d3f4b1e",
+				Status:      reading.JobStatusPending,
+				ContentType: "application/stream+json",
+				Vehicle:     "lada",
+				DeviceID:    "test",
+				Rows:        tc.Rows,
+				CreatedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+
+			sink := &MockEventWriter{}
+			blobs := &MockBlobStore{blobs: map[string][]byte{"ingest/" + job.ID: tc.Body}}
+			if tc.Missing {
+				blobs.blobs = map[string][]byte{}
+			}
+
+			// The worker stops once there are no more jobs to claim.
+			jobs := &MockJobRepository{
+				jobs:  map[string]reading.Job{job.ID: job},
+				empty: cancel,
+			}
+
+			worker := reading.NewJobWorker(reading.JobWorkerConfig{
+				Jobs:   jobs,
+				Blobs:  blobs,
+				Events: sink,
+				Logger: log.New(io.Discard, "", log.Flags()),
+			})
+
+			assert.ErrorIs(t, worker.Run(ctx), context.Canceled)
+
+			actual := jobs.jobs[job.ID]
+			assert.EqualValues(t, tc.ExpectedStatus, actual.Status)
+			assert.EqualValues(t, tc.ExpectedRows, actual.Rows)
+			assert.EqualValues(t, tc.ExpectedValid, actual.Valid)
+			assert.EqualValues(t, tc.ExpectedInvalid, actual.Invalid)
+			assert.NotNil(t, actual.FinishedAt)
+			assert.Len(t, sink.messages, tc.ExpectedPublished)
+
+			for _, message := range sink.messages {
+				assert.EqualValues(t, job.CreatedAt, message.Envelope.IngestedAt)
+				assert.EqualValues(t, job.DeviceID, message.Envelope.DeviceID)
+
+				var r reading.Reading
+				require.NoError(t, json.Unmarshal(message.Data, &r))
+				assert.EqualValues(t, job.Vehicle, r.Vehicle)
+			}
+
+			if tc.ExpectsDeleted {
+				assert.Contains(t, blobs.deleted, "ingest/"+job.ID)
+			} else {
+				assert.Empty(t, blobs.deleted)
+			}
+		})
+	}
+}
+
+func TestJobWorker_RunReclaimed(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var upload []byte
+	for i := 0; i < 100; i++ {
+		upload = append(upload, line(t, reading.Reading{
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     65,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, i, 0, time.UTC),
+		})...)
+	}
+
+	job := reading.Job{
+		ID:          "e1b9a5b1-3b0c-4b4e-9a57-5a5b0d3f4b1e",
+		Status:      reading.JobStatusPending,
+		ContentType: "application/stream+json",
+		Vehicle:     "lada",
+		CreatedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// Publishing is slow enough that the lease must be renewed before the job completes, at which point we find it
+	// has been claimed by another worker.
+	sink := &MockEventWriter{delay: time.Millisecond * 10}
+	blobs := &MockBlobStore{blobs: map[string][]byte{"ingest/" + job.ID: upload}}
+	jobs := &MockJobRepository{
+		jobs:      map[string]reading.Job{job.ID: job},
+		empty:     cancel,
+		reclaimed: true,
+	}
+
+	worker := reading.NewJobWorker(reading.JobWorkerConfig{
+		Jobs:   jobs,
+		Blobs:  blobs,
+		Events: sink,
+		Logger: log.New(io.Discard, "", log.Flags()),
+		Lease:  time.Millisecond * 30,
+	})
+
+	assert.ErrorIs(t, worker.Run(ctx), context.Canceled)
+
+	actual := jobs.jobs[job.ID]
+	assert.EqualValues(t, reading.JobStatusRunning, actual.Status)
+	assert.Nil(t, actual.FinishedAt)
+	assert.Less(t, len(sink.messages), 100)
+	assert.Empty(t, blobs.deleted)
+}
@@ -1,10 +1,16 @@
 package reading_test
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/blob"
+	"github.com/cloud-lada/backend/pkg/event"
 )
 
 type (
@@ -12,28 +18,244 @@ type (
 		reading.EventWriter
 
 		messages []MockMessage
+		batches  int
+		delay    time.Duration
 		err      error
 	}
 
 	MockMessage struct {
-		Data []byte
+		Data     []byte
+		Envelope event.Envelope
 	}
 
 	MockRepository struct {
-		saved reading.Reading
-		err   error
+		saved      reading.Reading
+		savedBatch []reading.Reading
+		err        error
+	}
+
+	MockSessionRepository struct {
+		sessions map[string]reading.Session
+		err      error
+	}
+
+	MockJobRepository struct {
+		mu        sync.Mutex
+		jobs      map[string]reading.Job
+		claimed   []string
+		empty     func()
+		reclaimed bool
+		err       error
+	}
+
+	MockBlobStore struct {
+		blobs   map[string][]byte
+		deleted []string
+	}
+
+	MockBlob struct {
+		bytes.Buffer
+
+		ctx   context.Context
+		name  string
+		store *MockBlobStore
+	}
+
+	NoopCloser struct {
+		io.Writer
 	}
 )
 
-func (m *MockEventWriter) Write(_ context.Context, message json.RawMessage) error {
+func (n *NoopCloser) Close() error {
+	return nil
+}
+
+func (m *MockEventWriter) Write(_ context.Context, envelope event.Envelope) error {
+	time.Sleep(m.delay)
 	m.messages = append(m.messages, MockMessage{
-		Data: message,
+		Data:     envelope.Body,
+		Envelope: envelope,
 	})
 
 	return m.err
 }
 
+func (m *MockEventWriter) WriteBatch(ctx context.Context, envelopes []event.Envelope) error {
+	m.batches++
+	for _, envelope := range envelopes {
+		if err := m.Write(ctx, envelope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *MockRepository) Save(ctx context.Context, reading reading.Reading) error {
 	m.saved = reading
 	return m.err
 }
+
+func (m *MockRepository) SaveBatch(ctx context.Context, readings []reading.Reading) error {
+	m.savedBatch = readings
+	return m.err
+}
+
+func (m *MockSessionRepository) Create(_ context.Context, session reading.Session) error {
+	if m.sessions == nil {
+		m.sessions = make(map[string]reading.Session)
+	}
+
+	m.sessions[session.ID] = session
+	return m.err
+}
+
+func (m *MockSessionRepository) Get(_ context.Context, id string) (reading.Session, error) {
+	if m.err != nil {
+		return reading.Session{}, m.err
+	}
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return reading.Session{}, reading.ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (m *MockSessionRepository) Commit(ctx context.Context, id string, from, to int64, rows int) (reading.Session, error) {
+	session, err := m.Get(ctx, id)
+	switch {
+	case err != nil:
+		return session, err
+	case session.FinalizedAt != nil:
+		return session, reading.ErrSessionFinalized
+	case session.Offset != from:
+		return session, reading.ErrOffsetMismatch
+	}
+
+	session.Offset = to
+	session.Rows = rows
+	m.sessions[id] = session
+	return session, nil
+}
+
+func (m *MockSessionRepository) Finalize(ctx context.Context, id string, offset int64) (reading.Session, error) {
+	session, err := m.Get(ctx, id)
+	switch {
+	case err != nil:
+		return session, err
+	case session.FinalizedAt != nil:
+		return session, nil
+	case session.Offset != offset:
+		return session, reading.ErrOffsetMismatch
+	}
+
+	now := time.Now()
+	session.FinalizedAt = &now
+	m.sessions[id] = session
+	return session, nil
+}
+
+func (m *MockJobRepository) Create(_ context.Context, job reading.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.jobs == nil {
+		m.jobs = make(map[string]reading.Job)
+	}
+
+	m.jobs[job.ID] = job
+	return m.err
+}
+
+func (m *MockJobRepository) Get(_ context.Context, id string) (reading.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return reading.Job{}, m.err
+	}
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return reading.Job{}, reading.ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+func (m *MockJobRepository) Claim(_ context.Context, _ time.Duration) (reading.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := make([]reading.Job, 0)
+	for _, job := range m.jobs {
+		if job.Status == reading.JobStatusPending {
+			pending = append(pending, job)
+		}
+	}
+
+	if len(pending) == 0 {
+		if m.empty != nil {
+			m.empty()
+		}
+
+		return reading.Job{}, reading.ErrNoJobs
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	job := pending[0]
+	job.Status = reading.JobStatusRunning
+	m.jobs[job.ID] = job
+	m.claimed = append(m.claimed, job.ID)
+	return job, nil
+}
+
+func (m *MockJobRepository) Update(_ context.Context, job reading.Job, previous time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reclaimed || !m.jobs[job.ID].UpdatedAt.Equal(previous) {
+		return reading.ErrJobReclaimed
+	}
+
+	m.jobs[job.ID] = job
+	return m.err
+}
+
+func (m *MockBlobStore) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+	if m.blobs == nil {
+		m.blobs = make(map[string][]byte)
+	}
+
+	return &MockBlob{ctx: ctx, name: name, store: m}, nil
+}
+
+func (m *MockBlobStore) NewReader(_ context.Context, name string) (io.ReadCloser, error) {
+	data, ok := m.blobs[name]
+	if !ok {
+		return nil, blob.ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MockBlobStore) Delete(_ context.Context, name string) error {
+	delete(m.blobs, name)
+	m.deleted = append(m.deleted, name)
+	return nil
+}
+
+func (m *MockBlob) Close() error {
+	// Like a real blob, the contents are discarded if the context is cancelled before the blob is closed.
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.blobs[m.name] = m.Bytes()
+	return nil
+}
@@ -3,6 +3,10 @@ package reading
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cloud-lada/backend/pkg/postgres"
@@ -24,31 +28,81 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-// Save the reading to the database. If a reading already exists for the sensor at the given timestamp, do nothing.
+// Save the reading to the database. If a reading already exists for the vehicle's sensor at the given timestamp, do
+// nothing.
 func (pr *PostgresRepository) Save(ctx context.Context, reading Reading) error {
 	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
 		const q = `
-			INSERT INTO reading (sensor, value, timestamp) VALUES ($1, $2, $3)
-			ON CONFLICT (sensor, timestamp) DO NOTHING
+			INSERT INTO reading (vehicle, sensor, value, timestamp) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (vehicle, sensor, timestamp) DO NOTHING
 		`
 
-		_, err := tx.ExecContext(ctx, q, reading.Sensor, reading.Value, reading.Timestamp)
+		_, err := tx.ExecContext(ctx, q, reading.Vehicle, reading.Sensor, reading.Value, reading.Timestamp)
 		return err
 	})
 }
 
-// ForEachOnDate iterates through all readings stored in the database on the date component of the given time. For
-// each record, the ForEachFunc is invoked. Iteration will stop when there are no more records, the context is
-// cancelled or the ForEachFunc returns an error. Readings are processed in batches of 100 at the time.
-func (pr *PostgresRepository) ForEachOnDate(ctx context.Context, date time.Time, fn ForEachFunc) error {
+// The maximum number of readings inserted per statement when calling PostgresRepository.SaveBatch. Postgres limits
+// the number of parameters in a single statement to 65535, so this keeps us comfortably below that.
+const maxBatchInsert = 1000
+
+// SaveBatch saves multiple readings to the database within a single transaction. Readings that already exist for
+// a vehicle's sensor at a given timestamp are ignored.
+func (pr *PostgresRepository) SaveBatch(ctx context.Context, readings []Reading) error {
+	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		for start := 0; start < len(readings); start += maxBatchInsert {
+			end := start + maxBatchInsert
+			if end > len(readings) {
+				end = len(readings)
+			}
+
+			if err := pr.insert(ctx, tx, readings[start:end]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (pr *PostgresRepository) insert(ctx context.Context, tx *sql.Tx, readings []Reading) error {
+	q := strings.Builder{}
+	q.WriteString("INSERT INTO reading (vehicle, sensor, value, timestamp) VALUES ")
+
+	args := make([]interface{}, 0, len(readings)*4)
+	for i, reading := range readings {
+		if i > 0 {
+			q.WriteString(", ")
+		}
+
+		n := len(args)
+		fmt.Fprintf(&q, "($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+		args = append(args, reading.Vehicle, reading.Sensor, reading.Value, reading.Timestamp)
+	}
+
+	q.WriteString(" ON CONFLICT (vehicle, sensor, timestamp) DO NOTHING")
+
+	_, err := tx.ExecContext(ctx, q.String(), args...)
+	return err
+}
+
+// ForEachOnDate iterates through all readings for a vehicle stored in the database on the date component of the
+// given time. The boundaries of the day are determined using the location of the given time, so days may be shorter
+// or longer than 24 hours around daylight saving time transitions. For each record, the ForEachFunc is invoked.
+// Iteration will stop when there are no more records, the context is cancelled or the ForEachFunc returns an error.
+// Readings are processed in batches of 100 at the time.
+func (pr *PostgresRepository) ForEachOnDate(ctx context.Context, vehicle string, date time.Time, fn ForEachFunc) error {
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	end := start.AddDate(0, 0, 1)
+
 	return postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
 		const cursorQuery = `
 			DECLARE reading_cursor CURSOR FOR 
-			    SELECT sensor, value, timestamp FROM reading
-				WHERE timestamp >= $1::DATE AND timestamp < ($1::DATE + INTERVAL '1 day')
+			    SELECT vehicle, sensor, value, timestamp FROM reading
+				WHERE vehicle = $1 AND timestamp >= $2 AND timestamp < $3
 		`
 
-		if _, err := tx.ExecContext(ctx, cursorQuery, date); err != nil {
+		if _, err := tx.ExecContext(ctx, cursorQuery, vehicle, start, end); err != nil {
 			return err
 		}
 
@@ -67,7 +121,7 @@ func (pr *PostgresRepository) ForEachOnDate(ctx context.Context, date time.Time,
 				}
 
 				var reading Reading
-				if err = rows.Scan(&reading.Sensor, &reading.Value, &reading.Timestamp); err != nil {
+				if err = rows.Scan(&reading.Vehicle, &reading.Sensor, &reading.Value, &reading.Timestamp); err != nil {
 					return err
 				}
 
@@ -86,3 +140,319 @@ func (pr *PostgresRepository) ForEachOnDate(ctx context.Context, date time.Time,
 		}
 	})
 }
+
+type (
+	// The PostgresSessionRepository type is a SessionRepository implementation that persists upload sessions into a
+	// PostgreSQL instance.
+	PostgresSessionRepository struct {
+		db *sql.DB
+	}
+)
+
+// NewPostgresSessionRepository returns a new instance of the PostgresSessionRepository type that will perform
+// queries against the provided sql.DB instance.
+func NewPostgresSessionRepository(db *sql.DB) *PostgresSessionRepository {
+	return &PostgresSessionRepository{db: db}
+}
+
+// Create a new upload session.
+func (pr *PostgresSessionRepository) Create(ctx context.Context, session Session) error {
+	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `
+			INSERT INTO upload_session (id, content_type, vehicle, device_id, committed_offset, row_count, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+
+		_, err := tx.ExecContext(ctx, q,
+			session.ID,
+			session.ContentType,
+			session.Vehicle,
+			session.DeviceID,
+			session.Offset,
+			session.Rows,
+			session.CreatedAt,
+		)
+
+		return err
+	})
+}
+
+// Get an upload session by its identifier. Returns ErrSessionNotFound if the session does not exist.
+func (pr *PostgresSessionRepository) Get(ctx context.Context, id string) (Session, error) {
+	var session Session
+	err := postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		session, err = pr.get(ctx, tx, id, false)
+		return err
+	})
+
+	return session, err
+}
+
+// Commit advances the offset of an upload session from one position to another, recording the total number of rows
+// processed. The session's current offset must match the from position, otherwise ErrOffsetMismatch is returned
+// alongside the current state of the session. This prevents concurrent appends from committing overlapping chunks.
+// Returns ErrSessionFinalized if the session has been finalized, or ErrSessionNotFound if it does not exist.
+func (pr *PostgresSessionRepository) Commit(ctx context.Context, id string, from, to int64, rows int) (Session, error) {
+	var session Session
+	err := postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		// Lock the session so that the offset can't change between our check & update.
+		session, err = pr.get(ctx, tx, id, true)
+		switch {
+		case err != nil:
+			return err
+		case session.FinalizedAt != nil:
+			return ErrSessionFinalized
+		case session.Offset != from:
+			return ErrOffsetMismatch
+		}
+
+		const q = `UPDATE upload_session SET committed_offset = $2, row_count = $3 WHERE id = $1`
+		if _, err = tx.ExecContext(ctx, q, id, to, rows); err != nil {
+			return err
+		}
+
+		session.Offset = to
+		session.Rows = rows
+		return nil
+	})
+
+	return session, err
+}
+
+// Finalize an upload session, preventing any further chunks from being appended. The offset must match the
+// session's committed offset, otherwise ErrOffsetMismatch is returned alongside the current state of the session.
+// Finalizing an already finalized session has no effect. Returns ErrSessionNotFound if the session does not exist.
+func (pr *PostgresSessionRepository) Finalize(ctx context.Context, id string, offset int64) (Session, error) {
+	var session Session
+	err := postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		session, err = pr.get(ctx, tx, id, true)
+		switch {
+		case err != nil:
+			return err
+		case session.FinalizedAt != nil:
+			return nil
+		case session.Offset != offset:
+			return ErrOffsetMismatch
+		}
+
+		const q = `UPDATE upload_session SET finalized_at = $2 WHERE id = $1`
+
+		finalizedAt := time.Now().UTC()
+		if _, err = tx.ExecContext(ctx, q, id, finalizedAt); err != nil {
+			return err
+		}
+
+		session.FinalizedAt = &finalizedAt
+		return nil
+	})
+
+	return session, err
+}
+
+func (pr *PostgresSessionRepository) get(ctx context.Context, tx *sql.Tx, id string, lock bool) (Session, error) {
+	q := `
+		SELECT id, content_type, vehicle, device_id, committed_offset, row_count, created_at, finalized_at
+		FROM upload_session WHERE id = $1
+	`
+
+	if lock {
+		q += " FOR UPDATE"
+	}
+
+	var session Session
+	var finalizedAt sql.NullTime
+
+	err := tx.QueryRowContext(ctx, q, id).Scan(
+		&session.ID,
+		&session.ContentType,
+		&session.Vehicle,
+		&session.DeviceID,
+		&session.Offset,
+		&session.Rows,
+		&session.CreatedAt,
+		&finalizedAt,
+	)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return session, ErrSessionNotFound
+	case err != nil:
+		return session, err
+	}
+
+	if finalizedAt.Valid {
+		session.FinalizedAt = &finalizedAt.Time
+	}
+
+	return session, nil
+}
+
+type (
+	// The PostgresJobRepository type is a JobRepository implementation that persists asynchronous ingest jobs into a
+	// PostgreSQL instance.
+	PostgresJobRepository struct {
+		db *sql.DB
+	}
+)
+
+// NewPostgresJobRepository returns a new instance of the PostgresJobRepository type that will perform queries
+// against the provided sql.DB instance.
+func NewPostgresJobRepository(db *sql.DB) *PostgresJobRepository {
+	return &PostgresJobRepository{db: db}
+}
+
+const jobColumns = `
+	id, status, content_type, vehicle, content_encoding, device_id, row_count, valid_count, invalid_count, errors,
+	created_at, updated_at, finished_at
+`
+
+// Create a new ingest job.
+func (pr *PostgresJobRepository) Create(ctx context.Context, job Job) error {
+	errs, err := json.Marshal(job.errors())
+	if err != nil {
+		return err
+	}
+
+	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `INSERT INTO ingest_job (` + jobColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+		_, err = tx.ExecContext(ctx, q,
+			job.ID,
+			job.Status,
+			job.ContentType,
+			job.Vehicle,
+			job.ContentEncoding,
+			job.DeviceID,
+			job.Rows,
+			job.Valid,
+			job.Invalid,
+			errs,
+			job.CreatedAt,
+			job.UpdatedAt,
+			job.FinishedAt,
+		)
+
+		return err
+	})
+}
+
+// Get an ingest job by its identifier. Returns ErrJobNotFound if the job does not exist.
+func (pr *PostgresJobRepository) Get(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := postgres.WithinReadOnlyTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		const q = `SELECT ` + jobColumns + ` FROM ingest_job WHERE id = $1`
+
+		job, err = scanJob(tx.QueryRowContext(ctx, q, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrJobNotFound
+		}
+
+		return err
+	})
+
+	return job, err
+}
+
+// Claim the oldest job that is waiting to be processed, marking it as running. Jobs that are running but have not
+// been updated within the lease are assumed to belong to a worker that has died, and can also be claimed. Jobs that
+// are locked by other workers are skipped, so multiple workers can claim jobs concurrently. Returns ErrNoJobs if
+// there are no jobs to claim.
+func (pr *PostgresJobRepository) Claim(ctx context.Context, lease time.Duration) (Job, error) {
+	var job Job
+	err := postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) (err error) {
+		const q = `
+			UPDATE ingest_job SET status = $1, updated_at = $2
+			WHERE id = (
+				SELECT id FROM ingest_job
+				WHERE status = $3 OR (status = $1 AND updated_at < $4)
+				ORDER BY created_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + jobColumns
+
+		now := time.Now().UTC()
+		job, err = scanJob(tx.QueryRowContext(ctx, q, JobStatusRunning, now, JobStatusPending, now.Add(-lease)))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoJobs
+		}
+
+		return err
+	})
+
+	return job, err
+}
+
+// Update the status & progress of an ingest job. The previous time is the time the job was last updated, as known to
+// the caller. Returns ErrJobReclaimed if the job has been updated since then.
+func (pr *PostgresJobRepository) Update(ctx context.Context, job Job, previous time.Time) error {
+	errs, err := json.Marshal(job.errors())
+	if err != nil {
+		return err
+	}
+
+	return postgres.WithinTransaction(ctx, pr.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `
+			UPDATE ingest_job SET
+				status = $2, row_count = $3, valid_count = $4, invalid_count = $5, errors = $6, updated_at = $7,
+				finished_at = $8
+			WHERE id = $1 AND updated_at = $9
+		`
+
+		result, err := tx.ExecContext(ctx, q,
+			job.ID,
+			job.Status,
+			job.Rows,
+			job.Valid,
+			job.Invalid,
+			errs,
+			job.UpdatedAt,
+			job.FinishedAt,
+			previous,
+		)
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		switch {
+		case err != nil:
+			return err
+		case updated == 0:
+			return ErrJobReclaimed
+		default:
+			return nil
+		}
+	})
+}
+
+func scanJob(row *sql.Row) (Job, error) {
+	var job Job
+	var errs []byte
+	var finishedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID,
+		&job.Status,
+		&job.ContentType,
+		&job.Vehicle,
+		&job.ContentEncoding,
+		&job.DeviceID,
+		&job.Rows,
+		&job.Valid,
+		&job.Invalid,
+		&errs,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return job, err
+	}
+
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return job, json.Unmarshal(errs, &job.Errors)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/cloud-lada/backend/pkg/testutil"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +24,7 @@ func TestPostgresRepository_Save(t *testing.T) {
 
 	t.Run("It should store a reading", func(t *testing.T) {
 		assert.NoError(t, repo.Save(ctx, reading.Reading{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     100,
 			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -31,6 +33,7 @@ func TestPostgresRepository_Save(t *testing.T) {
 
 	t.Run("It should not error for a duplicate reading", func(t *testing.T) {
 		assert.NoError(t, repo.Save(ctx, reading.Reading{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     100,
 			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -38,6 +41,46 @@ func TestPostgresRepository_Save(t *testing.T) {
 	})
 }
 
+func TestPostgresRepository_SaveBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := reading.NewPostgresRepository(db)
+
+	readings := []reading.Reading{
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     100,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     100,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeFuel,
+			Value:     50,
+			Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	t.Run("It should store a batch of readings", func(t *testing.T) {
+		assert.NoError(t, repo.SaveBatch(ctx, readings))
+	})
+
+	t.Run("It should not error for duplicate readings", func(t *testing.T) {
+		assert.NoError(t, repo.SaveBatch(ctx, readings))
+	})
+}
+
 func TestPostgresRepository_ForEachOnDate(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
@@ -51,11 +94,19 @@ func TestPostgresRepository_ForEachOnDate(t *testing.T) {
 	now := time.Now().UTC()
 	readings := []reading.Reading{
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     50,
 			Timestamp: now.Add(-time.Hour * 24),
 		},
 		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     100,
+			Timestamp: now,
+		},
+		{
+			Vehicle:   "support",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     100,
 			Timestamp: now,
@@ -66,10 +117,200 @@ func TestPostgresRepository_ForEachOnDate(t *testing.T) {
 		require.NoError(t, repo.Save(ctx, r))
 	}
 
-	assert.NoError(t, repo.ForEachOnDate(ctx, now, func(ctx context.Context, reading reading.Reading) error {
+	assert.NoError(t, repo.ForEachOnDate(ctx, "lada", now, func(ctx context.Context, reading reading.Reading) error {
+		assert.EqualValues(t, readings[1].Vehicle, reading.Vehicle)
 		assert.EqualValues(t, readings[1].Sensor, reading.Sensor)
 		assert.EqualValues(t, readings[1].Value, reading.Value)
 		assert.EqualValues(t, readings[1].Timestamp.Unix(), reading.Timestamp.Unix())
 		return nil
 	}))
 }
+
+func TestPostgresRepository_ForEachOnDateTimezone(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := reading.NewPostgresRepository(db)
+
+	location, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// The clocks went forward in New York on the 13th of March 2022, so the day runs from 05:00 UTC on the 13th to
+	// 04:00 UTC on the 14th.
+	readings := []reading.Reading{
+		{
+			Vehicle:   "tz",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     1,
+			Timestamp: time.Date(2022, 3, 13, 4, 30, 0, 0, time.UTC),
+		},
+		{
+			Vehicle:   "tz",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     2,
+			Timestamp: time.Date(2022, 3, 14, 3, 30, 0, 0, time.UTC),
+		},
+		{
+			Vehicle:   "tz",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     3,
+			Timestamp: time.Date(2022, 3, 14, 4, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, r := range readings {
+		require.NoError(t, repo.Save(ctx, r))
+	}
+
+	var actual []float64
+	date := time.Date(2022, 3, 13, 0, 0, 0, 0, location)
+	require.NoError(t, repo.ForEachOnDate(ctx, "tz", date, func(ctx context.Context, reading reading.Reading) error {
+		actual = append(actual, reading.Value)
+		return nil
+	}))
+
+	assert.EqualValues(t, []float64{2}, actual)
+}
+
+func TestPostgresSessionRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := reading.NewPostgresSessionRepository(db)
+
+	session := reading.Session{
+		ID:          uuid.NewString(),
+		ContentType: "application/stream+json",
+		Vehicle:     "lada",
+		DeviceID:    "test",
+		CreatedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("It should create a session", func(t *testing.T) {
+		require.NoError(t, repo.Create(ctx, session))
+
+		actual, err := repo.Get(ctx, session.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, session.ID, actual.ID)
+		assert.EqualValues(t, session.Vehicle, actual.Vehicle)
+		assert.EqualValues(t, session.DeviceID, actual.DeviceID)
+		assert.True(t, session.CreatedAt.Equal(actual.CreatedAt))
+	})
+
+	t.Run("It should commit offsets", func(t *testing.T) {
+		actual, err := repo.Commit(ctx, session.ID, 0, 100, 2)
+		require.NoError(t, err)
+		assert.EqualValues(t, 100, actual.Offset)
+		assert.EqualValues(t, 2, actual.Rows)
+	})
+
+	t.Run("It should return an error for a mismatched offset", func(t *testing.T) {
+		actual, err := repo.Commit(ctx, session.ID, 0, 100, 2)
+		assert.ErrorIs(t, err, reading.ErrOffsetMismatch)
+		assert.EqualValues(t, 100, actual.Offset)
+
+		_, err = repo.Finalize(ctx, session.ID, 50)
+		assert.ErrorIs(t, err, reading.ErrOffsetMismatch)
+	})
+
+	t.Run("It should finalize a session", func(t *testing.T) {
+		actual, err := repo.Finalize(ctx, session.ID, 100)
+		require.NoError(t, err)
+		assert.NotNil(t, actual.FinalizedAt)
+
+		_, err = repo.Commit(ctx, session.ID, 100, 200, 4)
+		assert.ErrorIs(t, err, reading.ErrSessionFinalized)
+	})
+
+	t.Run("It should return an error for an unknown session", func(t *testing.T) {
+		_, err := repo.Get(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, reading.ErrSessionNotFound)
+	})
+}
+
+func TestPostgresJobRepository(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := reading.NewPostgresJobRepository(db)
+
+	job := reading.Job{
+		ID:          uuid.NewString(),
+		Status:      reading.JobStatusPending,
+		ContentType: "application/stream+json",
+		Vehicle:     "lada",
+		DeviceID:    "test",
+		CreatedAt:   time.Now().UTC(),
+		UpdatedAt:   time.Now().UTC(),
+	}
+
+	t.Run("It should create a job", func(t *testing.T) {
+		require.NoError(t, repo.Create(ctx, job))
+
+		actual, err := repo.Get(ctx, job.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, job.ID, actual.ID)
+		assert.EqualValues(t, reading.JobStatusPending, actual.Status)
+		assert.EqualValues(t, job.Vehicle, actual.Vehicle)
+	})
+
+	t.Run("It should claim a pending job once", func(t *testing.T) {
+		actual, err := repo.Claim(ctx, time.Minute)
+		require.NoError(t, err)
+		assert.EqualValues(t, job.ID, actual.ID)
+		assert.EqualValues(t, reading.JobStatusRunning, actual.Status)
+
+		_, err = repo.Claim(ctx, time.Minute)
+		assert.ErrorIs(t, err, reading.ErrNoJobs)
+	})
+
+	t.Run("It should reclaim a job whose lease has expired", func(t *testing.T) {
+		actual, err := repo.Claim(ctx, -time.Minute)
+		require.NoError(t, err)
+		assert.EqualValues(t, job.ID, actual.ID)
+	})
+
+	t.Run("It should update a job", func(t *testing.T) {
+		current, err := repo.Get(ctx, job.ID)
+		require.NoError(t, err)
+
+		finishedAt := time.Now().UTC()
+
+		job.Status = reading.JobStatusComplete
+		job.Rows = 3
+		job.Valid = 2
+		job.Invalid = 1
+		job.Errors = []string{"row 2: invalid reading"}
+		job.FinishedAt = &finishedAt
+		job.UpdatedAt = time.Now().UTC()
+		require.NoError(t, repo.Update(ctx, job, current.UpdatedAt))
+
+		actual, err := repo.Get(ctx, job.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, job.Status, actual.Status)
+		assert.EqualValues(t, job.Rows, actual.Rows)
+		assert.EqualValues(t, job.Errors, actual.Errors)
+		assert.NotNil(t, actual.FinishedAt)
+	})
+
+	t.Run("It should not update a job that has been updated since it was read", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Update(ctx, job, job.CreatedAt), reading.ErrJobReclaimed)
+	})
+
+	t.Run("It should return an error for an unknown job", func(t *testing.T) {
+		_, err := repo.Get(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, reading.ErrJobNotFound)
+	})
+}
@@ -3,13 +3,18 @@
 package reading
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"time"
+
+	"github.com/cloud-lada/backend/pkg/units"
 )
 
 type (
 	// The Reading type describes a single sensor reading as stored in the database.
 	Reading struct {
+		Vehicle   string     `json:"vehicle"`
 		Sensor    SensorType `json:"sensor"`
 		Value     float64    `json:"value"`
 		Timestamp time.Time  `json:"timestamp"`
@@ -17,8 +22,39 @@ type (
 
 	// The SensorType type describes the kind of sensor that the value relates to.
 	SensorType string
+
+	// The SensorRule type describes the range of values a sensor can plausibly produce, and when it can plausibly
+	// produce them. Values outside of this range are assumed to be caused by faulty hardware. Values are always
+	// recorded in the sensor's canonical unit.
+	SensorRule struct {
+		Min  float64
+		Max  float64
+		Unit units.Unit
+		// The earliest timestamp a reading can plausibly have. Anything earlier is likely to be from a device whose
+		// clock has reset.
+		MinTimestamp time.Time
+		// How far into the future a reading's timestamp can be, this allows for some drift between device clocks.
+		MaxFutureSkew time.Duration
+	}
+
+	// The SensorRegistry interface describes types that can look up the SensorRule for a sensor. A sensor that has no
+	// SensorRule is not a valid sensor.
+	SensorRegistry interface {
+		Rule(sensor SensorType) (SensorRule, bool)
+	}
+
+	// The SensorRules type is a SensorRegistry implementation backed by a fixed set of SensorRule values.
+	SensorRules map[SensorType]SensorRule
 )
 
+// SchemaVersion is the version of the Reading schema used when publishing readings as events. It should be incremented
+// whenever the JSON representation of a Reading changes in a way that is not backwards compatible.
+const SchemaVersion = "2"
+
+// DefaultVehicle is the identifier of the vehicle that readings belong to if they were produced before multiple
+// vehicles were supported.
+const DefaultVehicle = "lada"
+
 // Constants for sensor types.
 const (
 	SensorTypeSpeed             = SensorType("speed")
@@ -29,28 +65,69 @@ const (
 	SensorTypeLocationLongitude = SensorType("location_longitude")
 )
 
-var validSensorTypes = map[SensorType]struct{}{
-	SensorTypeSpeed:             {},
-	SensorTypeFuel:              {},
-	SensorTypeRevolution:        {},
-	SensorTypeEngineTemperature: {},
-	SensorTypeLocationLatitude:  {},
-	SensorTypeLocationLongitude: {},
+// DefaultMinTimestamp is the SensorRule.MinTimestamp used for sensors that don't need one of their own.
+var DefaultMinTimestamp = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultMaxFutureSkew is the SensorRule.MaxFutureSkew used for sensors that don't need one of their own.
+const DefaultMaxFutureSkew = time.Minute * 5
+
+// DefaultSensorRules contains the SensorRule for each of the built-in sensor types. It is used when no other
+// SensorRegistry is available.
+var DefaultSensorRules = SensorRules{
+	SensorTypeSpeed:             NewSensorRule(0, 250, units.KilometresPerHour),
+	SensorTypeFuel:              NewSensorRule(0, 100, "%"),
+	SensorTypeRevolution:        NewSensorRule(0, 10000, "rpm"),
+	SensorTypeEngineTemperature: NewSensorRule(-50, 200, units.Celsius),
+	SensorTypeLocationLatitude:  NewSensorRule(-90, 90, "°"),
+	SensorTypeLocationLongitude: NewSensorRule(-180, 180, "°"),
+}
+
+// NewSensorRule returns a SensorRule for the range of values, in the given unit, that accepts timestamps from
+// DefaultMinTimestamp until DefaultMaxFutureSkew into the future.
+func NewSensorRule(min, max float64, unit units.Unit) SensorRule {
+	return SensorRule{
+		Min:           min,
+		Max:           max,
+		Unit:          unit,
+		MinTimestamp:  DefaultMinTimestamp,
+		MaxFutureSkew: DefaultMaxFutureSkew,
+	}
 }
 
 // String returns a string representation of the reading.
 func (r Reading) String() string {
-	return fmt.Sprint(r.Sensor, " ", r.Value, r.Timestamp)
+	return fmt.Sprint(r.Vehicle, " ", r.Sensor, " ", r.Value, r.Timestamp)
 }
 
-// Valid returns true if the Reading is deemed to be in a valid state. This means a valid sensor type and a non-zero
-// timestamp.
-func (r Reading) Valid() bool {
-	return r.Sensor.Valid() && !r.Timestamp.IsZero()
+// Validate returns a non-nil error describing why the Reading is invalid, if it is. A valid reading has a vehicle,
+// a sensor known to the SensorRegistry, a finite value within the range of the sensor's SensorRule and a timestamp
+// that is neither earlier than the SensorRule allows nor further into the future.
+func (r Reading) Validate(sensors SensorRegistry) error {
+	rule, ok := sensors.Rule(r.Sensor)
+	now := time.Now()
+
+	switch {
+	case r.Vehicle == "":
+		return errors.New("no vehicle")
+	case !ok:
+		return fmt.Errorf("unknown sensor %q", r.Sensor)
+	case math.IsNaN(r.Value) || math.IsInf(r.Value, 0):
+		return fmt.Errorf("value %v is not a finite number", r.Value)
+	case r.Value < rule.Min || r.Value > rule.Max:
+		return fmt.Errorf("value %v is outside of the range %v to %v for %s", r.Value, rule.Min, rule.Max, r.Sensor)
+	case r.Timestamp.IsZero():
+		return errors.New("no timestamp")
+	case r.Timestamp.Before(rule.MinTimestamp):
+		return fmt.Errorf("timestamp %s is before %s", r.Timestamp.Format(time.RFC3339), rule.MinTimestamp.Format(time.RFC3339))
+	case r.Timestamp.After(now.Add(rule.MaxFutureSkew)):
+		return fmt.Errorf("timestamp %s is in the future", r.Timestamp.Format(time.RFC3339))
+	default:
+		return nil
+	}
 }
 
-// Valid returns true if the SensorType is one of the valid types of sensor.
-func (st SensorType) Valid() bool {
-	_, ok := validSensorTypes[st]
-	return ok
+// Rule returns the SensorRule for a sensor, and false if the sensor is not one of the built-in sensor types.
+func (sr SensorRules) Rule(sensor SensorType) (SensorRule, bool) {
+	rule, ok := sr[sensor]
+	return rule, ok
 }
@@ -1,6 +1,7 @@
 package reading_test
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -8,34 +9,148 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestReading_Valid(t *testing.T) {
+func TestReading_Validate(t *testing.T) {
 	t.Parallel()
 
 	tt := []struct {
 		Name     string
 		Input    reading.Reading
+		Sensors  reading.SensorRegistry
 		Expected bool
 	}{
 		{
 			Name:     "It should return true for a valid reading",
 			Expected: true,
 			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
 				Sensor:    reading.SensorTypeSpeed,
 				Value:     100,
 				Timestamp: time.Now(),
 			},
 		},
+		{
+			Name: "It should return false for a missing vehicle",
+			Input: reading.Reading{
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     100,
+				Timestamp: time.Now(),
+			},
+		},
+		{
+			Name:     "It should return true for a sensor known to the registry",
+			Expected: true,
+			Sensors: reading.SensorRules{
+				"oil_pressure": {Min: 0, Max: 10},
+			},
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    "oil_pressure",
+				Value:     4,
+				Timestamp: time.Now(),
+			},
+		},
 		{
 			Name: "It should return false for an invalid sensor",
 			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
 				Sensor:    "invalid",
 				Value:     100,
 				Timestamp: time.Now(),
 			},
 		},
+		{
+			Name: "It should return false for a value below the sensor's range",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     -4000,
+				Timestamp: time.Now(),
+			},
+		},
+		{
+			Name: "It should return false for a value above the sensor's range",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeLocationLatitude,
+				Value:     700,
+				Timestamp: time.Now(),
+			},
+		},
+		{
+			Name: "It should return false for a NaN value",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeFuel,
+				Value:     math.NaN(),
+				Timestamp: time.Now(),
+			},
+		},
+		{
+			Name: "It should return false for an infinite value",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeFuel,
+				Value:     math.Inf(1),
+				Timestamp: time.Now(),
+			},
+		},
+		{
+			Name: "It should return false for a timestamp in the future",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     100,
+				Timestamp: time.Now().Add(time.Hour),
+			},
+		},
+		{
+			Name:     "It should allow for clock skew",
+			Expected: true,
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     100,
+				Timestamp: time.Now().Add(time.Minute),
+			},
+		},
+		{
+			Name: "It should return false for an implausibly old timestamp",
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     100,
+				Timestamp: time.Unix(0, 0),
+			},
+		},
+		{
+			Name:     "It should use the timestamp bounds of the sensor's rule",
+			Expected: true,
+			Sensors: reading.SensorRules{
+				"oil_pressure": {Min: 0, Max: 10, MinTimestamp: time.Unix(0, 0), MaxFutureSkew: time.Hour * 2},
+			},
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    "oil_pressure",
+				Value:     4,
+				Timestamp: time.Now().Add(time.Hour),
+			},
+		},
+		{
+			Name: "It should return false for a timestamp before the sensor's rule allows",
+			Sensors: reading.SensorRules{
+				"oil_pressure": {Min: 0, Max: 10, MinTimestamp: time.Now().Add(-time.Hour), MaxFutureSkew: time.Minute},
+			},
+			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
+				Sensor:    "oil_pressure",
+				Value:     4,
+				Timestamp: time.Now().Add(-time.Hour * 2),
+			},
+		},
 		{
 			Name: "It should return false for a zero timestamp",
 			Input: reading.Reading{
+				Vehicle:   reading.DefaultVehicle,
 				Sensor:    reading.SensorTypeRevolution,
 				Value:     100,
 				Timestamp: time.Time{},
@@ -45,7 +160,13 @@ func TestReading_Valid(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			assert.EqualValues(t, tc.Expected, tc.Input.Valid())
+			sensors := tc.Sensors
+			if sensors == nil {
+				sensors = reading.DefaultSensorRules
+			}
+
+			err := tc.Input.Validate(sensors)
+			assert.EqualValues(t, tc.Expected, err == nil)
 		})
 	}
 }
@@ -0,0 +1,351 @@
+package reading
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type (
+	// The Session type describes a resumable upload of readings. Readings are appended to a session in chunks, each
+	// of which must start at the session's committed offset. This allows an interrupted upload to resume from exactly
+	// where it stopped.
+	Session struct {
+		// The unique identifier of the session.
+		ID string `json:"id"`
+		// The format of the readings within the upload, either a JSON stream or CSV.
+		ContentType string `json:"content_type"`
+		// The identifier of the vehicle that the readings belong to.
+		Vehicle string `json:"vehicle"`
+		// The identifier of the device performing the upload, if known.
+		DeviceID string `json:"device_id,omitempty"`
+		// The number of bytes of the upload that have been processed. The next chunk must start at this offset.
+		Offset int64 `json:"offset"`
+		// The number of rows that have been processed.
+		Rows int `json:"rows"`
+		// The time at which the session was created.
+		CreatedAt time.Time `json:"created_at"`
+		// The time at which the session was finalized. Once finalized, no more chunks can be appended.
+		FinalizedAt *time.Time `json:"finalized_at,omitempty"`
+	}
+
+	// The SessionRepository interface describes types that can persist the state of upload sessions.
+	SessionRepository interface {
+		Create(ctx context.Context, session Session) error
+		Get(ctx context.Context, id string) (Session, error)
+		Commit(ctx context.Context, id string, from, to int64, rows int) (Session, error)
+		Finalize(ctx context.Context, id string, offset int64) (Session, error)
+	}
+)
+
+var (
+	// ErrSessionNotFound is the error returned when an upload session does not exist.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrOffsetMismatch is the error returned when a chunk does not start at the session's committed offset.
+	ErrOffsetMismatch = errors.New("offset does not match the session's committed offset")
+	// ErrSessionFinalized is the error returned when attempting to append to a finalized session.
+	ErrSessionFinalized = errors.New("session has been finalized")
+)
+
+// The header used to communicate upload offsets in both requests and responses.
+const headerUploadOffset = "Upload-Offset"
+
+// CreateSession handles an inbound HTTP POST request that creates a new upload session. The Content-Type header
+// determines the format of the readings that will be appended to the session. The new session is returned with a 201
+// status code.
+func (h *HTTP) CreateSession(w http.ResponseWriter, r *http.Request) {
+	vehicle, ok := middleware.Vehicle(r.Context())
+	if !ok {
+		http.Error(w, errNoVehicle.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	contentType := mediaType(r)
+	switch contentType {
+	case contentTypeJSONStream, contentTypeCSV:
+		break
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type %q", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	session := Session{
+		ID:          uuid.NewString(),
+		ContentType: contentType,
+		Vehicle:     vehicle,
+		DeviceID:    deviceID(r),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err := h.sessions.Create(r.Context(), session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/ingest/sessions/"+session.ID)
+	writeSession(w, http.StatusCreated, session)
+}
+
+// GetSession handles an inbound HTTP GET request that returns the current state of an upload session. Clients should
+// use this to determine the offset to resume an upload from.
+func (h *HTTP) GetSession(w http.ResponseWriter, r *http.Request) {
+	session, err := h.session(r)
+	switch {
+	case errors.Is(err, errNoVehicle):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeSession(w, http.StatusOK, session)
+}
+
+// AppendSession handles an inbound HTTP PATCH request that appends a chunk of readings to an upload session. The
+// Upload-Offset header must match the session's committed offset, otherwise a 409 status code is returned along with
+// the current offset. Each reading must be terminated by a newline, only complete lines are processed and any
+// trailing partial line is discarded. The committed offset is returned in the Upload-Offset header so the client
+// knows where to send the next chunk from. The chunk may be compressed using gzip or zstd, in which case offsets
+// refer to the uncompressed upload.
+func (h *HTTP) AppendSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	offset, err := strconv.ParseInt(r.Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid "+headerUploadOffset+" header", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.session(r)
+	switch {
+	case errors.Is(err, errNoVehicle):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case session.FinalizedAt != nil:
+		http.Error(w, ErrSessionFinalized.Error(), http.StatusConflict)
+		return
+	case session.Offset != offset:
+		w.Header().Set(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+		http.Error(w, ErrOffsetMismatch.Error(), http.StatusConflict)
+		return
+	}
+
+	body, err := decodeBody(r.Header.Get("Content-Encoding"), r.Body)
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer closers.Close(body)
+
+	batch := event.NewBatch(h.writer, h.batchSize, h.batchInterval)
+	namespace := uuid.MustParse(session.ID)
+	reader := bufio.NewReader(body)
+
+	var resp IngestResponse
+	var spooled bool
+	var decodeErr error
+	var committed int64
+	rows := session.Rows
+
+chunk:
+	for {
+		line, err := reader.ReadBytes('\n')
+		switch {
+		case errors.Is(err, io.EOF):
+			// Anything left is a partial line, the client will need to send it again from the committed offset.
+			break chunk
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		request := Reading{Vehicle: session.Vehicle}
+		err = decodeLine(session.ContentType, line, &request)
+		switch {
+		case errors.Is(err, io.EOF):
+			// Blank lines & CSV headers contain no reading, but still need committing.
+			committed += int64(len(line))
+			continue
+		case err != nil:
+			// A malformed row can never be processed, so we commit everything up to it and report the error.
+			decodeErr = fmt.Errorf("row %d: %w", rows+1, err)
+			break chunk
+		}
+
+		committed += int64(len(line))
+		rows++
+
+		if err = request.Validate(h.sensors); err != nil {
+			resp.Invalid = append(resp.Invalid, InvalidReading{Reading: request, Row: rows, Reason: err.Error()})
+			continue
+		}
+
+		// Event identifiers are derived from the session & row, so readings from a chunk that is retried after a
+		// failure are published with the same identifiers as before.
+		id := uuid.NewSHA1(namespace, []byte(strconv.Itoa(rows))).String()
+
+		envelope, err := newEnvelope(id, h.producer, session.CreatedAt, session.DeviceID, request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = batch.Write(ctx, envelope)
+		switch {
+		case errors.Is(err, event.ErrSpooled):
+			spooled = true
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Println("Ingested reading:", request, "as event", envelope.ID)
+	}
+
+	// All readings must be published before we commit the offset, otherwise a failure could cause readings to be
+	// skipped when the client resumes.
+	err = batch.Flush(ctx)
+	switch {
+	case errors.Is(err, event.ErrSpooled):
+		spooled = true
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err = h.sessions.Commit(ctx, session.ID, offset, offset+committed, rows)
+	switch {
+	case errors.Is(err, ErrOffsetMismatch):
+		// Another request appended to the session concurrently.
+		w.Header().Set(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrSessionFinalized):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	if decodeErr != nil {
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if spooled {
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// FinalizeSession handles an inbound HTTP POST request that marks an upload session as complete. The Upload-Offset
+// header must contain the total length of the upload, which must match the session's committed offset. This ensures
+// that the client cannot finalize a session while part of its upload remains unprocessed. Finalizing a session more
+// than once has no effect.
+func (h *HTTP) FinalizeSession(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.ParseInt(r.Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid "+headerUploadOffset+" header", http.StatusBadRequest)
+		return
+	}
+
+	// The session is fetched first to ensure it belongs to the vehicle associated with the credentials.
+	session, err := h.session(r)
+	switch {
+	case errors.Is(err, errNoVehicle):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err = h.sessions.Finalize(r.Context(), session.ID, offset)
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrOffsetMismatch):
+		w.Header().Set(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeSession(w, http.StatusOK, session)
+}
+
+// session returns the Session identified in the request path. Sessions belonging to a vehicle other than the one
+// associated with the request's credentials are treated as though they don't exist.
+func (h *HTTP) session(r *http.Request) (Session, error) {
+	vehicle, ok := middleware.Vehicle(r.Context())
+	if !ok {
+		return Session{}, errNoVehicle
+	}
+
+	id := mux.Vars(r)["id"]
+
+	// Session identifiers are always UUIDs, so there's no need to query for anything else.
+	if _, err := uuid.Parse(id); err != nil {
+		return Session{}, ErrSessionNotFound
+	}
+
+	session, err := h.sessions.Get(r.Context(), id)
+	switch {
+	case err != nil:
+		return Session{}, err
+	case session.Vehicle != vehicle:
+		return Session{}, ErrSessionNotFound
+	default:
+		return session, nil
+	}
+}
+
+func writeSession(w http.ResponseWriter, code int, session Session) {
+	w.Header().Set(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,349 @@
+package reading_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP_CreateSession(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name                string
+		ContentType         string
+		ExpectedContentType string
+		ExpectedCode        int
+	}{
+		{
+			Name:         "It should create a session for a JSON stream",
+			ContentType:  "application/stream+json",
+			ExpectedCode: http.StatusCreated,
+		},
+		{
+			Name:         "It should create a session for CSV",
+			ContentType:  "text/csv",
+			ExpectedCode: http.StatusCreated,
+		},
+		{
+			Name:                "It should ignore parameters of the content type",
+			ContentType:         "text/csv; charset=utf-8",
+			ExpectedContentType: "text/csv",
+			ExpectedCode:        http.StatusCreated,
+		},
+		{
+			Name:         "It should return unsupported media type for an unknown content type",
+			ContentType:  "application/xml",
+			ExpectedCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			router, sessions, _ := setupSessions(t)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/ingest/sessions", nil)
+			r.Header.Set("Content-Type", tc.ContentType)
+			r.Header.Set("X-Device-ID", "test")
+			r = withVehicle(r, "lada")
+
+			router.ServeHTTP(w, r)
+			require.EqualValues(t, tc.ExpectedCode, w.Code)
+
+			if tc.ExpectedCode >= http.StatusMultipleChoices {
+				assert.Empty(t, sessions.sessions)
+				return
+			}
+
+			var session reading.Session
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+			assert.EqualValues(t, "/ingest/sessions/"+session.ID, w.Header().Get("Location"))
+			assert.EqualValues(t, "0", w.Header().Get("Upload-Offset"))
+			expected := tc.ExpectedContentType
+			if expected == "" {
+				expected = tc.ContentType
+			}
+
+			assert.EqualValues(t, expected, session.ContentType)
+			assert.EqualValues(t, "test", session.DeviceID)
+			assert.EqualValues(t, "lada", session.Vehicle)
+			assert.Contains(t, sessions.sessions, session.ID)
+		})
+	}
+}
+
+func TestHTTP_AppendSession(t *testing.T) {
+	t.Parallel()
+
+	first := line(t, reading.Reading{
+		Vehicle:   "lada",
+		Sensor:    reading.SensorTypeSpeed,
+		Value:     65,
+		Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	second := line(t, reading.Reading{
+		Vehicle:   "lada",
+		Sensor:    reading.SensorTypeFuel,
+		Value:     30,
+		Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+	})
+
+	t.Run("It should resume an upload from the committed offset", func(t *testing.T) {
+		router, sessions, sink := setupSessions(t)
+		session := createSession(t, router)
+
+		// The first chunk is cut off half way through the second reading, only the first should be processed.
+		upload := append(append([]byte{}, first...), second...)
+		cut := len(first) + len(second)/2
+
+		w := appendChunk(t, router, session.ID, 0, upload[:cut])
+		require.EqualValues(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, strconv.Itoa(len(first)), w.Header().Get("Upload-Offset"))
+		assert.Len(t, sink.messages, 1)
+
+		// Resuming from the wrong offset should tell the client where to resume from.
+		w = appendChunk(t, router, session.ID, int64(cut), upload[cut:])
+		require.EqualValues(t, http.StatusConflict, w.Code)
+		assert.EqualValues(t, strconv.Itoa(len(first)), w.Header().Get("Upload-Offset"))
+
+		w = appendChunk(t, router, session.ID, int64(len(first)), upload[len(first):])
+		require.EqualValues(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, strconv.Itoa(len(upload)), w.Header().Get("Upload-Offset"))
+
+		require.Len(t, sink.messages, 2)
+		assert.EqualValues(t, bytes.TrimSpace(first), sink.messages[0].Data)
+		assert.EqualValues(t, bytes.TrimSpace(second), sink.messages[1].Data)
+		assert.EqualValues(t, 2, sessions.sessions[session.ID].Rows)
+	})
+
+	t.Run("It should publish retried readings with the same event identifiers", func(t *testing.T) {
+		router, _, sink := setupSessions(t)
+		session := createSession(t, router)
+
+		// Simulate a failure to publish, the client will retry the same chunk.
+		sink.err = io.EOF
+		w := appendChunk(t, router, session.ID, 0, first)
+		require.EqualValues(t, http.StatusInternalServerError, w.Code)
+
+		sink.err = nil
+		w = appendChunk(t, router, session.ID, 0, first)
+		require.EqualValues(t, http.StatusOK, w.Code)
+
+		require.Len(t, sink.messages, 2)
+		assert.EqualValues(t, sink.messages[0].Envelope.ID, sink.messages[1].Envelope.ID)
+		assert.EqualValues(t, session.CreatedAt, sink.messages[1].Envelope.IngestedAt)
+		assert.EqualValues(t, "test", sink.messages[1].Envelope.DeviceID)
+	})
+
+	t.Run("It should return invalid readings", func(t *testing.T) {
+		router, _, sink := setupSessions(t)
+		session := createSession(t, router)
+
+		invalid := line(t, reading.Reading{
+			Sensor:    "invalid_sensor",
+			Value:     30,
+			Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+		})
+
+		upload := append(append([]byte{}, first...), invalid...)
+
+		w := appendChunk(t, router, session.ID, 0, upload)
+		require.EqualValues(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, strconv.Itoa(len(upload)), w.Header().Get("Upload-Offset"))
+		assert.Len(t, sink.messages, 1)
+
+		var resp reading.IngestResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		require.Len(t, resp.Invalid, 1)
+		assert.EqualValues(t, 2, resp.Invalid[0].Row)
+	})
+
+	t.Run("It should commit up to a malformed row", func(t *testing.T) {
+		tt := []struct {
+			Name string
+			Line []byte
+		}{
+			{Name: "invalid JSON", Line: []byte("this will not decode\n")},
+			{Name: "trailing content", Line: []byte(string(bytes.TrimSpace(second)) + " junk\n")},
+			{Name: "multiple readings", Line: []byte(string(bytes.TrimSpace(second)) + string(second))},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.Name, func(t *testing.T) {
+				router, _, sink := setupSessions(t)
+				session := createSession(t, router)
+
+				upload := append(append([]byte{}, first...), tc.Line...)
+
+				w := appendChunk(t, router, session.ID, 0, upload)
+				require.EqualValues(t, http.StatusBadRequest, w.Code)
+				assert.EqualValues(t, strconv.Itoa(len(first)), w.Header().Get("Upload-Offset"))
+				assert.Len(t, sink.messages, 1)
+			})
+		}
+	})
+
+	t.Run("It should return not found for an unknown session", func(t *testing.T) {
+		router, _, _ := setupSessions(t)
+
+		w := appendChunk(t, router, "e1b9a5b1-3b0c-4b4e-9a57-5a5b0d3f4b1e", 0, first)
+		assert.EqualValues(t, http.StatusNotFound, w.Code)
+
+		w = appendChunk(t, router, "not-a-uuid", 0, first)
+		assert.EqualValues(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("It should return not found for a session belonging to another vehicle", func(t *testing.T) {
+		router, _, sink := setupSessions(t)
+		session := createSession(t, router)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/ingest/sessions/"+session.ID, bytes.NewReader(first))
+		r.Header.Set("Upload-Offset", "0")
+		r = withVehicle(r, "support")
+
+		router.ServeHTTP(w, r)
+		assert.EqualValues(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, sink.messages)
+	})
+
+	t.Run("It should not append to a finalized session", func(t *testing.T) {
+		router, _, _ := setupSessions(t)
+		session := createSession(t, router)
+
+		w := finalize(t, router, session.ID, 0)
+		require.EqualValues(t, http.StatusOK, w.Code)
+
+		w = appendChunk(t, router, session.ID, 0, first)
+		assert.EqualValues(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestHTTP_FinalizeSession(t *testing.T) {
+	t.Parallel()
+
+	data := line(t, reading.Reading{
+		Sensor:    reading.SensorTypeSpeed,
+		Value:     65,
+		Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	tt := []struct {
+		Name           string
+		Offset         int64
+		ExpectedCode   int
+		ExpectedOffset int
+	}{
+		{
+			Name:           "It should finalize a session that has been fully uploaded",
+			Offset:         int64(len(data)),
+			ExpectedCode:   http.StatusOK,
+			ExpectedOffset: len(data),
+		},
+		{
+			Name:           "It should return conflict if the upload is incomplete",
+			Offset:         int64(len(data) * 2),
+			ExpectedCode:   http.StatusConflict,
+			ExpectedOffset: len(data),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			router, sessions, _ := setupSessions(t)
+			session := createSession(t, router)
+
+			w := appendChunk(t, router, session.ID, 0, data)
+			require.EqualValues(t, http.StatusOK, w.Code)
+
+			w = finalize(t, router, session.ID, tc.Offset)
+			require.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, strconv.Itoa(tc.ExpectedOffset), w.Header().Get("Upload-Offset"))
+
+			if tc.ExpectedCode >= http.StatusMultipleChoices {
+				assert.Nil(t, sessions.sessions[session.ID].FinalizedAt)
+				return
+			}
+
+			assert.NotNil(t, sessions.sessions[session.ID].FinalizedAt)
+		})
+	}
+}
+
+func setupSessions(t *testing.T) (*mux.Router, *MockSessionRepository, *MockEventWriter) {
+	t.Helper()
+
+	sink := &MockEventWriter{}
+	sessions := &MockSessionRepository{}
+
+	h := reading.NewHTTP(reading.HTTPConfig{
+		Events:   sink,
+		Sessions: sessions,
+		Logger:   log.New(io.Discard, "", log.Flags()),
+	})
+
+	router := mux.NewRouter()
+	h.Register(router)
+
+	return router, sessions, sink
+}
+
+func createSession(t *testing.T, router *mux.Router) reading.Session {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/ingest/sessions", nil)
+	r.Header.Set("Content-Type", "application/stream+json")
+	r.Header.Set("X-Device-ID", "test")
+	r = withVehicle(r, "lada")
+
+	router.ServeHTTP(w, r)
+	require.EqualValues(t, http.StatusCreated, w.Code)
+
+	var session reading.Session
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+	return session
+}
+
+func appendChunk(t *testing.T, router *mux.Router, id string, offset int64, chunk []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPatch, "/ingest/sessions/"+id, bytes.NewReader(chunk))
+	r.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	r = withVehicle(r, "lada")
+
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func finalize(t *testing.T, router *mux.Router, id string, offset int64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/ingest/sessions/"+id+"/finalize", nil)
+	r.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	r = withVehicle(r, "lada")
+
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func line(t *testing.T, value interface{}) []byte {
+	t.Helper()
+
+	return append(marshal(t, value), '\n')
+}
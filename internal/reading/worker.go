@@ -0,0 +1,325 @@
+package reading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/blob"
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/google/uuid"
+)
+
+type (
+	// The JobWorker type is responsible for publishing the readings of asynchronous ingest jobs created by HTTP.Ingest.
+	JobWorker struct {
+		jobs          JobRepository
+		blobs         BlobStore
+		writer        EventWriter
+		sensors       SensorRegistry
+		logger        *log.Logger
+		producer      string
+		batchSize     int
+		batchInterval time.Duration
+		pollInterval  time.Duration
+		lease         time.Duration
+	}
+
+	// The JobWorkerConfig type contains fields used to configure the JobWorker type.
+	JobWorkerConfig struct {
+		// The JobRepository implementation to claim jobs from.
+		Jobs JobRepository
+		// The BlobStore implementation to read request bodies from.
+		Blobs BlobStore
+		// The EventWriter implementation to publish readings to.
+		Events EventWriter
+		// The SensorRegistry implementation used to validate readings. Defaults to DefaultSensorRules.
+		Sensors SensorRegistry
+		// The Logger to write log messages to.
+		Logger *log.Logger
+		// The name of the application producing events, included in each event's envelope.
+		Producer string
+		// The maximum number of readings to publish at once. A value of one or fewer disables batching.
+		BatchSize int
+		// The maximum amount of time readings can wait within a batch before it is published.
+		BatchInterval time.Duration
+		// How often to check for new jobs. Defaults to 5 seconds.
+		PollInterval time.Duration
+		// How long a job can go without its lease being renewed before it is assumed its worker has died and it can be
+		// claimed by another. Leases are renewed three times per lease while a job is processed. Defaults to 5 minutes.
+		Lease time.Duration
+	}
+
+	// The jobLease type holds the most recently stored state of the job being processed by a JobWorker, allowing its
+	// lease to be renewed in the background while readings are published.
+	jobLease struct {
+		mu   sync.Mutex
+		jobs JobRepository
+		job  Job
+	}
+)
+
+// The number of rows processed between each checkpoint of a job's progress.
+const jobCheckpointInterval = 1000
+
+// NewJobWorker returns a new instance of the JobWorker type that will publish readings from jobs in the
+// JobRepository onto the configured EventWriter implementation. The JobWorker.Run method should be used to start
+// processing jobs.
+func NewJobWorker(config JobWorkerConfig) *JobWorker {
+	worker := &JobWorker{
+		jobs:          config.Jobs,
+		blobs:         config.Blobs,
+		writer:        config.Events,
+		sensors:       config.Sensors,
+		logger:        config.Logger,
+		producer:      config.Producer,
+		batchSize:     config.BatchSize,
+		batchInterval: config.BatchInterval,
+		pollInterval:  config.PollInterval,
+		lease:         config.Lease,
+	}
+
+	if worker.pollInterval <= 0 {
+		worker.pollInterval = time.Second * 5
+	}
+	if worker.lease <= 0 {
+		worker.lease = time.Minute * 5
+	}
+	if worker.sensors == nil {
+		worker.sensors = DefaultSensorRules
+	}
+
+	return worker
+}
+
+// Run claims and processes jobs one at a time until the context is cancelled. Whenever there are no jobs left to
+// claim, the JobWorker waits for the poll interval before checking again. Multiple JobWorkers may run concurrently
+// against the same JobRepository, each job is only processed by a single JobWorker at a time.
+func (jw *JobWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(jw.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := jw.jobs.Claim(ctx, jw.lease)
+			if errors.Is(err, ErrNoJobs) {
+				break
+			}
+			if err != nil {
+				jw.logger.Printf("failed to claim job: %v", err)
+				break
+			}
+
+			if err = jw.process(ctx, job); err != nil {
+				jw.logger.Printf("failed to process job %s: %v", job.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			continue
+		}
+	}
+}
+
+// process publishes the readings of a single job. A job that was previously claimed by a JobWorker that died will
+// have checkpointed its progress, in which case the rows that have already been processed are skipped. The job's
+// lease is renewed in the background, processing stops if a renewal finds the job has been claimed by another
+// JobWorker. Returning a non-nil error leaves the job to be retried once its lease expires.
+func (jw *JobWorker) process(ctx context.Context, job Job) error {
+	ctx, cancel := context.WithCancel(ctx)
+	lease := &jobLease{jobs: jw.jobs, job: job}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jw.renew(ctx, cancel, job.ID, lease)
+	}()
+
+	name := jobBlobName(job.ID)
+	reader, err := jw.blobs.NewReader(ctx, name)
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		// Retrying won't make the body appear, so there's nothing left to do but fail the job.
+		return jw.fail(ctx, lease, job, err)
+	case err != nil:
+		return fmt.Errorf("failed to open blob: %w", err)
+	}
+	defer closers.Close(reader)
+
+	body, err := decodeBody(job.ContentEncoding, reader)
+	if err != nil {
+		return jw.fail(ctx, lease, job, err)
+	}
+	defer closers.Close(body)
+
+	jw.logger.Printf("processing job %s from row %d", job.ID, job.Rows)
+
+	decoder := newDecoder(job.ContentType, body)
+	batch := event.NewBatch(jw.writer, jw.batchSize, jw.batchInterval)
+	namespace := uuid.MustParse(job.ID)
+
+	for row := 1; ; row++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		var request Reading
+		err = decoder.Decode(&request)
+		switch {
+		case errors.Is(err, io.EOF):
+			return jw.complete(ctx, lease, job, batch)
+		case err != nil:
+			// A malformed row means we can't reliably continue reading, so the job fails. Readings before it will
+			// already have been published.
+			return jw.fail(ctx, lease, job, fmt.Errorf("row %d: %w", row, err))
+		case row <= job.Rows:
+			// Already processed prior to the job being reclaimed.
+			continue
+		}
+
+		// The vehicle is determined by the credentials used to create the job.
+		request.Vehicle = job.Vehicle
+		invalid := request.Validate(jw.sensors)
+		switch {
+		case invalid != nil:
+			job.Invalid++
+			job.addError(fmt.Errorf("row %d: %w", row, invalid))
+		default:
+			// Event identifiers are derived from the job & row, so readings republished after the job is reclaimed
+			// have the same identifiers as before.
+			id := uuid.NewSHA1(namespace, []byte(strconv.Itoa(row))).String()
+
+			envelope, err := newEnvelope(id, jw.producer, job.CreatedAt, job.DeviceID, request)
+			if err != nil {
+				return err
+			}
+
+			if err = batch.Write(ctx, envelope); err != nil && !errors.Is(err, event.ErrSpooled) {
+				return err
+			}
+
+			job.Valid++
+		}
+
+		job.Rows = row
+		if job.Rows%jobCheckpointInterval != 0 {
+			continue
+		}
+
+		// Everything up to the checkpoint must be published before the checkpoint is stored, otherwise readings
+		// could be skipped if the job is reclaimed.
+		if err = batch.Flush(ctx); err != nil && !errors.Is(err, event.ErrSpooled) {
+			return err
+		}
+
+		if err = lease.store(ctx, job); err != nil {
+			return err
+		}
+	}
+}
+
+// renew periodically renews the lease of the job being processed until the context is cancelled. If the job has been
+// claimed by another JobWorker, processing is cancelled.
+func (jw *JobWorker) renew(ctx context.Context, cancel context.CancelFunc, id string, lease *jobLease) {
+	ticker := time.NewTicker(jw.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := lease.renew(ctx)
+			switch {
+			case errors.Is(err, ErrJobReclaimed):
+				jw.logger.Printf("job %s was reclaimed by another worker, stopping", id)
+				cancel()
+				return
+			case err != nil && ctx.Err() == nil:
+				// The lease may still be renewed before it expires, so we keep processing the job.
+				jw.logger.Printf("failed to renew lease for job %s: %v", id, err)
+			}
+		}
+	}
+}
+
+func (jw *JobWorker) complete(ctx context.Context, lease *jobLease, job Job, batch *event.Batch) error {
+	if err := batch.Flush(ctx); err != nil && !errors.Is(err, event.ErrSpooled) {
+		return err
+	}
+
+	finishedAt := time.Now().UTC()
+	job.Status = JobStatusComplete
+	job.FinishedAt = &finishedAt
+
+	if err := lease.store(ctx, job); err != nil {
+		return err
+	}
+
+	jw.logger.Printf("completed job %s, %d valid & %d invalid reading(s)", job.ID, job.Valid, job.Invalid)
+
+	// The body is no longer needed once every reading has been published.
+	if err := jw.blobs.Delete(ctx, jobBlobName(job.ID)); err != nil {
+		jw.logger.Printf("failed to delete blob for job %s: %v", job.ID, err)
+	}
+
+	return nil
+}
+
+func (jw *JobWorker) fail(ctx context.Context, lease *jobLease, job Job, reason error) error {
+	finishedAt := time.Now().UTC()
+	job.Status = JobStatusFailed
+	job.FinishedAt = &finishedAt
+	job.addError(reason)
+
+	if err := lease.store(ctx, job); err != nil {
+		return err
+	}
+
+	jw.logger.Printf("job %s failed: %v", job.ID, reason)
+	return nil
+}
+
+// store the job, renewing its lease. Returns ErrJobReclaimed if the job has been claimed by another JobWorker since
+// it was last stored.
+func (l *jobLease) store(ctx context.Context, job Job) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.update(ctx, job)
+}
+
+// renew the lease by storing the job as it was last stored.
+func (l *jobLease) renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.update(ctx, l.job)
+}
+
+func (l *jobLease) update(ctx context.Context, job Job) error {
+	// Timestamps are truncated to the precision stored by the JobRepository, so that the next update's comparison
+	// against this one succeeds.
+	previous := l.job.UpdatedAt
+	job.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	if err := l.jobs.Update(ctx, job, previous); err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+
+	l.job = job
+	return nil
+}
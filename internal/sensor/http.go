@@ -0,0 +1,41 @@
+package sensor
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// The HTTP type contains HTTP request handlers that serve sensor data.
+	HTTP struct {
+		sensors Repository
+	}
+)
+
+// NewHTTP returns a new instance of the HTTP type that will serve sensor data queried from the Repository
+// implementation.
+func NewHTTP(sensors Repository) *HTTP {
+	return &HTTP{sensors: sensors}
+}
+
+// List handles an inbound HTTP GET request that returns all sensors stored within the Repository.
+func (h *HTTP) List(w http.ResponseWriter, r *http.Request) {
+	sensors, err := h.sensors.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(sensors); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Register the HTTP routes into the given router.
+func (h *HTTP) Register(router *mux.Router) {
+	router.HandleFunc("/sensors", h.List).Methods(http.MethodGet)
+}
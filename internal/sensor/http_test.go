@@ -0,0 +1,70 @@
+package sensor_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloud-lada/backend/internal/sensor"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP_List(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Expected     []sensor.Sensor
+		Error        error
+		ExpectsError bool
+		ExpectedCode int
+	}{
+		{
+			Name: "It should return all sensors",
+			Expected: []sensor.Sensor{
+				{
+					Name:        "oil_pressure",
+					Unit:        "bar",
+					Description: "Pressure of the engine oil",
+					Min:         0,
+					Max:         10,
+					Precision:   1,
+				},
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return errors from the repository",
+			Error:        io.EOF,
+			ExpectsError: true,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{sensors: tc.Expected, err: tc.Error}
+			api := sensor.NewHTTP(repo)
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/sensors", nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectsError {
+				return
+			}
+
+			var actual []sensor.Sensor
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package sensor_test
+
+import (
+	"context"
+
+	"github.com/cloud-lada/backend/internal/sensor"
+)
+
+type (
+	MockRepository struct {
+		sensors []sensor.Sensor
+		err     error
+	}
+)
+
+func (m *MockRepository) List(ctx context.Context) ([]sensor.Sensor, error) {
+	return m.sensors, m.err
+}
@@ -0,0 +1,65 @@
+package sensor
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cloud-lada/backend/pkg/closers"
+	"github.com/cloud-lada/backend/pkg/postgres"
+)
+
+type (
+	// The PostgresRepository is a Repository implementation that queries sensors from a postgres-compatible database.
+	PostgresRepository struct {
+		db *sql.DB
+	}
+)
+
+// NewPostgresRepository returns a new instance of the PostgresRepository type that will perform queries against
+// the provided sql.DB instance.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// List all sensors stored within the database, ordered by name.
+func (r *PostgresRepository) List(ctx context.Context) ([]Sensor, error) {
+	out := make([]Sensor, 0)
+	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		const q = `
+			SELECT name, unit, description, min_value, max_value, display_precision
+			FROM sensor
+			ORDER BY name
+		`
+
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return err
+		}
+		defer closers.Close(rows)
+
+		for rows.Next() {
+			var sensor Sensor
+			err = rows.Scan(
+				&sensor.Name,
+				&sensor.Unit,
+				&sensor.Description,
+				&sensor.Min,
+				&sensor.Max,
+				&sensor.Precision,
+			)
+			if err != nil {
+				return err
+			}
+
+			out = append(out, sensor)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		return rows.Close()
+	})
+
+	return out, err
+}
@@ -0,0 +1,36 @@
+package sensor_test
+
+import (
+	"testing"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/internal/sensor"
+	"github.com/cloud-lada/backend/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRepository_List(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+	repo := sensor.NewPostgresRepository(db)
+
+	t.Run("It should return the built-in sensors", func(t *testing.T) {
+		actual, err := repo.List(ctx)
+		require.NoError(t, err)
+
+		names := make([]reading.SensorType, 0, len(actual))
+		for _, s := range actual {
+			names = append(names, s.Name)
+		}
+
+		for name := range reading.DefaultSensorRules {
+			assert.Contains(t, names, name)
+		}
+	})
+}
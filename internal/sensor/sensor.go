@@ -0,0 +1,119 @@
+// Package sensor provides all components required to manage the registry of sensors readings can be recorded for. It
+// includes the transport & persistence layers.
+package sensor
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/units"
+)
+
+type (
+	// The Sensor type describes a kind of sensor that readings can be recorded for.
+	Sensor struct {
+		// The unique name of the sensor, as used in readings.
+		Name reading.SensorType `json:"name"`
+		// The canonical unit that the sensor's values are recorded in.
+		Unit units.Unit `json:"unit"`
+		// A human-readable description of the sensor.
+		Description string `json:"description"`
+		// The minimum plausible value the sensor can produce.
+		Min float64 `json:"min"`
+		// The maximum plausible value the sensor can produce.
+		Max float64 `json:"max"`
+		// The number of decimal places values should be displayed with.
+		Precision int `json:"precision"`
+	}
+
+	// The Repository interface describes types that can query the sensors stored within persistent storage.
+	Repository interface {
+		List(ctx context.Context) ([]Sensor, error)
+	}
+
+	// The Registry type is a reading.SensorRegistry implementation that holds an in-memory copy of the sensors
+	// stored within a Repository. The Registry.Run method should be used to keep the copy up to date so that new
+	// sensors can be added without restarting any services.
+	Registry struct {
+		sensors Repository
+		logger  *log.Logger
+
+		mu    sync.RWMutex
+		cache map[reading.SensorType]Sensor
+	}
+)
+
+// NewRegistry returns a new instance of the Registry type, populated using the sensors currently stored within the
+// Repository.
+func NewRegistry(ctx context.Context, sensors Repository, logger *log.Logger) (*Registry, error) {
+	registry := &Registry{sensors: sensors, logger: logger}
+	if err := registry.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Refresh the Registry's copy of the sensors stored within the Repository.
+func (r *Registry) Refresh(ctx context.Context) error {
+	sensors, err := r.sensors.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[reading.SensorType]Sensor, len(sensors))
+	for _, sensor := range sensors {
+		cache[sensor.Name] = sensor
+	}
+
+	r.mu.Lock()
+	r.cache = cache
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes the Registry at the given interval until the context is cancelled. Failures to refresh are logged
+// and the previous copy of the sensors is kept. An interval of zero or less defaults to one minute.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil {
+				r.logger.Printf("failed to refresh sensors: %v", err)
+			}
+		}
+	}
+}
+
+// Get returns the Sensor with the given name, and false if it does not exist.
+func (r *Registry) Get(name reading.SensorType) (Sensor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sensor, ok := r.cache[name]
+	return sensor, ok
+}
+
+// Rule returns the reading.SensorRule for a sensor, and false if the sensor does not exist. Stored sensors use the
+// default timestamp bounds.
+func (r *Registry) Rule(name reading.SensorType) (reading.SensorRule, bool) {
+	sensor, ok := r.Get(name)
+	if !ok {
+		return reading.SensorRule{}, false
+	}
+
+	return reading.NewSensorRule(sensor.Min, sensor.Max, sensor.Unit), true
+}
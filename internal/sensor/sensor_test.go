@@ -0,0 +1,78 @@
+package sensor_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/internal/sensor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	repo := &MockRepository{
+		sensors: []sensor.Sensor{
+			{Name: reading.SensorTypeSpeed, Unit: "km/h", Min: 0, Max: 250},
+		},
+	}
+
+	registry, err := sensor.NewRegistry(ctx, repo, logger)
+	require.NoError(t, err)
+
+	t.Run("It should return rules for known sensors", func(t *testing.T) {
+		rule, ok := registry.Rule(reading.SensorTypeSpeed)
+		assert.True(t, ok)
+		assert.EqualValues(t, reading.NewSensorRule(0, 250, "km/h"), rule)
+	})
+
+	t.Run("It should not return rules for unknown sensors", func(t *testing.T) {
+		_, ok := registry.Rule("oil_pressure")
+		assert.False(t, ok)
+	})
+
+	t.Run("It should include new sensors after a refresh", func(t *testing.T) {
+		repo.sensors = append(repo.sensors, sensor.Sensor{Name: "oil_pressure", Unit: "bar", Min: 0, Max: 10})
+		require.NoError(t, registry.Refresh(ctx))
+
+		rule, ok := registry.Rule("oil_pressure")
+		assert.True(t, ok)
+		assert.EqualValues(t, reading.NewSensorRule(0, 10, "bar"), rule)
+	})
+
+	t.Run("It should keep existing sensors if a refresh fails", func(t *testing.T) {
+		repo.err = io.EOF
+		assert.ErrorIs(t, registry.Refresh(ctx), io.EOF)
+
+		_, ok := registry.Get(reading.SensorTypeSpeed)
+		assert.True(t, ok)
+	})
+}
+
+func TestNewRegistry(t *testing.T) {
+	t.Parallel()
+
+	_, err := sensor.NewRegistry(context.Background(), &MockRepository{err: io.EOF}, log.Default())
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestRegistry_Run(t *testing.T) {
+	t.Parallel()
+
+	registry, err := sensor.NewRegistry(context.Background(), &MockRepository{}, log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+
+	t.Run("It should default non-positive intervals", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		assert.ErrorIs(t, registry.Run(ctx, 0), context.DeadlineExceeded)
+	})
+}
@@ -3,10 +3,15 @@ package statistics
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/units"
 	"github.com/gorilla/mux"
 )
 
@@ -14,30 +19,57 @@ type (
 	// The HTTP type contains HTTP request handlers that serve statistical data.
 	HTTP struct {
 		statistics Repository
+		sensors    reading.SensorRegistry
 	}
 
 	// The Repository interface describes types that can query statistical database from persistent
 	// storage.
 	Repository interface {
-		Latest(ctx context.Context) (Statistics, error)
-		ForDate(ctx context.Context, date time.Time, sensor reading.SensorType) ([]Statistic, error)
+		Latest(ctx context.Context, vehicle string) (Statistics, error)
+		ForDate(ctx context.Context, vehicle string, date time.Time, sensor reading.SensorType, opts Options) ([]Statistic, error)
+		ForRange(ctx context.Context, vehicle string, sensor reading.SensorType, rng Range, opts Options) ([]Statistic, error)
+		Series(ctx context.Context, vehicle string, sensors []reading.SensorType, rng Range, fill Fill) (Series, error)
 	}
 )
 
 // NewHTTP returns a new instance of the HTTP type that will serve statistical data queried from the
-// Repository implementation.
-func NewHTTP(statistics Repository) *HTTP {
-	return &HTTP{statistics: statistics}
+// Repository implementation. The reading.SensorRegistry implementation is used to determine which sensors
+// statistics can be requested for.
+func NewHTTP(statistics Repository, sensors reading.SensorRegistry) *HTTP {
+	return &HTTP{statistics: statistics, sensors: sensors}
 }
 
-// Latest handles an inbound HTTP GET request that returns the latest statistics stored within the Repository.
+// Latest handles an inbound HTTP GET request that returns the latest statistics for a vehicle stored within the
+// Repository. Values are converted to the units given in the "units" query parameter.
 func (h *HTTP) Latest(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.statistics.Latest(r.Context())
+	prefs, err := units.ParsePreferences(r.URL.Query()["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.statistics.Latest(r.Context(), mux.Vars(r)["vehicle"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	stats.Units = make(map[reading.SensorType]units.Unit)
+	fields := map[reading.SensorType]*float64{
+		reading.SensorTypeSpeed:             &stats.Speed,
+		reading.SensorTypeFuel:              &stats.Fuel,
+		reading.SensorTypeEngineTemperature: &stats.EngineTemperature,
+		reading.SensorTypeRevolution:        &stats.Revolutions,
+	}
+
+	for sensor, value := range fields {
+		*value, stats.Units[sensor], err = h.convert(prefs, sensor, *value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err = json.NewEncoder(w).Encode(stats); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -45,29 +77,60 @@ func (h *HTTP) Latest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ForDate handles an inbound HTTP GET request that returns an array of sensor statistics for a specific date
-// from the Repository.
+// ForDate handles an inbound HTTP GET request that returns an array of sensor statistics for a vehicle on a specific
+// date from the Repository. Values are converted to the units given in the "units" query parameter. Additional
+// aggregations for each bucket are given in the "aggregate" query parameter, and the strategy used to fill buckets
+// without readings in the "fill" query parameter. The boundaries of the date are determined using the IANA time zone
+// given in the "tz" query parameter, defaulting to UTC.
 func (h *HTTP) ForDate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	location, err := parseLocation(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := units.ParsePreferences(query["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	sensor := reading.SensorType(vars["sensor"])
-	if !sensor.Valid() {
+	if _, ok := h.sensors.Rule(sensor); !ok {
 		http.Error(w, "invalid sensor type", http.StatusBadRequest)
 		return
 	}
 
-	date, err := time.Parse("2006-01-02", vars["date"])
+	date, err := time.ParseInLocation("2006-01-02", vars["date"], location)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.statistics.ForDate(r.Context(), date, sensor)
+	stats, err := h.statistics.ForDate(r.Context(), vars["vehicle"], date, sensor, opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	for i := range stats {
+		if err = h.convertStatistic(prefs, &stats[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		stats[i].Timestamp = stats[i].Timestamp.In(location)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err = json.NewEncoder(w).Encode(stats); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -75,8 +138,343 @@ func (h *HTTP) ForDate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ForRange handles an inbound HTTP GET request that returns an array of sensor statistics for a vehicle within a range
+// of time from the Repository. The range is given by the "from" and "to" query parameters as RFC 3339 timestamps, with
+// "to" defaulting to the current time. Timestamps without a UTC offset are interpreted using the IANA time zone given
+// in the "tz" query parameter, defaulting to UTC. The width of each bucket is given by the "interval" query parameter
+// as a duration, defaulting to 15 minutes. Values are converted to the units given in the "units" query parameter.
+// Additional aggregations for each bucket are given in the "aggregate" query parameter, and the strategy used to fill
+// buckets without readings in the "fill" query parameter.
+func (h *HTTP) ForRange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	location, err := parseLocation(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := units.ParsePreferences(query["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sensor := reading.SensorType(vars["sensor"])
+	if _, ok := h.sensors.Rule(sensor); !ok {
+		http.Error(w, "invalid sensor type", http.StatusBadRequest)
+		return
+	}
+
+	rng, err := parseRange(query, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.statistics.ForRange(r.Context(), vars["vehicle"], sensor, rng, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range stats {
+		if err = h.convertStatistic(prefs, &stats[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		stats[i].Timestamp = stats[i].Timestamp.In(location)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Series handles an inbound HTTP GET request that returns time-bucketed statistics for several of a vehicle's sensors
+// from the Repository, aligned so that each row contains the value of every sensor for a single bucket. The sensors
+// are given in the "sensors" query parameter, separated by commas. The buckets are determined using either the "date"
+// query parameter, or the "from", "to" & "interval" query parameters as for HTTP.ForRange. The "tz", "units" and
+// "fill" query parameters are also supported.
+func (h *HTTP) Series(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	location, err := parseLocation(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := units.ParsePreferences(query["units"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fill, err := ParseFill(query.Get("fill"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sensors, err := h.parseSensors(query["sensors"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rng, err := parseDateOrRange(query, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := h.statistics.Series(r.Context(), vars["vehicle"], sensors, rng, fill)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for column, sensor := range series.Sensors {
+		rule, ok := h.sensors.Rule(sensor)
+		if !ok {
+			continue
+		}
+
+		unit := prefs.For(rule.Unit)
+		series.Units[column] = unit
+
+		for _, row := range series.Rows {
+			if row.Values[column] == nil {
+				continue
+			}
+
+			value, err := units.Convert(*row.Values[column], rule.Unit, unit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			row.Values[column] = &value
+		}
+	}
+
+	for i := range series.Rows {
+		series.Rows[i].Timestamp = series.Rows[i].Timestamp.In(location)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(series); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseSensors parses the list of sensors for a Series, typically from the query parameters of an HTTP request. Each
+// value may contain several sensors separated by commas. Duplicate sensors are removed.
+func (h *HTTP) parseSensors(values []string) ([]reading.SensorType, error) {
+	out := make([]reading.SensorType, 0)
+	seen := make(map[reading.SensorType]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			sensor := reading.SensorType(strings.TrimSpace(name))
+			if _, ok := h.sensors.Rule(sensor); !ok {
+				return nil, fmt.Errorf("invalid sensor type %q", name)
+			}
+
+			if seen[sensor] {
+				continue
+			}
+
+			seen[sensor] = true
+			out = append(out, sensor)
+		}
+	}
+
+	switch {
+	case len(out) == 0:
+		return nil, errors.New("at least one sensor is required")
+	case len(out) > MaxSeriesSensors:
+		return nil, fmt.Errorf("%d sensors requested, more than the maximum of %d", len(out), MaxSeriesSensors)
+	default:
+		return out, nil
+	}
+}
+
+// convert a sensor's value from its canonical unit to the unit preferred by the caller. Returns the converted value
+// and its unit.
+func (h *HTTP) convert(prefs units.Preferences, sensor reading.SensorType, value float64) (float64, units.Unit, error) {
+	rule, ok := h.sensors.Rule(sensor)
+	if !ok {
+		return value, "", nil
+	}
+
+	unit := prefs.For(rule.Unit)
+	value, err := units.Convert(value, rule.Unit, unit)
+	return value, unit, err
+}
+
+// parseLocation parses the IANA time zone given in the "tz" query parameter, defaulting to UTC.
+func parseLocation(query url.Values) (*time.Location, error) {
+	tz := query.Get("tz")
+	switch tz {
+	case "":
+		return time.UTC, nil
+	case "Local":
+		// This is the time zone of the server rather than an IANA time zone, so the same request would return
+		// different results depending on where the API is deployed.
+		return nil, fmt.Errorf("unknown time zone %s", tz)
+	default:
+		return time.LoadLocation(tz)
+	}
+}
+
+// parseOptions parses the Options for bucketed statistics from the "aggregate" and "fill" query parameters.
+func parseOptions(query url.Values) (Options, error) {
+	aggregations, err := ParseAggregations(query["aggregate"])
+	if err != nil {
+		return Options{}, err
+	}
+
+	fill, err := ParseFill(query.Get("fill"))
+	if err != nil {
+		return Options{}, err
+	}
+
+	return Options{Aggregations: aggregations, Fill: fill}, nil
+}
+
+// parseRange parses a Range from the "from", "to" and "interval" query parameters. The Range starts at the "from" query
+// parameter and ends at the "to" query parameter, or the current time. The interval defaults to 15 minutes.
+func parseRange(query url.Values, location *time.Location) (Range, error) {
+	interval, err := parseInterval(query)
+	if err != nil {
+		return Range{}, err
+	}
+
+	from, err := parseTime(query.Get("from"), location)
+	if err != nil {
+		return Range{}, err
+	}
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTime(value, location); err != nil {
+			return Range{}, err
+		}
+	}
+
+	rng := Range{From: from, To: to, Interval: interval}
+	return rng, rng.Validate()
+}
+
+// parseDateOrRange parses a Range covering the date in the "date" query parameter within the location, using the
+// "interval" query parameter. When no date is given, the Range is parsed using parseRange instead.
+func parseDateOrRange(query url.Values, location *time.Location) (Range, error) {
+	value := query.Get("date")
+	if value == "" {
+		return parseRange(query, location)
+	}
+
+	interval, err := parseInterval(query)
+	if err != nil {
+		return Range{}, err
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return Range{}, err
+	}
+
+	rng := Day(date, interval)
+	return rng, rng.Validate()
+}
+
+// parseInterval parses the "interval" query parameter as a duration, defaulting to 15 minutes.
+func parseInterval(query url.Values) (time.Duration, error) {
+	value := query.Get("interval")
+	if value == "" {
+		return time.Minute * 15, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// parseTime parses an RFC 3339 timestamp. Timestamps without a UTC offset are interpreted using the location.
+func parseTime(value string, location *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	if local, localErr := time.ParseInLocation("2006-01-02T15:04:05", value, location); localErr == nil {
+		return local, nil
+	}
+
+	return time.Time{}, err
+}
+
+// convertStatistic converts each value of the Statistic from its sensor's canonical unit to the unit preferred by the
+// caller.
+func (h *HTTP) convertStatistic(prefs units.Preferences, stat *Statistic) error {
+	rule, ok := h.sensors.Rule(stat.Sensor)
+	if !ok {
+		return nil
+	}
+
+	unit := prefs.For(rule.Unit)
+	stat.Unit = unit
+
+	values := []*float64{stat.Value, stat.Min, stat.Max, stat.First, stat.Last}
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+
+		converted, err := units.Convert(*value, rule.Unit, unit)
+		if err != nil {
+			return err
+		}
+
+		*value = converted
+	}
+
+	for aggregation, value := range stat.Percentiles {
+		converted, err := units.Convert(value, rule.Unit, unit)
+		if err != nil {
+			return err
+		}
+
+		stat.Percentiles[aggregation] = converted
+	}
+
+	if stat.StdDev != nil {
+		converted, err := units.ConvertDifference(*stat.StdDev, rule.Unit, unit)
+		if err != nil {
+			return err
+		}
+
+		*stat.StdDev = converted
+	}
+
+	return nil
+}
+
 // Register the HTTP routes into the given router.
 func (h *HTTP) Register(router *mux.Router) {
-	router.HandleFunc("/statistics/latest", h.Latest).Methods(http.MethodGet)
-	router.HandleFunc("/statistics/sensor/{sensor}/date/{date}", h.ForDate).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/statistics/latest", h.Latest).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/statistics/sensor/{sensor}/date/{date}", h.ForDate).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/statistics/sensor/{sensor}/range", h.ForRange).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/statistics/series", h.Series).Methods(http.MethodGet)
 }
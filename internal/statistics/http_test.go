@@ -11,6 +11,7 @@ import (
 
 	"github.com/cloud-lada/backend/internal/reading"
 	"github.com/cloud-lada/backend/internal/statistics"
+	"github.com/cloud-lada/backend/pkg/units"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,23 +20,63 @@ import (
 func TestHTTP_Latest(t *testing.T) {
 	t.Parallel()
 
+	latest := statistics.Statistics{
+		Speed:             100,
+		Fuel:              11,
+		EngineTemperature: 100,
+		Revolutions:       13,
+	}
+
 	tt := []struct {
 		Name         string
+		Latest       statistics.Statistics
+		Units        string
 		Expected     statistics.Statistics
 		Error        error
 		ExpectsError bool
 		ExpectedCode int
 	}{
 		{
-			Name: "It should return the latest statistics",
+			Name:   "It should return the latest statistics",
+			Latest: latest,
 			Expected: statistics.Statistics{
-				Speed:             10,
+				Speed:             100,
 				Fuel:              11,
-				EngineTemperature: 12,
+				EngineTemperature: 100,
 				Revolutions:       13,
+				Units: map[reading.SensorType]units.Unit{
+					reading.SensorTypeSpeed:             units.KilometresPerHour,
+					reading.SensorTypeFuel:              "%",
+					reading.SensorTypeEngineTemperature: units.Celsius,
+					reading.SensorTypeRevolution:        "rpm",
+				},
 			},
 			ExpectedCode: http.StatusOK,
 		},
+		{
+			Name:   "It should convert statistics to the requested units",
+			Latest: latest,
+			Units:  "units=imperial&units=c",
+			Expected: statistics.Statistics{
+				Speed:             62.13711922373339,
+				Fuel:              11,
+				EngineTemperature: 100,
+				Revolutions:       13,
+				Units: map[reading.SensorType]units.Unit{
+					reading.SensorTypeSpeed:             units.MilesPerHour,
+					reading.SensorTypeFuel:              "%",
+					reading.SensorTypeEngineTemperature: units.Celsius,
+					reading.SensorTypeRevolution:        "rpm",
+				},
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return bad request for unknown units",
+			Units:        "units=furlongs",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
 		{
 			Name:         "It should return return errors from the repository",
 			Error:        io.EOF,
@@ -46,14 +87,14 @@ func TestHTTP_Latest(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			repo := &MockRepository{latest: tc.Expected, err: tc.Error}
-			api := statistics.NewHTTP(repo)
+			repo := &MockRepository{latest: tc.Latest, err: tc.Error}
+			api := statistics.NewHTTP(repo, reading.DefaultSensorRules)
 
 			router := mux.NewRouter()
 			api.Register(router)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/statistics/latest", nil)
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/statistics/latest?"+tc.Units, nil)
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
@@ -63,7 +104,11 @@ func TestHTTP_Latest(t *testing.T) {
 
 			var actual statistics.Statistics
 			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
-			assert.EqualValues(t, tc.Expected, actual)
+			assert.InDelta(t, tc.Expected.Speed, actual.Speed, 0.001)
+			assert.InDelta(t, tc.Expected.EngineTemperature, actual.EngineTemperature, 0.001)
+			assert.EqualValues(t, tc.Expected.Fuel, actual.Fuel)
+			assert.EqualValues(t, tc.Expected.Revolutions, actual.Revolutions)
+			assert.EqualValues(t, tc.Expected.Units, actual.Units)
 		})
 	}
 }
@@ -71,57 +116,98 @@ func TestHTTP_Latest(t *testing.T) {
 func TestHTTP_ForDate(t *testing.T) {
 	t.Parallel()
 
+	// The day is after the 12th so that a date formatted with the day & month swapped is rejected rather than
+	// silently requesting another date.
+	date := time.Date(2022, 1, 13, 0, 0, 0, 0, time.UTC)
+
 	tt := []struct {
 		Name         string
 		Expected     []statistics.Statistic
 		Date         time.Time
 		Sensor       reading.SensorType
+		Units        string
 		Error        error
 		ExpectsError bool
 		ExpectedCode int
 	}{
 		{
 			Name:         "It should return statistics for the date",
-			Date:         time.Now(),
+			Date:         date,
 			Sensor:       reading.SensorTypeSpeed,
 			ExpectedCode: http.StatusOK,
 			Expected: []statistics.Statistic{
 				{
 					Sensor:    reading.SensorTypeSpeed,
-					Value:     10,
+					Value:     float(10),
+					Unit:      units.KilometresPerHour,
 					Timestamp: time.Now(),
 				},
 			},
 		},
+		{
+			Name:         "It should convert statistics to the requested unit",
+			Date:         date,
+			Sensor:       reading.SensorTypeEngineTemperature,
+			Units:        "units=f",
+			ExpectedCode: http.StatusOK,
+			Expected: []statistics.Statistic{
+				{
+					Sensor:    reading.SensorTypeEngineTemperature,
+					Value:     float(212),
+					Unit:      units.Fahrenheit,
+					Timestamp: time.Now(),
+				},
+			},
+		},
+		{
+			Name:         "It should return bad request for unknown units",
+			Date:         date,
+			Sensor:       reading.SensorTypeSpeed,
+			Units:        "units=furlongs",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
 		{
 			Name:         "It should return return errors from the repository",
 			Error:        io.EOF,
 			ExpectsError: true,
 			ExpectedCode: http.StatusInternalServerError,
-			Date:         time.Now(),
+			Date:         date,
 			Sensor:       reading.SensorTypeSpeed,
 		},
 		{
 			Name:         "It should return bad request for an invalid sensor",
 			ExpectsError: true,
 			ExpectedCode: http.StatusBadRequest,
-			Date:         time.Now(),
+			Date:         date,
 			Sensor:       "invalid",
 		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			repo := &MockRepository{stats: tc.Expected, err: tc.Error}
-			api := statistics.NewHTTP(repo)
+			// Statistics are stored in the canonical unit of their sensor.
+			var stats []statistics.Statistic
+			for _, stat := range tc.Expected {
+				rule, _ := reading.DefaultSensorRules.Rule(stat.Sensor)
+				value, err := units.Convert(*stat.Value, stat.Unit, rule.Unit)
+				require.NoError(t, err)
+
+				stat.Value = &value
+				stat.Unit = ""
+				stats = append(stats, stat)
+			}
+
+			repo := &MockRepository{stats: stats, err: tc.Error}
+			api := statistics.NewHTTP(repo, reading.DefaultSensorRules)
 
 			router := mux.NewRouter()
 			api.Register(router)
 
 			w := httptest.NewRecorder()
 
-			uri := path.Join("/statistics", "sensor", string(tc.Sensor), "date", tc.Date.Format("2006-02-01"))
-			r := httptest.NewRequest(http.MethodGet, uri, nil)
+			uri := path.Join("/vehicles/lada/statistics", "sensor", string(tc.Sensor), "date", tc.Date.Format("2006-01-02"))
+			r := httptest.NewRequest(http.MethodGet, uri+"?"+tc.Units, nil)
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
@@ -132,6 +218,419 @@ func TestHTTP_ForDate(t *testing.T) {
 			var actuals []statistics.Statistic
 			require.NoError(t, json.NewDecoder(w.Body).Decode(&actuals))
 			require.Len(t, actuals, len(tc.Expected))
+			for i, expected := range tc.Expected {
+				assertFloat(t, expected.Value, actuals[i].Value)
+				assert.EqualValues(t, expected.Unit, actuals[i].Unit)
+			}
 		})
 	}
 }
+
+func TestHTTP_ForRange(t *testing.T) {
+	t.Parallel()
+
+	to := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		Name            string
+		Query           string
+		Sensor          reading.SensorType
+		Stats           []statistics.Statistic
+		Expected        []statistics.Statistic
+		ExpectedRange   statistics.Range
+		ExpectedOptions statistics.Options
+		Error           error
+		ExpectsError    bool
+		ExpectedCode    int
+	}{
+		{
+			Name:   "It should return statistics for the range",
+			Query:  "from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z&interval=10s",
+			Sensor: reading.SensorTypeSpeed,
+			Stats: []statistics.Statistic{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     float(10),
+					Timestamp: to,
+				},
+			},
+			Expected: []statistics.Statistic{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Value:     float(10),
+					Unit:      units.KilometresPerHour,
+					Timestamp: to,
+				},
+			},
+			ExpectedOptions: statistics.Options{Aggregations: []statistics.Aggregation{}, Fill: statistics.FillZero},
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Second * 10,
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:   "It should convert additional aggregations to the requested units",
+			Query:  "from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z&aggregate=max,stddev,p95&units=f",
+			Sensor: reading.SensorTypeEngineTemperature,
+			Stats: []statistics.Statistic{
+				{
+					Sensor:      reading.SensorTypeEngineTemperature,
+					Value:       float(90),
+					Max:         float(100),
+					StdDev:      float(10),
+					Percentiles: map[statistics.Aggregation]float64{"p95": 100},
+					Timestamp:   to,
+				},
+			},
+			Expected: []statistics.Statistic{
+				{
+					Sensor:      reading.SensorTypeEngineTemperature,
+					Value:       float(194),
+					Unit:        units.Fahrenheit,
+					Max:         float(212),
+					StdDev:      float(18),
+					Percentiles: map[statistics.Aggregation]float64{"p95": 212},
+					Timestamp:   to,
+				},
+			},
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Minute * 15,
+			},
+			ExpectedOptions: statistics.Options{
+				Aggregations: []statistics.Aggregation{
+					statistics.AggregationMax,
+					statistics.AggregationStdDev,
+					"p95",
+				},
+				Fill: statistics.FillZero,
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:   "It should return null values for empty buckets",
+			Query:  "from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z&fill=null",
+			Sensor: reading.SensorTypeSpeed,
+			Stats: []statistics.Statistic{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Timestamp: to,
+				},
+			},
+			Expected: []statistics.Statistic{
+				{
+					Sensor:    reading.SensorTypeSpeed,
+					Unit:      units.KilometresPerHour,
+					Timestamp: to,
+				},
+			},
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Minute * 15,
+			},
+			ExpectedOptions: statistics.Options{Aggregations: []statistics.Aggregation{}, Fill: statistics.FillNull},
+			ExpectedCode:    http.StatusOK,
+		},
+		{
+			Name:         "It should return bad request for a date rather than a range",
+			Query:        "date=2022-01-01",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for an unknown fill",
+			Query:        "from=2022-01-01T11:00:00Z&fill=guess",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for unknown aggregations",
+			Query:        "from=2022-01-01T11:00:00Z&aggregate=median",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:   "It should default to 15 minute intervals",
+			Query:  "from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z",
+			Sensor: reading.SensorTypeSpeed,
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Minute * 15,
+			},
+			ExpectedOptions: statistics.Options{Aggregations: []statistics.Aggregation{}, Fill: statistics.FillZero},
+			ExpectedCode:    http.StatusOK,
+		},
+		{
+			Name:   "It should interpret timestamps without an offset in the time zone",
+			Query:  "from=2022-01-01T06:00:00&to=2022-01-01T07:00:00&tz=America/New_York",
+			Sensor: reading.SensorTypeSpeed,
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Minute * 15,
+			},
+			ExpectedOptions: statistics.Options{Aggregations: []statistics.Aggregation{}, Fill: statistics.FillZero},
+			ExpectedCode:    http.StatusOK,
+		},
+		{
+			Name:         "It should return bad request for an unknown time zone",
+			Query:        "from=2022-01-01T11:00:00Z&tz=Mars/Olympus_Mons",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for the server's local time zone",
+			Query:        "from=2022-01-01T11:00:00Z&tz=Local",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for a missing start time",
+			Query:        "to=2022-01-01T12:00:00Z",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for an invalid interval",
+			Query:        "from=2022-01-01T11:00:00Z&interval=often",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for too many buckets",
+			Query:        "from=2022-01-01T00:00:00Z&to=2022-01-08T00:00:00Z&interval=1s",
+			Sensor:       reading.SensorTypeSpeed,
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for an invalid sensor",
+			Query:        "from=2022-01-01T11:00:00Z",
+			Sensor:       "invalid",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return errors from the repository",
+			Query:        "from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z",
+			Sensor:       reading.SensorTypeSpeed,
+			Error:        io.EOF,
+			ExpectsError: true,
+			ExpectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{stats: tc.Stats, err: tc.Error}
+			api := statistics.NewHTTP(repo, reading.DefaultSensorRules)
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+
+			uri := path.Join("/vehicles/lada/statistics", "sensor", string(tc.Sensor), "range")
+			r := httptest.NewRequest(http.MethodGet, uri+"?"+tc.Query, nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectsError {
+				return
+			}
+
+			assert.True(t, tc.ExpectedRange.From.Equal(repo.rng.From))
+			assert.True(t, tc.ExpectedRange.To.Equal(repo.rng.To))
+			assert.EqualValues(t, tc.ExpectedRange.Interval, repo.rng.Interval)
+			assert.EqualValues(t, tc.ExpectedOptions, repo.opts)
+
+			var actuals []statistics.Statistic
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actuals))
+			require.Len(t, actuals, len(tc.Expected))
+			for i, expected := range tc.Expected {
+				assertFloat(t, expected.Value, actuals[i].Value)
+				assert.EqualValues(t, expected.Unit, actuals[i].Unit)
+				assertFloat(t, expected.Max, actuals[i].Max)
+				assertFloat(t, expected.StdDev, actuals[i].StdDev)
+				assert.InDeltaMapValues(t, expected.Percentiles, actuals[i].Percentiles, 0.001)
+			}
+		})
+	}
+}
+
+func TestHTTP_Series(t *testing.T) {
+	t.Parallel()
+
+	to := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		Name          string
+		Query         string
+		Stats         []statistics.Statistic
+		Expected      statistics.Series
+		ExpectedRange statistics.Range
+		ExpectedFill  statistics.Fill
+		ExpectsError  bool
+		ExpectedCode  int
+	}{
+		{
+			Name:  "It should return an aligned series for the sensors",
+			Query: "sensors=speed,engine_temperature&from=2022-01-01T11:00:00Z&to=2022-01-01T12:00:00Z&units=imperial&fill=null",
+			Stats: []statistics.Statistic{
+				{Sensor: reading.SensorTypeEngineTemperature, Value: float(100), Timestamp: to.Add(-time.Hour)},
+				{Sensor: reading.SensorTypeSpeed, Value: float(100), Timestamp: to.Add(-time.Hour)},
+				{Sensor: reading.SensorTypeSpeed, Timestamp: to.Add(-time.Minute * 45)},
+			},
+			Expected: statistics.Series{
+				Sensors: []reading.SensorType{reading.SensorTypeSpeed, reading.SensorTypeEngineTemperature},
+				Units:   []units.Unit{units.MilesPerHour, units.Fahrenheit},
+				Rows: []statistics.SeriesRow{
+					{Timestamp: to.Add(-time.Hour), Values: []*float64{float(62.137), float(212)}},
+					{Timestamp: to.Add(-time.Minute * 45), Values: []*float64{nil, nil}},
+				},
+			},
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour),
+				To:       to,
+				Interval: time.Minute * 15,
+			},
+			ExpectedFill: statistics.FillNull,
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:  "It should return a series for a date",
+			Query: "sensors=speed&sensors=speed&date=2022-01-01&interval=1h",
+			Expected: statistics.Series{
+				Sensors: []reading.SensorType{reading.SensorTypeSpeed},
+				Units:   []units.Unit{units.KilometresPerHour},
+				Rows:    []statistics.SeriesRow{},
+			},
+			ExpectedRange: statistics.Range{
+				From:     to.Add(-time.Hour * 12),
+				To:       to.Add(time.Hour * 12),
+				Interval: time.Hour,
+			},
+			ExpectedFill: statistics.FillZero,
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:         "It should return bad request without sensors",
+			Query:        "from=2022-01-01T11:00:00Z",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for an invalid sensor",
+			Query:        "sensors=speed,invalid&from=2022-01-01T11:00:00Z",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+		{
+			Name:         "It should return bad request for an invalid range",
+			Query:        "sensors=speed&from=2022-01-01T11:00:00Z&to=2022-01-01T10:00:00Z",
+			ExpectsError: true,
+			ExpectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			repo := &MockRepository{stats: tc.Stats}
+			api := statistics.NewHTTP(repo, reading.DefaultSensorRules)
+
+			router := mux.NewRouter()
+			api.Register(router)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/statistics/series?"+tc.Query, nil)
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			if tc.ExpectsError {
+				return
+			}
+
+			assert.True(t, tc.ExpectedRange.From.Equal(repo.rng.From))
+			assert.True(t, tc.ExpectedRange.To.Equal(repo.rng.To))
+			assert.EqualValues(t, tc.ExpectedRange.Interval, repo.rng.Interval)
+			assert.EqualValues(t, tc.ExpectedFill, repo.opts.Fill)
+
+			var actual statistics.Series
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&actual))
+			assert.EqualValues(t, tc.Expected.Sensors, actual.Sensors)
+			assert.EqualValues(t, tc.Expected.Units, actual.Units)
+			require.Len(t, actual.Rows, len(tc.Expected.Rows))
+
+			for i, expected := range tc.Expected.Rows {
+				assert.True(t, expected.Timestamp.Equal(actual.Rows[i].Timestamp))
+				require.Len(t, actual.Rows[i].Values, len(expected.Values))
+				for j := range expected.Values {
+					assertFloat(t, expected.Values[j], actual.Rows[i].Values[j])
+				}
+			}
+		})
+	}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func assertFloat(t *testing.T, expected, actual *float64) {
+	t.Helper()
+	if expected == nil {
+		assert.Nil(t, actual)
+		return
+	}
+
+	require.NotNil(t, actual)
+	assert.InDelta(t, *expected, *actual, 0.001)
+}
+
+func TestHTTP_ForDateTimezone(t *testing.T) {
+	t.Parallel()
+
+	location, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	repo := &MockRepository{
+		stats: []statistics.Statistic{
+			{
+				Sensor:    reading.SensorTypeSpeed,
+				Value:     float(10),
+				Timestamp: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	router := mux.NewRouter()
+	statistics.NewHTTP(repo, reading.DefaultSensorRules).Register(router)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/statistics/sensor/speed/date/2022-06-01?tz=Europe/London", nil)
+
+	router.ServeHTTP(w, r)
+	require.EqualValues(t, http.StatusOK, w.Code)
+
+	expected := time.Date(2022, 6, 1, 0, 0, 0, 0, location)
+	assert.True(t, expected.Equal(repo.date))
+	assert.EqualValues(t, location, repo.date.Location())
+
+	// Timestamps are returned with the offset of the time zone.
+	var actuals []json.RawMessage
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&actuals))
+	require.Len(t, actuals, 1)
+	assert.Contains(t, string(actuals[0]), `"timestamp":"2022-06-01T13:00:00+01:00"`)
+}
@@ -12,14 +12,31 @@ type (
 	MockRepository struct {
 		latest statistics.Statistics
 		stats  []statistics.Statistic
+		date   time.Time
+		rng    statistics.Range
+		opts   statistics.Options
 		err    error
 	}
 )
 
-func (m *MockRepository) ForDate(ctx context.Context, date time.Time, sensor reading.SensorType) ([]statistics.Statistic, error) {
+func (m *MockRepository) ForDate(ctx context.Context, vehicle string, date time.Time, sensor reading.SensorType, opts statistics.Options) ([]statistics.Statistic, error) {
+	m.date = date
+	m.opts = opts
 	return m.stats, m.err
 }
 
-func (m *MockRepository) Latest(ctx context.Context) (statistics.Statistics, error) {
+func (m *MockRepository) ForRange(ctx context.Context, vehicle string, sensor reading.SensorType, rng statistics.Range, opts statistics.Options) ([]statistics.Statistic, error) {
+	m.rng = rng
+	m.opts = opts
+	return m.stats, m.err
+}
+
+func (m *MockRepository) Series(ctx context.Context, vehicle string, sensors []reading.SensorType, rng statistics.Range, fill statistics.Fill) (statistics.Series, error) {
+	m.rng = rng
+	m.opts = statistics.Options{Fill: fill}
+	return statistics.NewSeries(sensors, m.stats), m.err
+}
+
+func (m *MockRepository) Latest(ctx context.Context, vehicle string) (statistics.Statistics, error) {
 	return m.latest, m.err
 }
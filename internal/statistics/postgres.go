@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
@@ -25,45 +27,45 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-// Latest returns a Statistics type whose fields will be populated with the most recent data available within
-// the database.
-func (r *PostgresRepository) Latest(ctx context.Context) (Statistics, error) {
+// Latest returns a Statistics type whose fields will be populated with the most recent data available for a vehicle
+// within the database.
+func (r *PostgresRepository) Latest(ctx context.Context, vehicle string) (Statistics, error) {
 	var stats Statistics
 	var err error
 
 	err = postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
-		stats.Speed, err = r.latestReading(ctx, tx, reading.SensorTypeSpeed)
+		stats.Speed, err = r.latestReading(ctx, tx, vehicle, reading.SensorTypeSpeed)
 		if err != nil {
 			return err
 		}
 
-		stats.Fuel, err = r.latestReading(ctx, tx, reading.SensorTypeFuel)
+		stats.Fuel, err = r.latestReading(ctx, tx, vehicle, reading.SensorTypeFuel)
 		if err != nil {
 			return err
 		}
 
-		stats.EngineTemperature, err = r.latestReading(ctx, tx, reading.SensorTypeEngineTemperature)
+		stats.EngineTemperature, err = r.latestReading(ctx, tx, vehicle, reading.SensorTypeEngineTemperature)
 		if err != nil {
 			return err
 		}
 
-		stats.Revolutions, err = r.latestReading(ctx, tx, reading.SensorTypeRevolution)
+		stats.Revolutions, err = r.latestReading(ctx, tx, vehicle, reading.SensorTypeRevolution)
 		return err
 	})
 
 	return stats, err
 }
 
-func (r *PostgresRepository) latestReading(ctx context.Context, tx *sql.Tx, sensor reading.SensorType) (float64, error) {
+func (r *PostgresRepository) latestReading(ctx context.Context, tx *sql.Tx, vehicle string, sensor reading.SensorType) (float64, error) {
 	const q = `
 		SELECT value FROM reading
-		WHERE sensor = $1
+		WHERE vehicle = $1 AND sensor = $2
 		ORDER BY timestamp DESC 
 		FETCH FIRST ROW ONLY
 	`
 
 	var value float64
-	row := tx.QueryRowContext(ctx, q, sensor)
+	row := tx.QueryRowContext(ctx, q, vehicle, sensor)
 
 	err := row.Scan(&value)
 	switch {
@@ -76,49 +78,117 @@ func (r *PostgresRepository) latestReading(ctx context.Context, tx *sql.Tx, sens
 	}
 }
 
-// ForDate queries the database for time-bucketed statistics on a given date for a sensor type. Statistics are averaged
-// in 15 minute intervals.
-func (r *PostgresRepository) ForDate(ctx context.Context, date time.Time, sensor reading.SensorType) ([]Statistic, error) {
+// ForDate queries the database for time-bucketed statistics on a given date for a vehicle's sensor type. The
+// boundaries of the day are determined using the location of the given time. Statistics are averaged in 15 minute
+// intervals, as modified by the Options.
+func (r *PostgresRepository) ForDate(ctx context.Context, vehicle string, date time.Time, sensor reading.SensorType, opts Options) ([]Statistic, error) {
+	return r.ForRange(ctx, vehicle, sensor, Day(date, time.Minute*15), opts)
+}
+
+// ForRange queries the database for time-bucketed statistics within a Range for a vehicle's sensor type. Statistics
+// are averaged over each of the Range's intervals, as modified by the Options.
+func (r *PostgresRepository) ForRange(ctx context.Context, vehicle string, sensor reading.SensorType, rng Range, opts Options) ([]Statistic, error) {
+	return r.bucketed(ctx, vehicle, []reading.SensorType{sensor}, rng, opts)
+}
+
+// Series queries the database for time-bucketed statistics within a Range for several of a vehicle's sensor types,
+// aligned so that each row of the Series contains the value of every sensor for a single bucket. Statistics are
+// averaged over each of the Range's intervals, as modified by the Fill.
+func (r *PostgresRepository) Series(ctx context.Context, vehicle string, sensors []reading.SensorType, rng Range, fill Fill) (Series, error) {
+	stats, err := r.bucketed(ctx, vehicle, sensors, rng, Options{Fill: fill})
+	if err != nil {
+		return Series{}, err
+	}
+
+	return NewSeries(sensors, stats), nil
+}
+
+// bucketed queries the database for time-bucketed statistics within a Range for one or more of a vehicle's sensor
+// types. Statistics are ordered by bucket, then by sensor.
+func (r *PostgresRepository) bucketed(ctx context.Context, vehicle string, sensors []reading.SensorType, rng Range, opts Options) ([]Statistic, error) {
+	args := []interface{}{vehicle, rng.From, rng.To, rng.Interval.Seconds()}
+
+	placeholders := make([]string, len(sensors))
+	for i, sensor := range sensors {
+		args = append(args, sensor)
+		placeholders[i] = fmt.Sprint("$", len(args))
+	}
+
+	value, err := fillColumn(opts.Fill)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns strings.Builder
+	for _, aggregation := range opts.Aggregations {
+		column, err := aggregationColumn(aggregation, &args)
+		if err != nil {
+			return nil, err
+		}
+
+		columns.WriteString(column)
+		columns.WriteString(",\n")
+	}
+
 	out := make([]Statistic, 0)
-	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
-		// This query returns the average value of the sensor over 15 minute increments. It uses the
-		// time_bucket_gapfill function to automatically fill in times for the rest of the day when
-		// the dataset is incomplete. It uses locf to set the values for the missing timestamps to the
-		// previous known value. The time range is inferred by the WHERE clause of the query.
+	err = postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		// This query returns the average value of each sensor over each interval. It uses the
+		// time_bucket_gapfill function to automatically fill in times for the rest of the range when
+		// the dataset is incomplete, the average for these buckets is then replaced according to the
+		// fill. The start & end of the range are given explicitly so that gaps at either end are also
+		// filled. The columns for any additional aggregations are NULL for the filled buckets.
 		//
 		// https://docs.timescale.com/api/latest/hyperfunctions/gapfilling-interpolation/time_bucket_gapfill
 		// https://docs.timescale.com/api/latest/hyperfunctions/gapfilling-interpolation/locf
-		const q = `
+		// https://docs.timescale.com/api/latest/hyperfunctions/gapfilling-interpolation/interpolate
+		q := `
 			SELECT 
 				sensor,
-				COALESCE(AVG(value), 0),
-				locf(AVG(value)),
-				time_bucket_gapfill('15 minutes', timestamp) AS bucket
+				` + value + `,
+				` + columns.String() + `
+				time_bucket_gapfill(make_interval(secs => $4), timestamp, $2, $3) AS bucket
 			FROM reading 
 			WHERE 
-				sensor = $1
-				AND timestamp >= $2::DATE 
-				AND timestamp < ($2::DATE + INTERVAL '1 day')
+				vehicle = $1
+				AND sensor IN (` + strings.Join(placeholders, ", ") + `)
+				AND timestamp >= $2
+				AND timestamp < $3
 			GROUP BY bucket, sensor
-			ORDER BY bucket ASC
+			ORDER BY bucket ASC, sensor ASC
 		`
 
-		rows, err := tx.QueryContext(ctx, q, sensor, date)
+		rows, err := tx.QueryContext(ctx, q, args...)
 		if err != nil {
 			return err
 		}
 		defer closers.Close(rows)
 
-		var locf sql.NullFloat64
+		var avg sql.NullFloat64
+		values := make([]sql.NullFloat64, len(opts.Aggregations))
 		for rows.Next() {
 			var stat Statistic
 
-			// We don't actually care about the locf value, but it allows timescale to fill in all the missing
-			// intervals with a NULL value that we coalesce to zero. So we scan it and throw it away.
-			if err = rows.Scan(&stat.Sensor, &stat.Value, &locf, &stat.Timestamp); err != nil {
+			dest := []interface{}{&stat.Sensor, &avg}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			dest = append(dest, &stat.Timestamp)
+
+			if err = rows.Scan(dest...); err != nil {
 				return err
 			}
 
+			if avg.Valid {
+				value := avg.Float64
+				stat.Value = &value
+			}
+
+			for i, value := range values {
+				if value.Valid {
+					stat.Set(opts.Aggregations[i], value.Float64)
+				}
+			}
+
 			out = append(out, stat)
 		}
 
@@ -131,3 +201,46 @@ func (r *PostgresRepository) ForDate(ctx context.Context, date time.Time, sensor
 
 	return out, err
 }
+
+// fillColumn returns the SQL expression used to compute the average value of a bucket using a Fill.
+func fillColumn(fill Fill) (string, error) {
+	switch fill {
+	case FillNull:
+		return "AVG(value)", nil
+	case FillZero, "":
+		return "COALESCE(AVG(value), 0)", nil
+	case FillLOCF:
+		return "locf(AVG(value))", nil
+	case FillInterpolate:
+		return "interpolate(AVG(value))", nil
+	default:
+		return "", fmt.Errorf("unknown fill %q", fill)
+	}
+}
+
+// aggregationColumn returns the SQL expression used to compute an Aggregation. Any arguments the expression requires
+// are appended to args.
+func aggregationColumn(aggregation Aggregation, args *[]interface{}) (string, error) {
+	switch aggregation {
+	case AggregationMin:
+		return "MIN(value)", nil
+	case AggregationMax:
+		return "MAX(value)", nil
+	case AggregationFirst:
+		return "first(value, timestamp)", nil
+	case AggregationLast:
+		return "last(value, timestamp)", nil
+	case AggregationCount:
+		return "COUNT(value)", nil
+	case AggregationStdDev:
+		return "STDDEV_SAMP(value)", nil
+	}
+
+	percentile, ok := aggregation.Percentile()
+	if !ok {
+		return "", fmt.Errorf("unknown aggregation %q", aggregation)
+	}
+
+	*args = append(*args, percentile)
+	return fmt.Sprintf("percentile_cont($%d) WITHIN GROUP (ORDER BY value)", len(*args)), nil
+}
@@ -26,25 +26,36 @@ func TestPostgresRepository_Latest(t *testing.T) {
 	// Insert readings that we can query
 	seed := []reading.Reading{
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     10,
 			Timestamp: time.Now(),
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeFuel,
 			Value:     50,
 			Timestamp: time.Now(),
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeEngineTemperature,
 			Value:     30,
 			Timestamp: time.Now(),
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeRevolution,
 			Value:     1000,
 			Timestamp: time.Now(),
 		},
+		{
+			// A more recent reading for another vehicle should not be included in the results.
+			Vehicle:   "support",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     20,
+			Timestamp: time.Now().Add(time.Minute),
+		},
 	}
 
 	for _, s := range seed {
@@ -59,7 +70,7 @@ func TestPostgresRepository_Latest(t *testing.T) {
 			Revolutions:       1000,
 		}
 
-		actual, err := stats.Latest(ctx)
+		actual, err := stats.Latest(ctx, "lada")
 		require.NoError(t, err)
 		assert.EqualValues(t, expected, actual)
 	})
@@ -84,6 +95,7 @@ func TestPostgresRepository_ForDate(t *testing.T) {
 	for i := 60; i < 120; i++ {
 		ts := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
 		seed = append(seed, reading.Reading{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     10,
 			Timestamp: ts.Add(time.Minute * time.Duration(i)),
@@ -97,7 +109,7 @@ func TestPostgresRepository_ForDate(t *testing.T) {
 	t.Run("It should return time bucketed statistics", func(t *testing.T) {
 		date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
 
-		actual, err := stats.ForDate(ctx, date, reading.SensorTypeSpeed)
+		actual, err := stats.ForDate(ctx, "lada", date, reading.SensorTypeSpeed, statistics.Options{})
 		require.NoError(t, err)
 
 		// We expect 96 readings for 15 minute increments over 24 hours.
@@ -108,12 +120,189 @@ func TestPostgresRepository_ForDate(t *testing.T) {
 
 			// We only set values for the 1am hour, so anything before and after that should have a value of zero.
 			if elem.Timestamp.Hour() == 1 {
-				assert.EqualValues(t, float64(10), elem.Value)
+				assert.EqualValues(t, float64(10), *elem.Value)
 			} else {
-				assert.EqualValues(t, float64(0), elem.Value)
+				assert.EqualValues(t, float64(0), *elem.Value)
 			}
 
 			assert.NotZero(t, elem.Timestamp)
 		}
 	})
 }
+
+func TestPostgresRepository_ForRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+
+	readings := reading.NewPostgresRepository(db)
+	stats := statistics.NewPostgresRepository(db)
+
+	from := time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	// Create readings every second for the first minute of the range.
+	for i := 0; i < 60; i++ {
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     10,
+			Timestamp: from.Add(time.Second * time.Duration(i)),
+		}))
+	}
+
+	// Create readings every second for the first minute of the next hour with an increasing value.
+	for i := 0; i < 60; i++ {
+		require.NoError(t, readings.Save(ctx, reading.Reading{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     float64(i),
+			Timestamp: from.Add(time.Hour + time.Second*time.Duration(i)),
+		}))
+	}
+
+	t.Run("It should return statistics bucketed by the interval", func(t *testing.T) {
+		actual, err := stats.ForRange(ctx, "lada", reading.SensorTypeSpeed, statistics.Range{
+			From:     from,
+			To:       from.Add(time.Hour),
+			Interval: time.Second * 10,
+		}, statistics.Options{})
+		require.NoError(t, err)
+
+		// We expect 360 buckets for 10 second increments over an hour.
+		require.Len(t, actual, 360)
+
+		for _, elem := range actual {
+			if elem.Timestamp.Before(from.Add(time.Minute)) {
+				assert.EqualValues(t, float64(10), *elem.Value)
+			} else {
+				assert.EqualValues(t, float64(0), *elem.Value)
+			}
+		}
+	})
+
+	t.Run("It should return additional aggregations", func(t *testing.T) {
+		aggregations := []statistics.Aggregation{
+			statistics.AggregationMin,
+			statistics.AggregationMax,
+			statistics.AggregationFirst,
+			statistics.AggregationLast,
+			statistics.AggregationCount,
+			statistics.AggregationStdDev,
+			"p50",
+		}
+
+		actual, err := stats.ForRange(ctx, "lada", reading.SensorTypeSpeed, statistics.Range{
+			From:     from.Add(time.Hour),
+			To:       from.Add(time.Hour * 2),
+			Interval: time.Minute,
+		}, statistics.Options{Aggregations: aggregations})
+		require.NoError(t, err)
+		require.Len(t, actual, 60)
+
+		first := actual[0]
+		assert.EqualValues(t, 29.5, *first.Value)
+		assert.EqualValues(t, 0, *first.Min)
+		assert.EqualValues(t, 59, *first.Max)
+		assert.EqualValues(t, 0, *first.First)
+		assert.EqualValues(t, 59, *first.Last)
+		assert.EqualValues(t, 60, *first.Count)
+		assert.InDelta(t, 17.46, *first.StdDev, 0.01)
+		assert.EqualValues(t, 29.5, first.Percentiles["p50"])
+
+		// Gap filled buckets have no additional aggregations.
+		assert.Nil(t, actual[1].Min)
+	})
+
+	t.Run("It should fill empty buckets", func(t *testing.T) {
+		// Readings exist for the first minute of each of the two hours, so the buckets in between are empty.
+		rng := statistics.Range{
+			From:     from,
+			To:       from.Add(time.Hour * 2),
+			Interval: time.Minute * 30,
+		}
+
+		tt := []struct {
+			Fill     statistics.Fill
+			Expected []*float64
+		}{
+			{Fill: statistics.FillNull, Expected: []*float64{float(10), nil, float(29.5), nil}},
+			{Fill: statistics.FillZero, Expected: []*float64{float(10), float(0), float(29.5), float(0)}},
+			{Fill: statistics.FillLOCF, Expected: []*float64{float(10), float(10), float(29.5), float(29.5)}},
+			{Fill: statistics.FillInterpolate, Expected: []*float64{float(10), float(19.75), float(29.5), nil}},
+		}
+
+		for _, tc := range tt {
+			actual, err := stats.ForRange(ctx, "lada", reading.SensorTypeSpeed, rng, statistics.Options{Fill: tc.Fill})
+			require.NoError(t, err)
+			require.Len(t, actual, len(tc.Expected))
+
+			for i, expected := range tc.Expected {
+				assertFloat(t, expected, actual[i].Value)
+			}
+		}
+	})
+}
+
+func TestPostgresRepository_Series(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+		return
+	}
+
+	ctx := testutil.Context(t)
+	db := testutil.Postgres(t, ctx)
+
+	readings := reading.NewPostgresRepository(db)
+	stats := statistics.NewPostgresRepository(db)
+
+	from := time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC)
+	seed := []reading.Reading{
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     50,
+			Timestamp: from,
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeRevolution,
+			Value:     2000,
+			Timestamp: from.Add(time.Minute),
+		},
+		{
+			Vehicle:   "lada",
+			Sensor:    reading.SensorTypeSpeed,
+			Value:     70,
+			Timestamp: from.Add(time.Minute * 20),
+		},
+	}
+
+	for _, s := range seed {
+		require.NoError(t, readings.Save(ctx, s))
+	}
+
+	t.Run("It should return aligned rows for each bucket", func(t *testing.T) {
+		sensors := []reading.SensorType{reading.SensorTypeSpeed, reading.SensorTypeRevolution}
+		actual, err := stats.Series(ctx, "lada", sensors, statistics.Range{
+			From:     from,
+			To:       from.Add(time.Minute * 30),
+			Interval: time.Minute * 15,
+		}, statistics.FillNull)
+		require.NoError(t, err)
+
+		assert.EqualValues(t, sensors, actual.Sensors)
+		require.Len(t, actual.Rows, 2)
+
+		assert.True(t, from.Equal(actual.Rows[0].Timestamp))
+		assertFloat(t, float(50), actual.Rows[0].Values[0])
+		assertFloat(t, float(2000), actual.Rows[0].Values[1])
+
+		assert.True(t, from.Add(time.Minute*15).Equal(actual.Rows[1].Timestamp))
+		assertFloat(t, float(70), actual.Rows[1].Values[0])
+		assert.Nil(t, actual.Rows[1].Values[1])
+	})
+}
@@ -3,24 +3,304 @@
 package statistics
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/pkg/units"
 )
 
 type (
-	// The Statistics type contains fields describing the current state of the Lada.
+	// The Statistics type contains fields describing the current state of a vehicle. The Units field contains the
+	// unit of each value, keyed by sensor.
 	Statistics struct {
-		Speed             float64 `json:"speed"`
-		Fuel              float64 `json:"fuel"`
-		EngineTemperature float64 `json:"engineTemperature"`
-		Revolutions       float64 `json:"revolutions"`
+		Speed             float64                           `json:"speed"`
+		Fuel              float64                           `json:"fuel"`
+		EngineTemperature float64                           `json:"engineTemperature"`
+		Revolutions       float64                           `json:"revolutions"`
+		Units             map[reading.SensorType]units.Unit `json:"units,omitempty"`
 	}
 
-	// The Statistic type contains fields describing a bucketed sensor value at a given time.
+	// The Statistic type contains fields describing a bucketed sensor value at a given time. The Value field is always
+	// the average value within the bucket, or its replacement according to the Fill when the bucket contains no
+	// readings. The remaining values are only populated when their Aggregation is requested and the bucket contains
+	// readings.
 	Statistic struct {
-		Sensor    reading.SensorType `json:"sensor"`
-		Value     float64            `json:"value"`
-		Timestamp time.Time          `json:"timestamp"`
+		Sensor      reading.SensorType      `json:"sensor"`
+		Value       *float64                `json:"value"`
+		Unit        units.Unit              `json:"unit,omitempty"`
+		Timestamp   time.Time               `json:"timestamp"`
+		Min         *float64                `json:"min,omitempty"`
+		Max         *float64                `json:"max,omitempty"`
+		First       *float64                `json:"first,omitempty"`
+		Last        *float64                `json:"last,omitempty"`
+		Count       *int64                  `json:"count,omitempty"`
+		StdDev      *float64                `json:"stddev,omitempty"`
+		Percentiles map[Aggregation]float64 `json:"percentiles,omitempty"`
 	}
+
+	// The Aggregation type describes a function applied to the readings within each bucket, in addition to the
+	// average. Percentiles are given as a "p" followed by the percentile, such as "p95" or "p99.9".
+	Aggregation string
+
+	// The Fill type describes how the value of a bucket that contains no readings is determined.
+	Fill string
+
+	// The Options type contains fields that modify how each bucket of statistics is computed.
+	Options struct {
+		// Additional aggregations to compute for each bucket.
+		Aggregations []Aggregation
+		// How to determine the value of buckets that contain no readings.
+		Fill Fill
+	}
+
+	// The Series type contains time-bucketed values for several sensors, aligned so that each row contains the value
+	// of every sensor for a single bucket. The values within each row, and the Units, are in the same order as the
+	// Sensors.
+	Series struct {
+		Sensors []reading.SensorType `json:"sensors"`
+		Units   []units.Unit         `json:"units"`
+		Rows    []SeriesRow          `json:"rows"`
+	}
+
+	// The SeriesRow type contains the values of each sensor within a Series for a single bucket. A value is null
+	// when the sensor has no value for the bucket.
+	SeriesRow struct {
+		Timestamp time.Time  `json:"timestamp"`
+		Values    []*float64 `json:"values"`
+	}
+
+	// The Range type describes a period of time to return bucketed statistics for.
+	Range struct {
+		// The start of the range, inclusive.
+		From time.Time
+		// The end of the range, exclusive.
+		To time.Time
+		// The width of each bucket within the range.
+		Interval time.Duration
+	}
+)
+
+// Constants for aggregations other than percentiles.
+const (
+	AggregationMin    = Aggregation("min")
+	AggregationMax    = Aggregation("max")
+	AggregationFirst  = Aggregation("first")
+	AggregationLast   = Aggregation("last")
+	AggregationCount  = Aggregation("count")
+	AggregationStdDev = Aggregation("stddev")
 )
+
+// Constants for fill strategies.
+const (
+	// FillNull leaves the value of empty buckets as null.
+	FillNull = Fill("null")
+	// FillZero sets the value of empty buckets to zero.
+	FillZero = Fill("zero")
+	// FillLOCF sets the value of empty buckets to the last value observed before them.
+	FillLOCF = Fill("locf")
+	// FillInterpolate linearly interpolates the value of empty buckets between the values either side of them.
+	FillInterpolate = Fill("interpolate")
+)
+
+// MaxSeriesSensors is the maximum number of sensors a Series may contain.
+const MaxSeriesSensors = 10
+
+// MaxAggregations is the maximum number of aggregations that can be requested at once.
+const MaxAggregations = 10
+
+const (
+	// MaxBuckets is the maximum number of buckets a Range may contain.
+	MaxBuckets = 2000
+	// MinInterval is the smallest bucket width a Range may use.
+	MinInterval = time.Second
+)
+
+// Day returns a Range covering the date component of the given time using buckets of the given interval. The
+// boundaries of the day are determined using the location of the given time, so a day may be shorter or longer than
+// 24 hours around daylight saving time transitions.
+func Day(date time.Time, interval time.Duration) Range {
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	return Range{
+		From:     from,
+		To:       from.AddDate(0, 0, 1),
+		Interval: interval,
+	}
+}
+
+// Validate returns a non-nil error describing why the Range is invalid, if it is.
+func (r Range) Validate() error {
+	switch {
+	case r.From.IsZero() || r.To.IsZero():
+		return errors.New("a range requires a start & end time")
+	case !r.From.Before(r.To):
+		return fmt.Errorf("start of range %s is not before its end %s", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	case r.Interval < MinInterval:
+		return fmt.Errorf("interval %s is shorter than the minimum of %s", r.Interval, MinInterval)
+	case r.Buckets() > MaxBuckets:
+		return fmt.Errorf("range contains %d buckets, more than the maximum of %d", r.Buckets(), MaxBuckets)
+	default:
+		return nil
+	}
+}
+
+// Buckets returns the number of buckets of the Range's interval needed to cover the Range.
+func (r Range) Buckets() int {
+	if r.Interval <= 0 {
+		return 0
+	}
+
+	span := r.To.Sub(r.From)
+	buckets := span / r.Interval
+	if span%r.Interval != 0 {
+		buckets++
+	}
+
+	return int(buckets)
+}
+
+// ParseAggregations parses a list of Aggregation values, typically from the query parameters of an HTTP request. Each
+// value may contain several aggregations separated by commas. Duplicate aggregations are removed.
+func ParseAggregations(values []string) ([]Aggregation, error) {
+	out := make([]Aggregation, 0)
+	seen := make(map[Aggregation]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			aggregation, err := parseAggregation(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+
+			if seen[aggregation] {
+				continue
+			}
+
+			seen[aggregation] = true
+			out = append(out, aggregation)
+		}
+	}
+
+	if len(out) > MaxAggregations {
+		return nil, fmt.Errorf("%d aggregations requested, more than the maximum of %d", len(out), MaxAggregations)
+	}
+
+	return out, nil
+}
+
+func parseAggregation(name string) (Aggregation, error) {
+	aggregation := Aggregation(strings.ToLower(name))
+	switch aggregation {
+	case AggregationMin, AggregationMax, AggregationFirst, AggregationLast, AggregationCount, AggregationStdDev:
+		return aggregation, nil
+	}
+
+	percentile, ok := aggregation.percentile()
+	if !ok {
+		return "", fmt.Errorf("unknown aggregation %q", name)
+	}
+
+	// Normalise the percentile so that "p95" and "p95.0" are treated as the same aggregation. This uses the parsed
+	// percentile rather than the fraction, which can't represent values such as 0.57 exactly.
+	return Aggregation("p" + strconv.FormatFloat(percentile, 'f', -1, 64)), nil
+}
+
+// Percentile returns the fraction, between zero and one, of a percentile Aggregation. Returns false if the Aggregation
+// is not a percentile.
+func (a Aggregation) Percentile() (float64, bool) {
+	percentile, ok := a.percentile()
+	if !ok {
+		return 0, false
+	}
+
+	return percentile / 100, true
+}
+
+func (a Aggregation) percentile() (float64, bool) {
+	if !strings.HasPrefix(string(a), "p") {
+		return 0, false
+	}
+
+	percentile, err := strconv.ParseFloat(strings.TrimPrefix(string(a), "p"), 64)
+	if err != nil || math.IsNaN(percentile) || percentile <= 0 || percentile >= 100 {
+		return 0, false
+	}
+
+	return percentile, true
+}
+
+// Set the value of the Aggregation on the Statistic.
+func (s *Statistic) Set(aggregation Aggregation, value float64) {
+	switch aggregation {
+	case AggregationMin:
+		s.Min = &value
+	case AggregationMax:
+		s.Max = &value
+	case AggregationFirst:
+		s.First = &value
+	case AggregationLast:
+		s.Last = &value
+	case AggregationCount:
+		count := int64(value)
+		s.Count = &count
+	case AggregationStdDev:
+		s.StdDev = &value
+	default:
+		if s.Percentiles == nil {
+			s.Percentiles = make(map[Aggregation]float64)
+		}
+
+		s.Percentiles[aggregation] = value
+	}
+}
+
+// ParseFill parses a Fill from its name. An empty name is parsed as FillZero.
+func ParseFill(name string) (Fill, error) {
+	fill := Fill(strings.ToLower(name))
+	switch fill {
+	case "":
+		return FillZero, nil
+	case FillNull, FillZero, FillLOCF, FillInterpolate:
+		return fill, nil
+	default:
+		return "", fmt.Errorf("unknown fill %q", name)
+	}
+}
+
+// NewSeries returns a Series for the sensors containing the values of each Statistic. The statistics must be ordered
+// by timestamp. Statistics for sensors not in the list are ignored.
+func NewSeries(sensors []reading.SensorType, stats []Statistic) Series {
+	columns := make(map[reading.SensorType]int, len(sensors))
+	for i, sensor := range sensors {
+		columns[sensor] = i
+	}
+
+	series := Series{
+		Sensors: sensors,
+		Units:   make([]units.Unit, len(sensors)),
+		Rows:    make([]SeriesRow, 0),
+	}
+
+	for _, stat := range stats {
+		column, ok := columns[stat.Sensor]
+		if !ok {
+			continue
+		}
+
+		last := len(series.Rows) - 1
+		if last < 0 || !series.Rows[last].Timestamp.Equal(stat.Timestamp) {
+			series.Rows = append(series.Rows, SeriesRow{
+				Timestamp: stat.Timestamp,
+				Values:    make([]*float64, len(sensors)),
+			})
+			last++
+		}
+
+		series.Rows[last].Values[column] = stat.Value
+	}
+
+	return series
+}
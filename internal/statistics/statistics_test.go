@@ -0,0 +1,283 @@
+package statistics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/internal/reading"
+	"github.com/cloud-lada/backend/internal/statistics"
+	"github.com/cloud-lada/backend/pkg/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRange_Validate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		Name         string
+		Range        statistics.Range
+		ExpectsError bool
+	}{
+		{
+			Name: "It should accept the last hour at 10 second intervals",
+			Range: statistics.Range{
+				From:     now.Add(-time.Hour),
+				To:       now,
+				Interval: time.Second * 10,
+			},
+		},
+		{
+			Name: "It should accept a week at 1 hour intervals",
+			Range: statistics.Range{
+				From:     now.AddDate(0, 0, -7),
+				To:       now,
+				Interval: time.Hour,
+			},
+		},
+		{
+			Name: "It should reject a range without a start",
+			Range: statistics.Range{
+				To:       now,
+				Interval: time.Hour,
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should reject a range that ends before it starts",
+			Range: statistics.Range{
+				From:     now,
+				To:       now.Add(-time.Hour),
+				Interval: time.Minute,
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should reject intervals below the minimum",
+			Range: statistics.Range{
+				From:     now.Add(-time.Minute),
+				To:       now,
+				Interval: time.Millisecond,
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should reject ranges with too many buckets",
+			Range: statistics.Range{
+				From:     now.AddDate(0, 0, -7),
+				To:       now,
+				Interval: time.Minute,
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Range.Validate()
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRange_Buckets(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.EqualValues(t, 96, statistics.Range{From: now, To: now.AddDate(0, 0, 1), Interval: time.Minute * 15}.Buckets())
+	assert.EqualValues(t, 2, statistics.Range{From: now, To: now.Add(time.Second * 11), Interval: time.Second * 10}.Buckets())
+}
+
+func TestParseAggregations(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Values       []string
+		Expected     []statistics.Aggregation
+		ExpectsError bool
+	}{
+		{
+			Name:     "It should return no aggregations by default",
+			Expected: []statistics.Aggregation{},
+		},
+		{
+			Name:   "It should parse comma separated & repeated aggregations",
+			Values: []string{"min,max", "p95"},
+			Expected: []statistics.Aggregation{
+				statistics.AggregationMin,
+				statistics.AggregationMax,
+				"p95",
+			},
+		},
+		{
+			Name:   "It should remove duplicate aggregations",
+			Values: []string{"MAX,max", "p99.0,p99"},
+			Expected: []statistics.Aggregation{
+				statistics.AggregationMax,
+				"p99",
+			},
+		},
+		{
+			Name:     "It should normalise percentiles without losing precision",
+			Values:   []string{"p29,p57.0,p99.9"},
+			Expected: []statistics.Aggregation{"p29", "p57", "p99.9"},
+		},
+		{
+			Name:         "It should return an error for unknown aggregations",
+			Values:       []string{"median"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error for percentiles out of range",
+			Values:       []string{"p100"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error for too many aggregations",
+			Values:       []string{"min,max,first,last,count,stddev,p1,p2,p3,p4,p5"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := statistics.ParseAggregations(tc.Values)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
+
+func TestDay(t *testing.T) {
+	t.Parallel()
+
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name            string
+		Date            time.Time
+		ExpectedFrom    time.Time
+		ExpectedTo      time.Time
+		ExpectedBuckets int
+	}{
+		{
+			Name:            "It should cover a UTC day",
+			Date:            time.Date(2022, 3, 27, 15, 0, 0, 0, time.UTC),
+			ExpectedFrom:    time.Date(2022, 3, 27, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:      time.Date(2022, 3, 28, 0, 0, 0, 0, time.UTC),
+			ExpectedBuckets: 96,
+		},
+		{
+			Name:            "It should cover a 23 hour day when the clocks go forward",
+			Date:            time.Date(2022, 3, 27, 15, 0, 0, 0, london),
+			ExpectedFrom:    time.Date(2022, 3, 27, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:      time.Date(2022, 3, 27, 23, 0, 0, 0, time.UTC),
+			ExpectedBuckets: 92,
+		},
+		{
+			Name:            "It should cover a 25 hour day when the clocks go back",
+			Date:            time.Date(2022, 10, 30, 15, 0, 0, 0, london),
+			ExpectedFrom:    time.Date(2022, 10, 29, 23, 0, 0, 0, time.UTC),
+			ExpectedTo:      time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC),
+			ExpectedBuckets: 100,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := statistics.Day(tc.Date, time.Minute*15)
+			assert.True(t, tc.ExpectedFrom.Equal(actual.From), actual.From)
+			assert.True(t, tc.ExpectedTo.Equal(actual.To), actual.To)
+			assert.EqualValues(t, tc.ExpectedBuckets, actual.Buckets())
+		})
+	}
+}
+
+func TestParseFill(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Value        string
+		Expected     statistics.Fill
+		ExpectsError bool
+	}{
+		{
+			Name:     "It should default to zero",
+			Expected: statistics.FillZero,
+		},
+		{
+			Name:     "It should parse null",
+			Value:    "null",
+			Expected: statistics.FillNull,
+		},
+		{
+			Name:     "It should parse locf",
+			Value:    "LOCF",
+			Expected: statistics.FillLOCF,
+		},
+		{
+			Name:     "It should parse interpolate",
+			Value:    "interpolate",
+			Expected: statistics.FillInterpolate,
+		},
+		{
+			Name:         "It should return an error for unknown fills",
+			Value:        "guess",
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := statistics.ParseFill(tc.Value)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.Expected, actual)
+		})
+	}
+}
+
+func TestNewSeries(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sensors := []reading.SensorType{reading.SensorTypeSpeed, reading.SensorTypeRevolution}
+
+	stats := []statistics.Statistic{
+		{Sensor: reading.SensorTypeRevolution, Value: float(1000), Timestamp: now},
+		{Sensor: reading.SensorTypeSpeed, Value: float(50), Timestamp: now},
+		{Sensor: reading.SensorTypeFuel, Value: float(20), Timestamp: now},
+		{Sensor: reading.SensorTypeSpeed, Value: float(60), Timestamp: now.Add(time.Minute)},
+	}
+
+	expected := statistics.Series{
+		Sensors: sensors,
+		Units:   make([]units.Unit, 2),
+		Rows: []statistics.SeriesRow{
+			{Timestamp: now, Values: []*float64{float(50), float(1000)}},
+			{Timestamp: now.Add(time.Minute), Values: []*float64{float(60), nil}},
+		},
+	}
+
+	assert.EqualValues(t, expected, statistics.NewSeries(sensors, stats))
+}
@@ -17,7 +17,7 @@ type (
 	// The Repository interface describes types that can query the status of the data within the persistent
 	// storage.
 	Repository interface {
-		Status(ctx context.Context) (Status, error)
+		Status(ctx context.Context, vehicle string) (Status, error)
 	}
 )
 
@@ -27,10 +27,10 @@ func NewHTTP(statuses Repository) *HTTP {
 	return &HTTP{statuses: statuses}
 }
 
-// Status handles an inbound HTTP GET request that returns information on the status of data ingestion from the
-// Repository.
+// Status handles an inbound HTTP GET request that returns information on the status of data ingestion for a vehicle
+// from the Repository.
 func (h *HTTP) Status(w http.ResponseWriter, r *http.Request) {
-	status, err := h.statuses.Status(r.Context())
+	status, err := h.statuses.Status(r.Context(), mux.Vars(r)["vehicle"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -44,5 +44,5 @@ func (h *HTTP) Status(w http.ResponseWriter, r *http.Request) {
 
 // Register the HTTP routes into the given router.
 func (h *HTTP) Register(router *mux.Router) {
-	router.HandleFunc("/status", h.Status).Methods(http.MethodGet)
+	router.HandleFunc("/vehicles/{vehicle}/status", h.Status).Methods(http.MethodGet)
 }
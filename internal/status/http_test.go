@@ -47,7 +47,7 @@ func TestHTTP_Status(t *testing.T) {
 			status.NewHTTP(repo).Register(router)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/status", nil)
+			r := httptest.NewRequest(http.MethodGet, "/vehicles/lada/status", nil)
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
@@ -13,6 +13,6 @@ type (
 	}
 )
 
-func (m *MockRepository) Status(ctx context.Context) (status.Status, error) {
+func (m *MockRepository) Status(ctx context.Context, vehicle string) (status.Status, error) {
 	return m.status, m.err
 }
@@ -22,14 +22,14 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-// Status returns the current status of data within the database.
-func (r *PostgresRepository) Status(ctx context.Context) (Status, error) {
+// Status returns the current status of data for a vehicle within the database.
+func (r *PostgresRepository) Status(ctx context.Context, vehicle string) (Status, error) {
 	var status Status
 
 	err := postgres.WithinReadOnlyTransaction(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
-		const q = `SELECT MAX(timestamp) FROM reading`
+		const q = `SELECT MAX(timestamp) FROM reading WHERE vehicle = $1`
 
-		row := tx.QueryRowContext(ctx, q)
+		row := tx.QueryRowContext(ctx, q, vehicle)
 		err := row.Scan(&status.LastIngestTimestamp)
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
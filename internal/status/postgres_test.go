@@ -26,16 +26,19 @@ func TestPostgresRepository_Status(t *testing.T) {
 	// Insert readings that we can query
 	seed := []reading.Reading{
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     10,
 			Timestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     10,
 			Timestamp: time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
 		},
 		{
+			Vehicle:   "lada",
 			Sensor:    reading.SensorTypeSpeed,
 			Value:     10,
 			Timestamp: time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC),
@@ -51,7 +54,7 @@ func TestPostgresRepository_Status(t *testing.T) {
 			LastIngestTimestamp: time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC),
 		}
 
-		actual, err := statuses.Status(ctx)
+		actual, err := statuses.Status(ctx, "lada")
 		require.NoError(t, err)
 		assert.EqualValues(t, expected, actual)
 	})
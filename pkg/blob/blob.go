@@ -3,6 +3,7 @@ package blob
 
 import (
 	"context"
+	"errors"
 	"io"
 
 	"gocloud.dev/blob"
@@ -11,6 +12,7 @@ import (
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/memblob"
 	_ "gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
 )
 
 type (
@@ -20,6 +22,9 @@ type (
 	}
 )
 
+// ErrNotFound is the error returned when reading a blob that does not exist.
+var ErrNotFound = errors.New("blob not found")
+
 // Open a connection with the blob storage bucket described in the url string.
 func Open(ctx context.Context, url string) (*Bucket, error) {
 	bucket, err := blob.OpenBucket(ctx, url)
@@ -36,7 +41,8 @@ func (b *Bucket) Close() error {
 }
 
 // NewWriter returns an io.WriteCloser implementation that will write binary data as a blob within the Bucket under
-// the specified name.
+// the specified name. The blob is stored once the writer is closed. If the context is cancelled before then, the blob
+// is discarded.
 func (b *Bucket) NewWriter(ctx context.Context, name string) (io.WriteCloser, error) {
 	writer, err := b.bucket.NewWriter(ctx, name, nil)
 	if err != nil {
@@ -45,3 +51,22 @@ func (b *Bucket) NewWriter(ctx context.Context, name string) (io.WriteCloser, er
 
 	return writer, nil
 }
+
+// NewReader returns an io.ReadCloser implementation that will read binary data from the blob within the Bucket under
+// the specified name. Returns ErrNotFound if the blob does not exist.
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := b.bucket.NewReader(ctx, name, nil)
+	switch {
+	case gcerrors.Code(err) == gcerrors.NotFound:
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// Delete the blob within the Bucket under the specified name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	return b.bucket.Delete(ctx, name)
+}
@@ -0,0 +1,116 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// The Batch type is used to buffer messages in-memory and publish them onto an event bus in groups. A batch is
+	// published once it reaches its maximum size, or once the flush interval has elapsed since its first message was
+	// buffered. Batch.Flush must be called once all messages have been written to publish any that remain.
+	Batch struct {
+		mu       sync.Mutex
+		writer   BatchWriter
+		size     int
+		interval time.Duration
+		messages []Envelope
+		started  time.Time
+		timer    *time.Timer
+		// An error from a flush triggered by the timer, returned by the next call to Write or Flush.
+		err error
+	}
+
+	// The BatchWriter interface describes types that can publish multiple messages onto an event bus at once.
+	BatchWriter interface {
+		WriteBatch(ctx context.Context, envelopes []Envelope) error
+	}
+)
+
+// NewBatch returns a new instance of the Batch type that will publish messages via the BatchWriter implementation
+// in groups of up to size messages, or after the given interval has elapsed since the first message was buffered.
+// A size of one or fewer will cause each message to be published as it is written.
+func NewBatch(writer BatchWriter, size int, interval time.Duration) *Batch {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Batch{
+		writer:   writer,
+		size:     size,
+		interval: interval,
+		messages: make([]Envelope, 0, size),
+	}
+}
+
+// Write an Envelope into the batch. If the batch is full or the flush interval has elapsed, all buffered
+// messages are published before returning. Otherwise, the messages are published in the background once the
+// flush interval elapses, using the context given when the first of them was written. Returns any error from
+// a previous background publish once the envelope has been buffered, so the envelope itself is never lost to an
+// earlier failure.
+func (b *Batch) Write(ctx context.Context, envelope Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.messages) == 0 {
+		b.started = time.Now()
+		if b.interval > 0 {
+			b.timer = time.AfterFunc(b.interval, func() {
+				b.flushTimed(ctx)
+			})
+		}
+	}
+
+	b.messages = append(b.messages, envelope)
+	if len(b.messages) >= b.size || time.Since(b.started) >= b.interval {
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	return b.takeError()
+}
+
+// Flush publishes all buffered messages, returning once they have been acknowledged by the event bus. Returns any
+// error from a previous background publish.
+func (b *Batch) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.flush(ctx); err != nil {
+		return err
+	}
+
+	return b.takeError()
+}
+
+func (b *Batch) flushTimed(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.flush(ctx); err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Batch) flush(ctx context.Context) error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.messages) == 0 {
+		return nil
+	}
+
+	err := b.writer.WriteBatch(ctx, b.messages)
+	b.messages = b.messages[:0]
+	return err
+}
+
+func (b *Batch) takeError() error {
+	err := b.err
+	b.err = nil
+	return err
+}
@@ -0,0 +1,123 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch_Write(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name            string
+		Size            int
+		Interval        time.Duration
+		Messages        int
+		Error           error
+		ExpectsError    bool
+		ExpectedBatches []int
+	}{
+		{
+			Name:            "It should publish messages once the batch is full",
+			Size:            2,
+			Interval:        time.Minute,
+			Messages:        5,
+			ExpectedBatches: []int{2, 2, 1},
+		},
+		{
+			Name:            "It should publish each message when batching is disabled",
+			Size:            0,
+			Interval:        time.Minute,
+			Messages:        3,
+			ExpectedBatches: []int{1, 1, 1},
+		},
+		{
+			Name:            "It should publish messages once the interval has elapsed",
+			Size:            100,
+			Interval:        0,
+			Messages:        2,
+			ExpectedBatches: []int{1, 1},
+		},
+		{
+			Name:         "It should propagate errors from the writer",
+			Size:         1,
+			Interval:     time.Minute,
+			Messages:     1,
+			Error:        io.EOF,
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			writer := &MockBatchWriter{err: tc.Error}
+			batch := event.NewBatch(writer, tc.Size, tc.Interval)
+
+			for i := 0; i < tc.Messages; i++ {
+				err := batch.Write(ctx, event.Envelope{Body: json.RawMessage(`{}`)})
+				if tc.ExpectsError {
+					assert.Error(t, err)
+					return
+				}
+
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, batch.Flush(ctx))
+
+			assert.EqualValues(t, tc.ExpectedBatches, writer.sizes())
+		})
+	}
+}
+
+func TestBatch_FlushInterval(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	writer := &MockBatchWriter{}
+	batch := event.NewBatch(writer, 100, time.Millisecond*10)
+
+	assert.NoError(t, batch.Write(ctx, event.Envelope{Body: json.RawMessage(`{}`)}))
+	assert.NoError(t, batch.Write(ctx, event.Envelope{Body: json.RawMessage(`{}`)}))
+
+	// The partial batch should be published without further writes or an explicit flush.
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]int{2}, writer.sizes())
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, batch.Flush(ctx))
+	assert.EqualValues(t, []int{2}, writer.sizes())
+}
+
+func TestBatch_WriteAfterFailedFlush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	writer := &MockBatchWriter{err: event.ErrSpooled}
+	batch := event.NewBatch(writer, 100, time.Millisecond*10)
+
+	assert.NoError(t, batch.Write(ctx, event.Envelope{ID: "1", Body: json.RawMessage(`{}`)}))
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]int{1}, writer.sizes())
+	}, time.Second, time.Millisecond)
+
+	writer.setError(nil)
+
+	// The error from the background flush is reported, but the message being written must still be buffered and
+	// published rather than dropped.
+	assert.ErrorIs(t, batch.Write(ctx, event.Envelope{ID: "2", Body: json.RawMessage(`{}`)}), event.ErrSpooled)
+	assert.NoError(t, batch.Flush(ctx))
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if assert.Len(t, writer.batches, 2) {
+		assert.Equal(t, "2", writer.batches[1][0].ID)
+	}
+}
@@ -0,0 +1,88 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gocloud.dev/pubsub"
+)
+
+type (
+	// The Envelope type wraps the JSON-encoded body of an event along with metadata describing it. When published,
+	// the metadata is stored within the message metadata of the event bus so the body remains unchanged.
+	Envelope struct {
+		// The version of the schema that the body conforms to.
+		Version string `json:"version,omitempty"`
+		// The unique identifier of the event. If empty, one is generated when the event is published.
+		ID string `json:"id,omitempty"`
+		// The name of the application that produced the event.
+		Producer string `json:"producer,omitempty"`
+		// The time at which the event was accepted into the system. If zero, the time the event is published is
+		// used.
+		IngestedAt time.Time `json:"ingested_at"`
+		// The identifier of the device that the event originated from, if known.
+		DeviceID string `json:"device_id,omitempty"`
+		// The JSON-encoded event payload.
+		Body json.RawMessage `json:"body"`
+	}
+)
+
+// Metadata keys used to store Envelope fields on messages.
+const (
+	MetadataKeyVersion    = "version"
+	MetadataKeyID         = "id"
+	MetadataKeyProducer   = "producer"
+	MetadataKeyIngestedAt = "ingested_at"
+	MetadataKeyDeviceID   = "device_id"
+)
+
+func (e Envelope) toMessage() *pubsub.Message {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+
+	if e.IngestedAt.IsZero() {
+		e.IngestedAt = time.Now()
+	}
+
+	metadata := map[string]string{
+		MetadataKeyID:         e.ID,
+		MetadataKeyIngestedAt: e.IngestedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	// Optional fields are omitted entirely rather than being stored as empty strings.
+	for key, value := range map[string]string{
+		MetadataKeyVersion:  e.Version,
+		MetadataKeyProducer: e.Producer,
+		MetadataKeyDeviceID: e.DeviceID,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+
+	return &pubsub.Message{
+		Body:     e.Body,
+		Metadata: metadata,
+	}
+}
+
+// envelopeFromMessage returns the Envelope stored within a message. Messages published before envelopes were
+// introduced will have no metadata, so all fields other than the body will be empty.
+func envelopeFromMessage(message *pubsub.Message) Envelope {
+	envelope := Envelope{
+		Version:  message.Metadata[MetadataKeyVersion],
+		ID:       message.Metadata[MetadataKeyID],
+		Producer: message.Metadata[MetadataKeyProducer],
+		DeviceID: message.Metadata[MetadataKeyDeviceID],
+		Body:     message.Body,
+	}
+
+	if ingestedAt, ok := message.Metadata[MetadataKeyIngestedAt]; ok {
+		// A malformed timestamp shouldn't prevent the event from being read, so we just leave it zeroed.
+		envelope.IngestedAt, _ = time.Parse(time.RFC3339Nano, ingestedAt)
+	}
+
+	return envelope
+}
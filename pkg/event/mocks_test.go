@@ -0,0 +1,66 @@
+package event_test
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/cloud-lada/backend/pkg/event"
+)
+
+type (
+	MockBatchWriter struct {
+		mu      sync.Mutex
+		batches [][]event.Envelope
+		err     error
+	}
+
+	// MockBlockingBatchWriter fails to publish any batch other than one containing the given ID, which blocks until
+	// the release channel is closed.
+	MockBlockingBatchWriter struct {
+		id      string
+		started chan struct{}
+		release chan struct{}
+		batches [][]event.Envelope
+	}
+)
+
+func (m *MockBatchWriter) WriteBatch(_ context.Context, envelopes []event.Envelope) error {
+	batch := make([]event.Envelope, len(envelopes))
+	copy(batch, envelopes)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, batch)
+	return m.err
+}
+
+func (m *MockBatchWriter) setError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *MockBatchWriter) sizes() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sizes := make([]int, len(m.batches))
+	for i, b := range m.batches {
+		sizes[i] = len(b)
+	}
+
+	return sizes
+}
+
+func (m *MockBlockingBatchWriter) WriteBatch(_ context.Context, envelopes []event.Envelope) error {
+	if envelopes[0].ID != m.id {
+		return io.EOF
+	}
+
+	close(m.started)
+	<-m.release
+
+	m.batches = append(m.batches, envelopes)
+	return nil
+}
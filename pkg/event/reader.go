@@ -3,7 +3,9 @@ package event
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
 	"time"
 
 	"gocloud.dev/pubsub"
@@ -14,53 +16,323 @@ import (
 	_ "gocloud.dev/pubsub/mempubsub"
 	_ "gocloud.dev/pubsub/natspubsub"
 	_ "gocloud.dev/pubsub/rabbitpubsub"
+	"golang.org/x/sync/errgroup"
 )
 
 type (
 	// The Reader type is used to read individual events from an event stream.
 	Reader struct {
 		subscription *pubsub.Subscription
+		maxInFlight  int
+		maxAttempts  int
+		retryBackoff time.Duration
+		errorPolicy  ErrorPolicy
+		deadLetter   *Writer
+		logger       *log.Logger
 	}
 
+	// The ReaderConfig type contains fields used to configure a Reader.
+	ReaderConfig struct {
+		// The URL describing the event bus to read from.
+		URL string
+		// The maximum number of events (or batches of events) to handle concurrently. Defaults to one, which handles
+		// events sequentially.
+		MaxInFlight int
+		// Determines how the Reader behaves when handling an event fails. Defaults to ErrorPolicyStop.
+		ErrorPolicy ErrorPolicy
+		// The number of times handling an event is attempted before it is considered failed. Defaults to one.
+		MaxAttempts int
+		// How long to wait before the second attempt at handling an event, doubling after each further attempt up to
+		// a maximum of 30 seconds. Defaults to 100 milliseconds.
+		RetryBackoff time.Duration
+		// The Writer to publish events to once they have failed. The original event is acknowledged once it has been
+		// dead-lettered, so failed events do not block the Reader. If nil, the ErrorPolicy is applied instead.
+		DeadLetter *Writer
+		// The Logger to write log messages to. Defaults to log.Default.
+		Logger *log.Logger
+	}
+
+	// The ErrorPolicy type describes how a Reader behaves when a ReadFunc or BatchReadFunc returns an error.
+	ErrorPolicy string
+
 	// The ReadFunc type is a function that is invoked per-event when using Reader.Read.
-	ReadFunc func(ctx context.Context, message json.RawMessage) error
+	ReadFunc func(ctx context.Context, envelope Envelope) error
+
+	// The BatchReadFunc type is a function that is invoked per-batch of events when using Reader.ReadBatch.
+	BatchReadFunc func(ctx context.Context, envelopes []Envelope) error
+
+	receiveFunc func(ctx context.Context) ([]*pubsub.Message, error)
+	handleFunc  func(ctx context.Context, messages []*pubsub.Message) error
+)
+
+// Constants for error policies.
+const (
+	// ErrorPolicyStop causes the Reader to NACK the failed message(s) and stop reading, returning the error.
+	ErrorPolicyStop = ErrorPolicy("stop")
+	// ErrorPolicyContinue causes the Reader to NACK the failed message(s), log the error and continue reading.
+	ErrorPolicyContinue = ErrorPolicy("continue")
 )
 
-// NewReader returns a new instance of the Reader type, configured to use the event bus described in the URL
-// string.
-func NewReader(ctx context.Context, url string) (*Reader, error) {
-	subscription, err := pubsub.OpenSubscription(ctx, url)
+// NewReader returns a new instance of the Reader type, configured to use the event bus described in the config's
+// URL string.
+func NewReader(ctx context.Context, config ReaderConfig) (*Reader, error) {
+	if !config.ErrorPolicy.Valid() {
+		return nil, fmt.Errorf("invalid error policy %q", config.ErrorPolicy)
+	}
+
+	subscription, err := pubsub.OpenSubscription(ctx, config.URL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Reader{
+	reader := &Reader{
 		subscription: subscription,
-	}, nil
+		maxInFlight:  config.MaxInFlight,
+		maxAttempts:  config.MaxAttempts,
+		retryBackoff: config.RetryBackoff,
+		errorPolicy:  config.ErrorPolicy,
+		deadLetter:   config.DeadLetter,
+		logger:       config.Logger,
+	}
+
+	if reader.maxInFlight < 1 {
+		reader.maxInFlight = 1
+	}
+	if reader.maxAttempts < 1 {
+		reader.maxAttempts = 1
+	}
+	if reader.retryBackoff <= 0 {
+		reader.retryBackoff = time.Millisecond * 100
+	}
+	if reader.errorPolicy == "" {
+		reader.errorPolicy = ErrorPolicyStop
+	}
+	if reader.logger == nil {
+		reader.logger = log.Default()
+	}
+
+	return reader, nil
 }
 
-// Read events from the bus, invoking the ReadFunc for each. This method blocks until the context is cancelled or
-// ReadFunc returns a non-nil error. If the ReadFunc returns a non-nil error, a NACK will be performed on the
-// message where possible before returning. Otherwise, an ACK is performed and the next event is requested.
+// Valid returns true if the ErrorPolicy is one of the known policies. An empty policy is considered valid and
+// will use the default.
+func (ep ErrorPolicy) Valid() bool {
+	switch ep {
+	case "", ErrorPolicyStop, ErrorPolicyContinue:
+		return true
+	default:
+		return false
+	}
+}
+
+// Read events from the bus, invoking the ReadFunc with the Envelope of each. Up to the configured maximum number of
+// events are handled concurrently. This method blocks until the context is cancelled, or the ReadFunc returns a
+// non-nil error when using ErrorPolicyStop. If the ReadFunc returns a non-nil error, a NACK will be performed on the
+// message where possible. Otherwise, an ACK is performed and the next event is requested. When a dead-letter Writer
+// is configured, events that fail all attempts are published to it and acknowledged instead.
 func (r *Reader) Read(ctx context.Context, fn ReadFunc) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			message, err := r.subscription.Receive(ctx)
-			if err != nil {
+	receive := func(ctx context.Context) ([]*pubsub.Message, error) {
+		message, err := r.subscription.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*pubsub.Message{message}, nil
+	}
+
+	return r.read(ctx, receive, func(ctx context.Context, messages []*pubsub.Message) error {
+		return fn(ctx, envelopeFromMessage(messages[0]))
+	})
+}
+
+// ReadBatch reads events from the bus in batches of up to size events, invoking the BatchReadFunc for each batch. A
+// batch is handled once it is full, or once the interval has elapsed since its first event was received. Up to the
+// configured maximum number of batches are handled concurrently. This method blocks until the context is cancelled,
+// or the BatchReadFunc returns a non-nil error when using ErrorPolicyStop. If the BatchReadFunc returns a non-nil
+// error, a NACK will be performed on all messages in the batch where possible. Otherwise, all messages in the batch
+// are acknowledged and the next batch is requested. When a dead-letter Writer is configured, a failed batch is split
+// into individual events so that only those that continue to fail are dead-lettered.
+func (r *Reader) ReadBatch(ctx context.Context, size int, interval time.Duration, fn BatchReadFunc) error {
+	receive := func(ctx context.Context) ([]*pubsub.Message, error) {
+		return r.receiveBatch(ctx, size, interval)
+	}
+
+	return r.read(ctx, receive, func(ctx context.Context, messages []*pubsub.Message) error {
+		envelopes := make([]Envelope, len(messages))
+		for i, message := range messages {
+			envelopes[i] = envelopeFromMessage(message)
+		}
+
+		return fn(ctx, envelopes)
+	})
+}
+
+func (r *Reader) read(ctx context.Context, receive receiveFunc, handle handleFunc) error {
+	grp, ctx := errgroup.WithContext(ctx)
+
+	// The inFlight channel acts as a semaphore, limiting how many messages are being handled at once. We acquire
+	// a slot before receiving so that we never hold messages that we don't have the capacity to handle.
+	inFlight := make(chan struct{}, r.maxInFlight)
+
+	grp.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case inFlight <- struct{}{}:
+				messages, err := receive(ctx)
+				if err != nil {
+					return err
+				}
+
+				grp.Go(func() error {
+					defer func() { <-inFlight }()
+					return r.handle(ctx, messages, handle)
+				})
+			}
+		}
+	})
+
+	return grp.Wait()
+}
+
+func (r *Reader) handle(ctx context.Context, messages []*pubsub.Message, fn handleFunc) error {
+	err := r.attempt(ctx, messages, fn)
+	switch {
+	case err == nil:
+		for _, message := range messages {
+			message.Ack()
+		}
+
+		return nil
+	case r.deadLetter == nil || ctx.Err() != nil:
+		return r.fail(messages, err)
+	case len(messages) > 1:
+		// A single bad message would otherwise cause the entire batch to be dead-lettered, so we handle each
+		// message individually to find the culprit(s).
+		for i, message := range messages {
+			if err = r.handle(ctx, []*pubsub.Message{message}, fn); err != nil {
+				for _, remaining := range messages[i+1:] {
+					nack(remaining)
+				}
+
 				return err
 			}
+		}
 
-			if err = fn(ctx, message.Body); err != nil {
-				nack(message)
+		return nil
+	default:
+		if dlErr := r.publishDeadLetter(ctx, messages[0], err); dlErr != nil {
+			return r.fail(messages, fmt.Errorf("failed to dead-letter event: %w", dlErr))
+		}
+
+		messages[0].Ack()
+		return nil
+	}
+}
+
+// The maximum amount of time to wait between attempts at handling an event.
+const maxRetryBackoff = time.Second * 30
+
+func (r *Reader) attempt(ctx context.Context, messages []*pubsub.Message, fn handleFunc) error {
+	var err error
+	backoff := r.retryBackoff
+	for i := 0; i < r.maxAttempts; i++ {
+		if i > 0 {
+			// Failures are often caused by a dependency being briefly unavailable, so we give it time to recover
+			// rather than using up every attempt at once.
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
 				return err
+			case <-timer.C:
 			}
 
-			message.Ack()
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+
+		// There's no point retrying if we're shutting down, the messages will just be redelivered.
+		if err = fn(ctx, messages); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (r *Reader) fail(messages []*pubsub.Message, err error) error {
+	for _, message := range messages {
+		nack(message)
+	}
+
+	if r.errorPolicy == ErrorPolicyContinue {
+		r.logger.Printf("failed to handle %d event(s): %v", len(messages), err)
+		return nil
+	}
+
+	return err
+}
+
+// Metadata keys set on events that have been dead-lettered.
+const (
+	MetadataKeyError    = "error"
+	MetadataKeyAttempts = "attempts"
+	MetadataKeyFailedAt = "failed_at"
+)
+
+func (r *Reader) publishDeadLetter(ctx context.Context, message *pubsub.Message, err error) error {
+	metadata := make(map[string]string, len(message.Metadata)+3)
+	for k, v := range message.Metadata {
+		metadata[k] = v
+	}
+
+	metadata[MetadataKeyError] = err.Error()
+	metadata[MetadataKeyAttempts] = strconv.Itoa(r.maxAttempts)
+	metadata[MetadataKeyFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	if err = r.deadLetter.topic.Send(ctx, &pubsub.Message{Body: message.Body, Metadata: metadata}); err != nil {
+		return err
+	}
+
+	r.logger.Printf("dead-lettered event after %d attempt(s): %v", r.maxAttempts, metadata[MetadataKeyError])
+	return nil
+}
+
+func (r *Reader) receiveBatch(ctx context.Context, size int, interval time.Duration) ([]*pubsub.Message, error) {
+	// We block until at least one message is available, there's no point in handling empty batches.
+	message, err := r.subscription.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*pubsub.Message, 0, size)
+	messages = append(messages, message)
+
+	// The remaining messages are received until the batch is full or the interval elapses, whichever comes first. This
+	// prevents a slow trickle of events sitting in memory unacknowledged.
+	timeout, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+
+	for len(messages) < size {
+		message, err = r.subscription.Receive(timeout)
+		switch {
+		case err == nil:
+			messages = append(messages, message)
+		case ctx.Err() == nil && timeout.Err() != nil:
+			return messages, nil
+		default:
+			for _, message = range messages {
+				nack(message)
+			}
+
+			return nil, err
 		}
 	}
+
+	return messages, nil
 }
 
 // Close the connection to the event bus.
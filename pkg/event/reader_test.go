@@ -0,0 +1,320 @@
+package event_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestReader_Read(t *testing.T) {
+	t.Parallel()
+
+	messages := []json.RawMessage{
+		json.RawMessage(`{"n":1}`),
+		json.RawMessage(`{"n":2}`),
+		json.RawMessage(`{"n":3}`),
+	}
+
+	t.Run("It should handle events concurrently", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		reader, _ := setup(t, ctx, "read-concurrent", event.ReaderConfig{MaxInFlight: len(messages)}, messages)
+
+		// Each handler blocks until all messages are in-flight at once, which can only happen if they're
+		// being handled concurrently.
+		var wg sync.WaitGroup
+		wg.Add(len(messages))
+
+		err := reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+			wg.Done()
+			wg.Wait()
+			return io.EOF
+		})
+
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("It should back off between attempts", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		backoff := time.Millisecond * 50
+		reader, _ := setup(t, ctx, "read-backoff", event.ReaderConfig{MaxAttempts: 3, RetryBackoff: backoff}, messages[:1])
+
+		var attempts []time.Time
+		err := reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+			attempts = append(attempts, time.Now())
+			if len(attempts) < 3 {
+				return io.EOF
+			}
+
+			cancel()
+			return nil
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		require.Len(t, attempts, 3)
+		assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), backoff)
+		assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), backoff*2)
+	})
+
+	t.Run("It should provide the envelope of each event", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		reader, writer := setup(t, ctx, "read-envelope", event.ReaderConfig{}, nil)
+
+		expected := event.Envelope{
+			Version:    "1",
+			ID:         "test",
+			Producer:   "test",
+			IngestedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			DeviceID:   "test",
+			Body:       messages[0],
+		}
+
+		require.NoError(t, writer.Write(ctx, expected))
+
+		err := reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+			assert.EqualValues(t, expected, envelope)
+			return io.EOF
+		})
+
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("It should stop reading on error", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		reader, _ := setup(t, ctx, "read-stop", event.ReaderConfig{ErrorPolicy: event.ErrorPolicyStop}, messages)
+
+		var handled int
+		err := reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+			handled++
+			return io.EOF
+		})
+
+		assert.ErrorIs(t, err, io.EOF)
+		assert.EqualValues(t, 1, handled)
+	})
+
+	t.Run("It should continue reading on error", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		reader, _ := setup(t, ctx, "read-continue", event.ReaderConfig{
+			ErrorPolicy: event.ErrorPolicyContinue,
+			Logger:      log.New(io.Discard, "", log.Flags()),
+		}, messages)
+
+		var failed bool
+		var actual []json.RawMessage
+		err := reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+			// Fail the first message we see, it should be redelivered later.
+			if !failed {
+				failed = true
+				return io.EOF
+			}
+
+			actual = append(actual, envelope.Body)
+			if len(actual) == len(messages) {
+				cancel()
+			}
+
+			return nil
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ElementsMatch(t, messages, actual)
+	})
+}
+
+func TestReader_ReadBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	messages := []json.RawMessage{
+		json.RawMessage(`{"n":1}`),
+		json.RawMessage(`{"n":2}`),
+		json.RawMessage(`{"n":3}`),
+	}
+
+	reader, _ := setup(t, ctx, "read-batch", event.ReaderConfig{}, messages)
+
+	t.Run("It should read messages in batches", func(t *testing.T) {
+		var actual []json.RawMessage
+
+		err := reader.ReadBatch(ctx, 2, time.Millisecond*100, func(ctx context.Context, batch []event.Envelope) error {
+			assert.LessOrEqual(t, len(batch), 2)
+
+			for _, envelope := range batch {
+				actual = append(actual, envelope.Body)
+			}
+
+			if len(actual) == len(messages) {
+				return io.EOF
+			}
+
+			return nil
+		})
+
+		assert.ErrorIs(t, err, io.EOF)
+		assert.ElementsMatch(t, messages, actual)
+	})
+}
+
+func TestReader_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	messages := []json.RawMessage{
+		json.RawMessage(`{"n":1}`),
+		json.RawMessage(`{"n":2}`),
+		json.RawMessage(`{"n":3}`),
+	}
+
+	poison := messages[1]
+
+	tt := []struct {
+		Name  string
+		Batch bool
+	}{
+		{
+			Name: "It should dead-letter events that fail all attempts",
+		},
+		{
+			Name:  "It should dead-letter individual events from a failed batch",
+			Batch: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+
+			deadLetterURL := fmt.Sprintf("mem://dead-letter-%d", time.Now().UnixNano())
+			deadLetter, err := event.NewWriter(ctx, deadLetterURL)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				assert.NoError(t, deadLetter.Close())
+			})
+
+			subscription, err := pubsub.OpenSubscription(ctx, deadLetterURL)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				assert.NoError(t, subscription.Shutdown(context.Background()))
+			})
+
+			reader, _ := setup(t, ctx, "read-dead-letter", event.ReaderConfig{
+				MaxAttempts: 2,
+				DeadLetter:  deadLetter,
+				Logger:      log.New(io.Discard, "", log.Flags()),
+			}, messages)
+
+			handled := make(chan json.RawMessage, len(messages))
+			fn := func(ctx context.Context, batch []event.Envelope) error {
+				for _, envelope := range batch {
+					if bytes.Equal(envelope.Body, poison) {
+						return io.EOF
+					}
+				}
+
+				for _, envelope := range batch {
+					handled <- envelope.Body
+				}
+
+				return nil
+			}
+
+			errs := make(chan error, 1)
+			go func() {
+				if tc.Batch {
+					errs <- reader.ReadBatch(ctx, len(messages), time.Second, fn)
+					return
+				}
+
+				errs <- reader.Read(ctx, func(ctx context.Context, envelope event.Envelope) error {
+					return fn(ctx, []event.Envelope{envelope})
+				})
+			}()
+
+			actual, err := subscription.Receive(ctx)
+			require.NoError(t, err)
+			actual.Ack()
+
+			// All other messages should still be handled.
+			for i := 0; i < len(messages)-1; i++ {
+				select {
+				case <-ctx.Done():
+					require.NoError(t, ctx.Err())
+				case message := <-handled:
+					assert.NotEqualValues(t, poison, message)
+				}
+			}
+
+			cancel()
+			assert.ErrorIs(t, <-errs, context.Canceled)
+
+			assert.EqualValues(t, poison, actual.Body)
+			assert.EqualValues(t, io.EOF.Error(), actual.Metadata[event.MetadataKeyError])
+			assert.EqualValues(t, "2", actual.Metadata[event.MetadataKeyAttempts])
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("It should return an error for an invalid error policy", func(t *testing.T) {
+		_, err := event.NewReader(context.Background(), event.ReaderConfig{
+			URL:         "mem://invalid-policy",
+			ErrorPolicy: "invalid",
+		})
+
+		assert.Error(t, err)
+	})
+}
+
+func setup(t *testing.T, ctx context.Context, topic string, config event.ReaderConfig, messages []json.RawMessage) (*event.Reader, *event.Writer) {
+	t.Helper()
+
+	// In-memory topics are shared across the process, so we give each one a unique name to prevent tests from
+	// interfering with each other when run multiple times.
+	url := fmt.Sprintf("mem://%s-%d", topic, time.Now().UnixNano())
+
+	writer, err := event.NewWriter(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, writer.Close())
+	})
+
+	config.URL = url
+	reader, err := event.NewReader(ctx, config)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, reader.Close())
+	})
+
+	envelopes := make([]event.Envelope, len(messages))
+	for i, message := range messages {
+		envelopes[i] = event.Envelope{Body: message}
+	}
+
+	require.NoError(t, writer.WriteBatch(ctx, envelopes))
+	return reader, writer
+}
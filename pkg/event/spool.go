@@ -0,0 +1,338 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/closers"
+)
+
+type (
+	// The Spool type is used to durably store events on disk when they cannot be published to an event bus. Spooled
+	// events are replayed onto the event bus in the background once it becomes available again via Spool.Replay.
+	Spool struct {
+		writer     BatchWriter
+		path       string
+		replayPath string
+		logger     *log.Logger
+
+		// The mutex guards access to the spool file, which is appended to when publishing fails and moved or
+		// rewritten when replaying. It is not held while replayed events are published, so that events can be
+		// spooled while a replay is in progress.
+		mu sync.Mutex
+	}
+)
+
+// ErrSpooled is the error returned by Spool.Write and Spool.WriteBatch when events could not be published to the
+// event bus and have instead been written to disk. Spooled events will be published once the event bus is available.
+var ErrSpooled = errors.New("events spooled for later delivery")
+
+// The maximum number of spooled events to publish at once when replaying.
+const replayBatchSize = 100
+
+// NewSpool returns a new instance of the Spool type that will publish events via the BatchWriter implementation,
+// storing events within the given directory when publishing fails. The directory will be created if it does not
+// exist.
+func NewSpool(writer BatchWriter, dir string, logger *log.Logger) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	return &Spool{
+		writer:     writer,
+		path:       filepath.Join(dir, "spool.jsonl"),
+		replayPath: filepath.Join(dir, "replay.jsonl"),
+		logger:     logger,
+	}, nil
+}
+
+// Write an Envelope onto the event bus. If publishing fails, the envelope is written to disk and ErrSpooled is
+// returned.
+func (s *Spool) Write(ctx context.Context, envelope Envelope) error {
+	return s.WriteBatch(ctx, []Envelope{envelope})
+}
+
+// WriteBatch publishes multiple Envelopes onto the event bus. If publishing fails, all envelopes are written to disk
+// and ErrSpooled is returned. As publishing a batch is not atomic, some envelopes may be published more than once.
+func (s *Spool) WriteBatch(ctx context.Context, envelopes []Envelope) error {
+	err := s.writer.WriteBatch(ctx, envelopes)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		// If the context has been cancelled, the client has gone away and won't know whether their events were
+		// accepted. They'll need to retry anyway, so there's no point in spooling.
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if spoolErr := s.append(envelopes); spoolErr != nil {
+		return fmt.Errorf("failed to spool events: %v: %w", spoolErr, err)
+	}
+
+	s.logger.Printf("spooled %d event(s) after failing to publish: %v", len(envelopes), err)
+	return ErrSpooled
+}
+
+func (s *Spool) append(envelopes []Envelope) error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(file)
+
+	if err = s.truncateTorn(file); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, envelope := range envelopes {
+		if err = encoder.Encode(envelope); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	// We don't consider the events spooled until they've definitely made it to disk.
+	return file.Sync()
+}
+
+// Replay spooled events onto the event bus every interval. This method blocks until the context is cancelled. Events
+// are removed from the spool once they have been published. If publishing fails, the remaining events are retained
+// and retried on the next interval.
+func (s *Spool) Replay(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// We replay immediately so that anything spooled prior to a restart is published as soon as possible.
+		if err := s.replay(ctx); err != nil {
+			s.logger.Printf("failed to replay spooled events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			continue
+		}
+	}
+}
+
+func (s *Spool) replay(ctx context.Context) error {
+	claimed, err := s.claim()
+	if err != nil || !claimed {
+		return err
+	}
+
+	file, err := os.Open(s.replayPath)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(file)
+
+	reader := bufio.NewReader(file)
+	batch := make([]Envelope, 0, replayBatchSize)
+	var replayed int
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		switch {
+		case errors.Is(err, io.EOF):
+			if len(line) > 0 {
+				// A line without a trailing newline was torn by a crash while it was being spooled.
+				s.logger.Printf("discarding partially spooled event: %q", line)
+			}
+
+			if err = s.writer.WriteBatch(ctx, batch); err != nil {
+				return s.retain(batch, reader)
+			}
+
+			s.logger.Printf("replayed %d spooled event(s)", replayed+len(batch))
+			return os.Remove(s.replayPath)
+		case err != nil:
+			return err
+		}
+
+		// A line that can't be decoded will never succeed, so we log it and move on rather than blocking the
+		// replay of every event after it.
+		var envelope Envelope
+		if err = json.Unmarshal(line, &envelope); err != nil {
+			s.logger.Printf("discarding undecodable spooled event %q: %v", line, err)
+			continue
+		}
+
+		batch = append(batch, envelope)
+		if len(batch) < replayBatchSize {
+			continue
+		}
+
+		if err = s.writer.WriteBatch(ctx, batch); err != nil {
+			return s.retain(batch, reader)
+		}
+
+		replayed += len(batch)
+		batch = batch[:0]
+	}
+}
+
+// claim moves the spool file aside so that it can be replayed without holding the mutex, events spooled during the
+// replay are appended to a new spool file. If a previous replay was interrupted before it finished, its file is
+// replayed again instead. Returns false if there is nothing to replay.
+func (s *Spool) claim() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := os.Stat(s.replayPath)
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return false, err
+	}
+
+	err = os.Rename(s.path, s.replayPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// retain rewrites the spool file so that it contains the unpublished batch, followed by the unread remainder of the
+// file being replayed, followed by any events spooled during the replay. The new file is written alongside the
+// existing one and renamed over it so that spooled events are never lost if we crash halfway through.
+func (s *Spool) retain(batch []Envelope, remaining *bufio.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(file)
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, envelope := range batch {
+		if err = encoder.Encode(envelope); err != nil {
+			return err
+		}
+	}
+
+	if err = s.copyLines(writer, remaining); err != nil {
+		return err
+	}
+
+	if err = s.copySpooled(writer); err != nil {
+		return err
+	}
+
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	return os.Remove(s.replayPath)
+}
+
+// copySpooled copies the contents of the spool file into w, if it exists.
+func (s *Spool) copySpooled(w io.Writer) error {
+	file, err := os.Open(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	defer closers.Close(file)
+
+	return s.copyLines(w, bufio.NewReader(file))
+}
+
+// copyLines copies each complete line from r into w. A torn line at the end of r is discarded, so that the events
+// written after it are not appended to it.
+func (s *Spool) copyLines(w io.Writer, r *bufio.Reader) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		switch {
+		case errors.Is(err, io.EOF):
+			if len(line) > 0 {
+				s.logger.Printf("discarding partially spooled event: %q", line)
+			}
+
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if _, err = w.Write(line); err != nil {
+			return err
+		}
+	}
+}
+
+// truncateTorn truncates the file after its last newline, discarding any event that was partially written when we
+// crashed while spooling. Otherwise, the next event appended to the file would be joined onto the torn one.
+func (s *Spool) truncateTorn(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	buf := make([]byte, 4096)
+	end := size
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := buf[:end-start]
+		if _, err = file.ReadAt(chunk, start); err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			end = start + int64(i) + 1
+			break
+		}
+
+		end = start
+	}
+
+	if end == size {
+		return nil
+	}
+
+	s.logger.Printf("discarding %d byte(s) of a partially spooled event", size-end)
+	return file.Truncate(end)
+}
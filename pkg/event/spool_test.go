@@ -0,0 +1,230 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool_WriteBatch(t *testing.T) {
+	t.Parallel()
+
+	envelopes := []event.Envelope{
+		{ID: "1", Body: json.RawMessage(`{"n":1}`)},
+		{ID: "2", Body: json.RawMessage(`{"n":2}`)},
+	}
+
+	tt := []struct {
+		Name            string
+		Error           error
+		ExpectedError   error
+		ExpectedSpooled int
+	}{
+		{
+			Name: "It should publish events when the event bus is available",
+		},
+		{
+			Name:            "It should spool events when the event bus is unavailable",
+			Error:           io.EOF,
+			ExpectedError:   event.ErrSpooled,
+			ExpectedSpooled: len(envelopes),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			writer := &MockBatchWriter{err: tc.Error}
+
+			spool, err := event.NewSpool(writer, dir, log.New(io.Discard, "", log.Flags()))
+			require.NoError(t, err)
+
+			err = spool.WriteBatch(ctx, envelopes)
+			if tc.ExpectedError != nil {
+				assert.ErrorIs(t, err, tc.ExpectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Len(t, spooled(t, dir), tc.ExpectedSpooled)
+		})
+	}
+}
+
+func TestSpool_Replay(t *testing.T) {
+	t.Parallel()
+
+	t.Run("It should publish spooled events once the event bus is available", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		dir := t.TempDir()
+		writer := &MockBatchWriter{err: io.EOF}
+
+		spool, err := event.NewSpool(writer, dir, log.New(io.Discard, "", log.Flags()))
+		require.NoError(t, err)
+
+		// Spool more events than fit in a single replayed batch.
+		expected := make([]event.Envelope, 250)
+		for i := range expected {
+			expected[i] = event.Envelope{ID: fmt.Sprint(i), Body: json.RawMessage(fmt.Sprintf(`{"n":%d}`, i))}
+			require.ErrorIs(t, spool.Write(ctx, expected[i]), event.ErrSpooled)
+		}
+
+		// Replaying while the event bus is still unavailable should leave all events within the spool.
+		replayCtx, replayCancel := context.WithCancel(ctx)
+		replayCancel()
+		assert.ErrorIs(t, spool.Replay(replayCtx, time.Minute), context.Canceled)
+		assert.EqualValues(t, expected, spooled(t, dir))
+
+		writer.batches = nil
+		writer.err = nil
+
+		replayCtx, replayCancel = context.WithCancel(ctx)
+		replayCancel()
+		assert.ErrorIs(t, spool.Replay(replayCtx, time.Minute), context.Canceled)
+
+		var actual []event.Envelope
+		for _, batch := range writer.batches {
+			actual = append(actual, batch...)
+		}
+
+		assert.EqualValues(t, expected, actual)
+		assert.Empty(t, spooled(t, dir))
+	})
+}
+
+func TestSpool_ReplayConcurrentWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	dir := t.TempDir()
+	writer := &MockBlockingBatchWriter{
+		id:      "old",
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	spool, err := event.NewSpool(writer, dir, log.New(io.Discard, "", log.Flags()))
+	require.NoError(t, err)
+
+	old := event.Envelope{ID: "old", Body: json.RawMessage(`{"n":1}`)}
+	file, err := os.Create(filepath.Join(dir, "spool.jsonl"))
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(file).Encode(old))
+	require.NoError(t, file.Close())
+
+	replayCtx, replayCancel := context.WithCancel(ctx)
+	defer replayCancel()
+
+	replayErr := make(chan error, 1)
+	go func() {
+		replayErr <- spool.Replay(replayCtx, time.Minute)
+	}()
+
+	// Events should be spooled while a replay is blocked publishing.
+	<-writer.started
+	latest := event.Envelope{ID: "new", Body: json.RawMessage(`{"n":2}`)}
+	assert.ErrorIs(t, spool.Write(ctx, latest), event.ErrSpooled)
+
+	close(writer.release)
+	replayCancel()
+	assert.ErrorIs(t, <-replayErr, context.Canceled)
+
+	assert.EqualValues(t, [][]event.Envelope{{old}}, writer.batches)
+	assert.EqualValues(t, []event.Envelope{latest}, spooled(t, dir))
+}
+
+func TestSpool_ReplayCorrupt(t *testing.T) {
+	t.Parallel()
+
+	first := event.Envelope{ID: "first", Body: json.RawMessage(`{"n":1}`)}
+	second := event.Envelope{ID: "second", Body: json.RawMessage(`{"n":2}`)}
+
+	t.Run("It should skip undecodable and torn events when replaying", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		dir := t.TempDir()
+		writer := &MockBatchWriter{}
+
+		spool, err := event.NewSpool(writer, dir, log.New(io.Discard, "", log.Flags()))
+		require.NoError(t, err)
+
+		file, err := os.Create(filepath.Join(dir, "spool.jsonl"))
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(file).Encode(first))
+		_, err = file.WriteString("not json\n")
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(file).Encode(second))
+		_, err = file.WriteString(`{"id":"torn","bo`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		replayCtx, replayCancel := context.WithCancel(ctx)
+		replayCancel()
+		assert.ErrorIs(t, spool.Replay(replayCtx, time.Minute), context.Canceled)
+
+		assert.EqualValues(t, [][]event.Envelope{{first, second}}, writer.batches)
+		assert.NoFileExists(t, filepath.Join(dir, "replay.jsonl"))
+		assert.Empty(t, spooled(t, dir))
+	})
+
+	t.Run("It should discard a torn event before spooling more", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		dir := t.TempDir()
+		writer := &MockBatchWriter{err: io.EOF}
+
+		spool, err := event.NewSpool(writer, dir, log.New(io.Discard, "", log.Flags()))
+		require.NoError(t, err)
+
+		file, err := os.Create(filepath.Join(dir, "spool.jsonl"))
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(file).Encode(first))
+		_, err = file.WriteString(`{"id":"torn","bo`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		assert.ErrorIs(t, spool.Write(ctx, second), event.ErrSpooled)
+		assert.EqualValues(t, []event.Envelope{first, second}, spooled(t, dir))
+	})
+}
+
+func spooled(t *testing.T, dir string) []event.Envelope {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join(dir, "spool.jsonl"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer file.Close()
+
+	var envelopes []event.Envelope
+	decoder := json.NewDecoder(file)
+	for {
+		var envelope event.Envelope
+		err = decoder.Decode(&envelope)
+		if err == io.EOF {
+			return envelopes
+		}
+
+		require.NoError(t, err)
+		envelopes = append(envelopes, envelope)
+	}
+}
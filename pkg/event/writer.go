@@ -3,7 +3,6 @@ package event
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
 	"gocloud.dev/pubsub"
@@ -14,10 +13,11 @@ import (
 	_ "gocloud.dev/pubsub/mempubsub"
 	_ "gocloud.dev/pubsub/natspubsub"
 	_ "gocloud.dev/pubsub/rabbitpubsub"
+	"golang.org/x/sync/errgroup"
 )
 
 type (
-	// The Writer type is used to publish JSON-encoded messages onto an event bus.
+	// The Writer type is used to publish Envelopes onto an event bus.
 	Writer struct {
 		topic *pubsub.Topic
 	}
@@ -34,11 +34,25 @@ func NewWriter(ctx context.Context, url string) (*Writer, error) {
 	return &Writer{topic: topic}, nil
 }
 
-// Write a JSON-encoded message onto the bus.
-func (w *Writer) Write(ctx context.Context, message json.RawMessage) error {
-	return w.topic.Send(ctx, &pubsub.Message{
-		Body: message,
-	})
+// Write an Envelope onto the bus. The envelope's body is published as-is, with the remaining fields stored as
+// message metadata.
+func (w *Writer) Write(ctx context.Context, envelope Envelope) error {
+	return w.topic.Send(ctx, envelope.toMessage())
+}
+
+// WriteBatch publishes multiple Envelopes onto the bus, returning once every message has been acknowledged. Messages
+// are sent concurrently, which allows the underlying topic to group them into batches for event buses that support
+// batched publishing.
+func (w *Writer) WriteBatch(ctx context.Context, envelopes []Envelope) error {
+	grp, ctx := errgroup.WithContext(ctx)
+	for _, envelope := range envelopes {
+		envelope := envelope
+		grp.Go(func() error {
+			return w.Write(ctx, envelope)
+		})
+	}
+
+	return grp.Wait()
 }
 
 // Close the connection to the event bus.
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	// The SigningKeyStore interface describes types that can look up the SigningKey used to sign a request.
+	SigningKeyStore interface {
+		SigningKey(ctx context.Context, id string) (SigningKey, error)
+	}
+
+	// The SigningKey type describes a shared secret used to sign requests, and the Credentials that requests
+	// signed using it belong to.
+	SigningKey struct {
+		Secret      []byte
+		Credentials Credentials
+	}
+
+	// The StaticSigningKeys type is a SigningKeyStore implementation that maps key identifiers to their SigningKey.
+	StaticSigningKeys map[string]SigningKey
+
+	// The HMACConfig type contains fields used to configure the HMAC middleware.
+	HMACConfig struct {
+		// The SigningKeyStore implementation used to look up the secret each request was signed with.
+		Keys SigningKeyStore
+		// How far the signature timestamp may differ from the current time before a request is rejected. Signatures
+		// are also remembered for this long so that requests can't be replayed within the window. Signatures are
+		// remembered in memory, so a request may still be replayed against another replica. Defaults to 5 minutes.
+		Window time.Duration
+		// The maximum size of a request body in bytes. The entire body must be read to verify its signature, so it is
+		// held in memory. Defaults to 32MiB.
+		MaxBodySize int64
+	}
+)
+
+// Headers used to sign requests.
+const (
+	HeaderSignatureKeyID     = "X-Signature-Key-ID"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignature          = "X-Signature"
+)
+
+var (
+	// ErrInvalidSignature is the error returned when a request's signature does not match its contents.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrSignatureExpired is the error returned when a request's signature timestamp is outside the replay window.
+	ErrSignatureExpired = errors.New("signature timestamp outside of the allowed window")
+	// ErrSignatureReplayed is the error returned when a request's signature has already been used.
+	ErrSignatureReplayed = errors.New("signature has already been used")
+
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// The request headers covered by a signature, in the order they are signed.
+var signedHeaders = []string{"Content-Type", "Content-Encoding", "Upload-Offset"}
+
+// SigningKey returns the SigningKey for an identifier. Returns ErrInvalidKey if the key does not exist.
+func (sk StaticSigningKeys) SigningKey(_ context.Context, id string) (SigningKey, error) {
+	key, ok := sk[id]
+	if !ok {
+		return SigningKey{}, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of a request, as expected by the HMAC middleware. The signature
+// covers the timestamp, method, path, raw query, the Content-Type, Content-Encoding & Upload-Offset headers and the
+// body, so that none of them can be modified without invalidating it. The body is given separately, the request's
+// body is not read.
+func Sign(secret []byte, timestamp time.Time, r *http.Request, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n", timestamp.Unix(), r.Method, r.URL.Path, r.URL.RawQuery)
+	for _, header := range signedHeaders {
+		fmt.Fprintf(mac, "%s\n", r.Header.Get(header))
+	}
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMAC returns a mux.MiddlewareFunc implementation that verifies requests have been signed using a known
+// SigningKey. Requests must contain the identifier of the key in the X-Signature-Key-ID header, the unix time they
+// were signed at in the X-Signature-Timestamp header, and the signature produced by Sign in the X-Signature header.
+//
+// Requests signed outside the configured window, or whose signature has already been seen within it, are rejected so
+// that captured requests cannot be replayed. Seen signatures are held in memory, so replays are only detected by the
+// replica that handled the original request. The vehicle & device the key belongs to are stored within the request
+// context and can be obtained using Vehicle and DeviceID. It will return a 401 response for any request whose
+// signature cannot be verified.
+func HMAC(config HMACConfig) mux.MiddlewareFunc {
+	if config.Window <= 0 {
+		config.Window = time.Minute * 5
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 32 << 20
+	}
+
+	seen := &signatureCache{signatures: make(map[string]time.Time), interval: config.Window}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			id := r.Header.Get(HeaderSignatureKeyID)
+			signature := r.Header.Get(HeaderSignature)
+			if id == "" || signature == "" {
+				http.Error(w, "no signature provided", http.StatusUnauthorized)
+				return
+			}
+
+			unix, err := strconv.ParseInt(r.Header.Get(HeaderSignatureTimestamp), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid signature timestamp", http.StatusUnauthorized)
+				return
+			}
+
+			now := time.Now()
+			timestamp := time.Unix(unix, 0)
+			if timestamp.Before(now.Add(-config.Window)) || timestamp.After(now.Add(config.Window)) {
+				http.Error(w, ErrSignatureExpired.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			key, err := config.Keys.SigningKey(ctx, id)
+			switch {
+			case errors.Is(err, ErrInvalidKey):
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			body, err := readBody(r.Body, config.MaxBodySize)
+			switch {
+			case errors.Is(err, errBodyTooLarge):
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			expected := Sign(key.Secret, timestamp, r, body)
+			if !hmac.Equal([]byte(expected), []byte(signature)) {
+				http.Error(w, ErrInvalidSignature.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			// Signatures only need remembering until their timestamp falls outside the window, at which point they'd
+			// be rejected anyway.
+			if !seen.add(signature, timestamp.Add(config.Window), now) {
+				http.Error(w, ErrSignatureReplayed.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			ctx = WithVehicle(ctx, key.Credentials.Vehicle)
+			if key.Credentials.DeviceID != "" {
+				ctx = WithDeviceID(ctx, key.Credentials.DeviceID)
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// readBody reads the entire body. Returns errBodyTooLarge if the body is larger than the limit.
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	switch {
+	case err != nil:
+		return nil, err
+	case int64(len(data)) > limit:
+		return nil, errBodyTooLarge
+	default:
+		return data, nil
+	}
+}
+
+// Signed returns a mux.MiddlewareFunc implementation that applies the signed middleware to requests containing an
+// X-Signature header, and the fallback middleware to all other requests. This allows clients to migrate to signed
+// requests gradually.
+func Signed(signed, fallback mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		signedHandler := signed(handler)
+		fallbackHandler := fallback(handler)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(HeaderSignature) != "" {
+				signedHandler.ServeHTTP(w, r)
+				return
+			}
+
+			fallbackHandler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// The signatureCache type stores the signatures of recently verified requests, so that they cannot be replayed.
+type signatureCache struct {
+	mu         sync.Mutex
+	signatures map[string]time.Time
+	interval   time.Duration
+	sweepAt    time.Time
+}
+
+// add the signature to the cache until it expires. Returns false if the signature was already present and has not
+// expired. Expired signatures are removed at most once per sweep interval, so that each request does not have to
+// check every signature in the cache.
+func (sc *signatureCache) add(signature string, expires, now time.Time) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if now.After(sc.sweepAt) {
+		for s, e := range sc.signatures {
+			if now.After(e) {
+				delete(sc.signatures, s)
+			}
+		}
+
+		sc.sweepAt = now.Add(sc.interval)
+	}
+
+	if e, ok := sc.signatures[signature]; ok && !now.After(e) {
+		return false
+	}
+
+	sc.signatures[signature] = expires
+	return true
+}
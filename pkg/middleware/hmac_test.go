@@ -0,0 +1,281 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/cloud-lada/backend/pkg/middleware"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMAC(t *testing.T) {
+	t.Parallel()
+
+	keys := middleware.StaticSigningKeys{
+		"logger": {
+			Secret:      []byte("secret"),
+			Credentials: middleware.Credentials{Vehicle: "lada", DeviceID: "logger-1"},
+		},
+	}
+
+	body := []byte(`{"sensor":"speed","value":65,"timestamp":"2022-01-01T00:00:00Z"}`)
+
+	tt := []struct {
+		Name            string
+		KeyID           string
+		Secret          []byte
+		Timestamp       time.Time
+		SignedBody      []byte
+		SignedPath      string
+		Tamper          func(r *http.Request)
+		Replay          bool
+		ExpectedCode    int
+		ExpectedVehicle string
+	}{
+		{
+			Name:            "It should allow requests with a valid signature",
+			KeyID:           "logger",
+			Secret:          []byte("secret"),
+			Timestamp:       time.Now(),
+			SignedBody:      body,
+			SignedPath:      "/ingest",
+			ExpectedCode:    http.StatusOK,
+			ExpectedVehicle: "lada",
+		},
+		{
+			Name:         "It should reject requests whose body has been modified",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   []byte(`{"sensor":"speed","value":10,"timestamp":"2022-01-01T00:00:00Z"}`),
+			SignedPath:   "/ingest",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests signed for another path",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/other",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests whose query has been modified",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			Tamper:       func(r *http.Request) { r.URL.RawQuery = "mode=sync" },
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests whose content type has been modified",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			Tamper:       func(r *http.Request) { r.Header.Set("Content-Type", "text/csv") },
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests whose upload offset has been modified",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			Tamper:       func(r *http.Request) { r.Header.Set("Upload-Offset", "100") },
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests signed with the wrong secret",
+			KeyID:        "logger",
+			Secret:       []byte("wrong"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests with an unknown key",
+			KeyID:        "unknown",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests signed outside of the window",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now().Add(-time.Hour),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject requests signed in the future",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now().Add(time.Hour),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			Name:         "It should reject replayed requests",
+			KeyID:        "logger",
+			Secret:       []byte("secret"),
+			Timestamp:    time.Now(),
+			SignedBody:   body,
+			SignedPath:   "/ingest",
+			Replay:       true,
+			ExpectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var vehicle string
+			var received []byte
+
+			router := mux.NewRouter()
+			router.Use(middleware.HMAC(middleware.HMACConfig{Keys: keys}))
+			router.HandleFunc("/ingest", func(w http.ResponseWriter, r *http.Request) {
+				vehicle, _ = middleware.Vehicle(r.Context())
+				received, _ = io.ReadAll(r.Body)
+			})
+
+			request := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/ingest?mode=async", bytes.NewReader(body))
+				r.Header.Set("Content-Type", "application/stream+json")
+				r.Header.Set("Upload-Offset", "0")
+				r.Header.Set(middleware.HeaderSignatureKeyID, tc.KeyID)
+				r.Header.Set(middleware.HeaderSignatureTimestamp, strconv.FormatInt(tc.Timestamp.Unix(), 10))
+
+				signed := r.Clone(r.Context())
+				signed.URL.Path = tc.SignedPath
+				r.Header.Set(middleware.HeaderSignature, middleware.Sign(tc.Secret, tc.Timestamp, signed, tc.SignedBody))
+
+				if tc.Tamper != nil {
+					tc.Tamper(r)
+				}
+
+				router.ServeHTTP(w, r)
+				return w
+			}
+
+			w := request()
+			if tc.Replay {
+				require.EqualValues(t, http.StatusOK, w.Code)
+				vehicle = ""
+				w = request()
+			}
+
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, tc.ExpectedVehicle, vehicle)
+
+			if tc.ExpectedCode == http.StatusOK {
+				assert.EqualValues(t, body, received)
+			}
+		})
+	}
+}
+
+func TestHMAC_Body(t *testing.T) {
+	t.Parallel()
+
+	keys := middleware.StaticSigningKeys{"logger": {Secret: []byte("secret")}}
+
+	tt := []struct {
+		Name         string
+		Body         io.Reader
+		ExpectedCode int
+	}{
+		{
+			Name:         "It should reject bodies larger than the maximum size",
+			Body:         bytes.NewReader(make([]byte, 11)),
+			ExpectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name:         "It should return bad request when the body cannot be read",
+			Body:         iotest.ErrReader(io.ErrUnexpectedEOF),
+			ExpectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.Use(middleware.HMAC(middleware.HMACConfig{Keys: keys, MaxBodySize: 10}))
+			router.HandleFunc("/ingest", func(w http.ResponseWriter, r *http.Request) {})
+
+			now := time.Now()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/ingest", tc.Body)
+			r.Header.Set(middleware.HeaderSignatureKeyID, "logger")
+			r.Header.Set(middleware.HeaderSignatureTimestamp, strconv.FormatInt(now.Unix(), 10))
+			r.Header.Set(middleware.HeaderSignature, middleware.Sign([]byte("secret"), now, r, nil))
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+		})
+	}
+}
+
+func TestSigned(t *testing.T) {
+	t.Parallel()
+
+	keys := middleware.StaticSigningKeys{
+		"logger": {Secret: []byte("secret"), Credentials: middleware.Credentials{Vehicle: "support"}},
+	}
+
+	router := mux.NewRouter()
+	router.Use(middleware.Signed(
+		middleware.HMAC(middleware.HMACConfig{Keys: keys}),
+		middleware.APIKeys(map[string]string{"example": "lada"}),
+	))
+
+	var vehicle string
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		vehicle, _ = middleware.Vehicle(r.Context())
+	})
+
+	t.Run("It should verify signed requests", func(t *testing.T) {
+		now := time.Now()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(middleware.HeaderSignatureKeyID, "logger")
+		r.Header.Set(middleware.HeaderSignatureTimestamp, strconv.FormatInt(now.Unix(), 10))
+		r.Header.Set(middleware.HeaderSignature, middleware.Sign([]byte("secret"), now, r, nil))
+
+		router.ServeHTTP(w, r)
+		assert.EqualValues(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, "support", vehicle)
+	})
+
+	t.Run("It should fall back for unsigned requests", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("example", "")
+
+		router.ServeHTTP(w, r)
+		assert.EqualValues(t, http.StatusOK, w.Code)
+		assert.EqualValues(t, "lada", vehicle)
+	})
+}
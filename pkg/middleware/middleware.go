@@ -2,15 +2,56 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-// APIKey returns a mux.MiddlewareFunc implementation that will check the basic authentication credentials for a
-// username matching the provided key. It will return a 401 response if there are no basic authentication credentials
-// or if the username does not match the api key.
-func APIKey(key string) mux.MiddlewareFunc {
+type (
+	// The KeyStore interface describes types that can look up the Credentials associated with an API key.
+	KeyStore interface {
+		Lookup(ctx context.Context, key string) (Credentials, error)
+	}
+
+	// The Credentials type describes the vehicle, and optionally the device, that an API key belongs to.
+	Credentials struct {
+		Vehicle  string
+		DeviceID string
+	}
+
+	// The StaticKeys type is a KeyStore implementation that maps API keys to the identifier of the vehicle they
+	// belong to.
+	StaticKeys map[string]string
+)
+
+// ErrInvalidKey is the error returned by KeyStore implementations when an API key does not exist or has been revoked.
+var ErrInvalidKey = errors.New("invalid api key")
+
+// Lookup returns the Credentials for an API key. Returns ErrInvalidKey if the key does not exist.
+func (sk StaticKeys) Lookup(_ context.Context, key string) (Credentials, error) {
+	vehicle, ok := sk[key]
+	if !ok {
+		return Credentials{}, ErrInvalidKey
+	}
+
+	return Credentials{Vehicle: vehicle}, nil
+}
+
+// APIKeys returns a mux.MiddlewareFunc implementation that will check the basic authentication credentials for a
+// username matching one of the keys within the provided map. Each key maps to the identifier of the vehicle it
+// belongs to, which is stored within the request context and can be obtained using Vehicle. It will return a 401
+// response if there are no basic authentication credentials or if the username does not match any api key.
+func APIKeys(keys map[string]string) mux.MiddlewareFunc {
+	return KeyStores(StaticKeys(keys))
+}
+
+// KeyStores returns a mux.MiddlewareFunc implementation that will look up the basic authentication username within
+// each KeyStore in turn, until one of them recognises it. The vehicle & device the key belongs to are stored within the
+// request context and can be obtained using Vehicle and DeviceID. It will return a 401 response if there are no basic
+// authentication credentials or if no KeyStore recognises the key, and a 500 response if a KeyStore fails.
+func KeyStores(stores ...KeyStore) mux.MiddlewareFunc {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			username, _, ok := r.BasicAuth()
@@ -18,12 +59,63 @@ func APIKey(key string) mux.MiddlewareFunc {
 			case !ok:
 				http.Error(w, "no credentials provided", http.StatusUnauthorized)
 				return
-			case username != key || username == "":
-				http.Error(w, "invalid api key", http.StatusUnauthorized)
+			case username == "":
+				http.Error(w, ErrInvalidKey.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			ctx := r.Context()
+			for _, store := range stores {
+				credentials, err := store.Lookup(ctx, username)
+				switch {
+				case errors.Is(err, ErrInvalidKey):
+					continue
+				case err != nil:
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				ctx = WithVehicle(ctx, credentials.Vehicle)
+				if credentials.DeviceID != "" {
+					ctx = WithDeviceID(ctx, credentials.DeviceID)
+				}
+
+				handler.ServeHTTP(w, r.WithContext(ctx))
 				return
-			default:
-				handler.ServeHTTP(w, r)
 			}
+
+			http.Error(w, ErrInvalidKey.Error(), http.StatusUnauthorized)
 		})
 	}
 }
+
+type ctxKey int
+
+const (
+	vehicleKey ctxKey = iota
+	deviceIDKey
+)
+
+// WithVehicle returns a copy of the context that contains the identifier of a vehicle.
+func WithVehicle(ctx context.Context, vehicle string) context.Context {
+	return context.WithValue(ctx, vehicleKey, vehicle)
+}
+
+// Vehicle returns the identifier of the vehicle stored within the context, if one exists. The vehicle is set by
+// authentication middleware such as APIKeys based on the credentials provided in the request.
+func Vehicle(ctx context.Context) (string, bool) {
+	vehicle, ok := ctx.Value(vehicleKey).(string)
+	return vehicle, ok && vehicle != ""
+}
+
+// WithDeviceID returns a copy of the context that contains the identifier of a device.
+func WithDeviceID(ctx context.Context, deviceID string) context.Context {
+	return context.WithValue(ctx, deviceIDKey, deviceID)
+}
+
+// DeviceID returns the identifier of the device stored within the context, if one exists. The device is set by
+// authentication middleware such as KeyStores when the credentials provided in the request belong to a specific device.
+func DeviceID(ctx context.Context) (string, bool) {
+	deviceID, ok := ctx.Value(deviceIDKey).(string)
+	return deviceID, ok && deviceID != ""
+}
@@ -1,6 +1,7 @@
 package middleware_test
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,34 +11,53 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestAPIKey(t *testing.T) {
+func TestAPIKeys(t *testing.T) {
 	t.Parallel()
 
+	keys := map[string]string{
+		"first":  "lada",
+		"second": "support",
+	}
+
 	tt := []struct {
 		Name              string
-		APIKey            string
 		BasicAuthUsername string
 		ExpectedCode      int
+		ExpectedVehicle   string
 	}{
 		{
-			Name:              "It should allow requests that have the correct API key",
-			APIKey:            "example",
-			BasicAuthUsername: "example",
+			Name:              "It should allow requests that have a known API key",
+			BasicAuthUsername: "first",
+			ExpectedCode:      http.StatusOK,
+			ExpectedVehicle:   "lada",
+		},
+		{
+			Name:              "It should store the vehicle associated with the API key",
+			BasicAuthUsername: "second",
 			ExpectedCode:      http.StatusOK,
+			ExpectedVehicle:   "support",
 		},
 		{
-			Name:              "It should reject requests that have an incorrect API key",
-			APIKey:            "example",
+			Name:              "It should reject requests that have an unknown API key",
 			BasicAuthUsername: "wrong",
 			ExpectedCode:      http.StatusUnauthorized,
 		},
+		{
+			Name:              "It should reject requests that have an empty API key",
+			BasicAuthUsername: "",
+			ExpectedCode:      http.StatusUnauthorized,
+		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
+			var actual string
+
 			router := mux.NewRouter()
-			router.Use(middleware.APIKey(tc.APIKey))
-			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+			router.Use(middleware.APIKeys(keys))
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				actual, _ = middleware.Vehicle(r.Context())
+			})
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -45,7 +65,76 @@ func TestAPIKey(t *testing.T) {
 
 			router.ServeHTTP(w, r)
 			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, tc.ExpectedVehicle, actual)
 		})
 	}
+}
+
+func TestKeyStores(t *testing.T) {
+	t.Parallel()
 
+	static := middleware.StaticKeys{"static": "lada"}
+
+	tt := []struct {
+		Name              string
+		Store             *MockKeyStore
+		BasicAuthUsername string
+		ExpectedCode      int
+		ExpectedVehicle   string
+		ExpectedDeviceID  string
+	}{
+		{
+			Name: "It should store the vehicle & device associated with the API key",
+			Store: &MockKeyStore{
+				keys: map[string]middleware.Credentials{
+					"stored": {Vehicle: "support", DeviceID: "logger"},
+				},
+			},
+			BasicAuthUsername: "stored",
+			ExpectedCode:      http.StatusOK,
+			ExpectedVehicle:   "support",
+			ExpectedDeviceID:  "logger",
+		},
+		{
+			Name:              "It should check each key store in turn",
+			Store:             &MockKeyStore{},
+			BasicAuthUsername: "static",
+			ExpectedCode:      http.StatusOK,
+			ExpectedVehicle:   "lada",
+		},
+		{
+			Name:              "It should reject requests with a key unknown to every key store",
+			Store:             &MockKeyStore{},
+			BasicAuthUsername: "wrong",
+			ExpectedCode:      http.StatusUnauthorized,
+		},
+		{
+			Name:              "It should return internal server error for key store errors",
+			Store:             &MockKeyStore{err: io.EOF},
+			BasicAuthUsername: "stored",
+			ExpectedCode:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var vehicle, deviceID string
+
+			router := mux.NewRouter()
+			router.Use(middleware.KeyStores(tc.Store, static))
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				vehicle, _ = middleware.Vehicle(r.Context())
+				deviceID, _ = middleware.DeviceID(r.Context())
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth(tc.BasicAuthUsername, "")
+
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, tc.ExpectedCode, w.Code)
+			assert.EqualValues(t, tc.ExpectedVehicle, vehicle)
+			assert.EqualValues(t, tc.ExpectedDeviceID, deviceID)
+		})
+	}
 }
@@ -0,0 +1,27 @@
+package middleware_test
+
+import (
+	"context"
+
+	"github.com/cloud-lada/backend/pkg/middleware"
+)
+
+type (
+	MockKeyStore struct {
+		keys map[string]middleware.Credentials
+		err  error
+	}
+)
+
+func (m *MockKeyStore) Lookup(ctx context.Context, key string) (middleware.Credentials, error) {
+	if m.err != nil {
+		return middleware.Credentials{}, m.err
+	}
+
+	credentials, ok := m.keys[key]
+	if !ok {
+		return middleware.Credentials{}, middleware.ErrInvalidKey
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS upload_session (
+    id               UUID        PRIMARY KEY,
+    content_type     TEXT        NOT NULL,
+    device_id        TEXT        NOT NULL DEFAULT '',
+
+    -- The number of bytes of the upload that have been processed, clients
+    -- resume their uploads from this offset.
+    committed_offset BIGINT      NOT NULL DEFAULT 0,
+    row_count        INTEGER     NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL,
+    finalized_at     TIMESTAMPTZ
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS ingest_job (
+    id               UUID        PRIMARY KEY,
+    status           TEXT        NOT NULL,
+    content_type     TEXT        NOT NULL,
+    content_encoding TEXT        NOT NULL DEFAULT '',
+    device_id        TEXT        NOT NULL DEFAULT '',
+    row_count        INTEGER     NOT NULL DEFAULT 0,
+    valid_count      INTEGER     NOT NULL DEFAULT 0,
+    invalid_count    INTEGER     NOT NULL DEFAULT 0,
+    errors           JSONB       NOT NULL DEFAULT '[]',
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    finished_at      TIMESTAMPTZ
+);
+
+-- Workers look for unfinished jobs in the order they were created.
+CREATE INDEX IF NOT EXISTS idx_ingest_job_status ON ingest_job(status, created_at);
@@ -0,0 +1,10 @@
+ALTER TABLE ingest_job DROP COLUMN IF EXISTS vehicle;
+ALTER TABLE upload_session DROP COLUMN IF EXISTS vehicle;
+
+-- Only readings for the original vehicle can be kept without violating the
+-- previous primary key.
+DELETE FROM reading WHERE vehicle <> 'lada';
+DROP INDEX IF EXISTS idx_vehicle;
+ALTER TABLE reading DROP CONSTRAINT IF EXISTS reading_pkey;
+ALTER TABLE reading ADD PRIMARY KEY(sensor, timestamp);
+ALTER TABLE reading DROP COLUMN IF EXISTS vehicle;
@@ -0,0 +1,17 @@
+-- Readings recorded before multiple vehicles were supported all belong to
+-- the original vehicle.
+ALTER TABLE reading ADD COLUMN IF NOT EXISTS vehicle TEXT NOT NULL DEFAULT 'lada';
+ALTER TABLE reading ALTER COLUMN vehicle DROP DEFAULT;
+
+-- Two vehicles may record the same sensor at the same time, so the vehicle
+-- becomes part of the composite primary key.
+ALTER TABLE reading DROP CONSTRAINT IF EXISTS reading_pkey;
+ALTER TABLE reading ADD PRIMARY KEY(vehicle, sensor, timestamp);
+
+CREATE INDEX IF NOT EXISTS idx_vehicle ON reading(vehicle);
+
+ALTER TABLE upload_session ADD COLUMN IF NOT EXISTS vehicle TEXT NOT NULL DEFAULT 'lada';
+ALTER TABLE upload_session ALTER COLUMN vehicle DROP DEFAULT;
+
+ALTER TABLE ingest_job ADD COLUMN IF NOT EXISTS vehicle TEXT NOT NULL DEFAULT 'lada';
+ALTER TABLE ingest_job ALTER COLUMN vehicle DROP DEFAULT;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_key (
+    id         UUID        PRIMARY KEY,
+    -- Only the hash of each key is stored, so a leaked database does not
+    -- leak usable keys.
+    hash       TEXT        NOT NULL UNIQUE,
+    label      TEXT        NOT NULL,
+    vehicle    TEXT        NOT NULL,
+    device_id  TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,16 @@
+ALTER TABLE reading DROP CONSTRAINT IF EXISTS fk_reading_sensor;
+
+CREATE TYPE SENSOR_TYPE AS ENUM (
+    'speed',
+    'fuel',
+    'revolution',
+    'engine_temperature',
+    'location_latitude',
+    'location_longitude'
+);
+
+-- Readings for sensors added after the enum was removed cannot be represented.
+DELETE FROM reading WHERE NOT sensor = ANY(enum_range(NULL::SENSOR_TYPE)::TEXT[]);
+ALTER TABLE reading ALTER COLUMN sensor TYPE SENSOR_TYPE USING sensor::SENSOR_TYPE;
+
+DROP TABLE IF EXISTS sensor;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS sensor (
+    name TEXT PRIMARY KEY,
+    unit TEXT NOT NULL,
+    description TEXT NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    display_precision INT NOT NULL DEFAULT 0,
+    CHECK (min_value <= max_value),
+    CHECK (display_precision >= 0)
+);
+
+INSERT INTO sensor (name, unit, description, min_value, max_value, display_precision) VALUES
+    ('speed', 'km/h', 'Speed of the vehicle', 0, 250, 0),
+    ('fuel', '%', 'Fuel remaining in the tank', 0, 100, 0),
+    ('revolution', 'rpm', 'Engine revolutions per minute', 0, 10000, 0),
+    ('engine_temperature', '°C', 'Temperature of the engine coolant', -50, 200, 1),
+    ('location_latitude', '°', 'Latitude of the vehicle', -90, 90, 6),
+    ('location_longitude', '°', 'Longitude of the vehicle', -180, 180, 6)
+ON CONFLICT (name) DO NOTHING;
+
+-- Sensors are now stored as data, so readings reference the sensor table
+-- rather than a fixed enum.
+ALTER TABLE reading ALTER COLUMN sensor TYPE TEXT USING sensor::TEXT;
+DROP TYPE IF EXISTS SENSOR_TYPE;
+ALTER TABLE reading ADD CONSTRAINT fk_reading_sensor FOREIGN KEY (sensor) REFERENCES sensor(name);
@@ -0,0 +1,31 @@
+-- The position of each vehicle at the end of every 10 second interval, used
+-- to compute the distance travelled without reading every location reading.
+-- The time of the last latitude and longitude within each interval is kept so
+-- that intervals where they were not recorded together can be ignored.
+--
+-- Real-time aggregation is enabled so that intervals which have not yet been
+-- materialized are computed from the reading table when queried.
+CREATE MATERIALIZED VIEW IF NOT EXISTS location_bucket
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    vehicle,
+    time_bucket(INTERVAL '10 seconds', timestamp) AS bucket,
+    last(value, timestamp) FILTER (WHERE sensor = 'location_latitude') AS latitude,
+    MAX(timestamp) FILTER (WHERE sensor = 'location_latitude') AS latitude_timestamp,
+    last(value, timestamp) FILTER (WHERE sensor = 'location_longitude') AS longitude,
+    MAX(timestamp) FILTER (WHERE sensor = 'location_longitude') AS longitude_timestamp
+FROM reading
+WHERE sensor IN ('location_latitude', 'location_longitude')
+GROUP BY vehicle, bucket
+WITH NO DATA;
+
+-- Migrations run within a transaction, so the view is created without data
+-- and populated by the refresh policy. Readings can be uploaded long after
+-- they were recorded, so the policy has no start offset. Only intervals that
+-- have changed since the last refresh are materialized again.
+SELECT add_continuous_aggregate_policy('location_bucket',
+    start_offset => NULL,
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => true
+);
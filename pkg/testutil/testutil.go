@@ -29,6 +29,12 @@ func Postgres(t *testing.T, ctx context.Context) *sql.DB {
 	t.Cleanup(func() {
 		_, err = db.ExecContext(ctx, "DELETE FROM reading WHERE sensor IS NOT NULl")
 		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "DELETE FROM upload_session")
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "DELETE FROM ingest_job")
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "DELETE FROM api_key")
+		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
 
@@ -0,0 +1,222 @@
+// Package units provides utilities for converting sensor values between units of measurement.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// The Unit type is the symbol of a unit of measurement, such as "km/h" or "°C".
+	Unit string
+
+	// The System type describes a system of measurement that values can be displayed in.
+	System string
+
+	// The Preferences type describes the units a caller would like values converted to. Explicit units take
+	// precedence over the System.
+	Preferences struct {
+		System System
+		Units  []Unit
+	}
+
+	// The definition type describes how to convert a unit to & from the base unit of its dimension, along with its
+	// equivalents in each System.
+	definition struct {
+		dimension string
+		scale     float64
+		offset    float64
+		metric    Unit
+		imperial  Unit
+	}
+)
+
+// Constants for systems of measurement.
+const (
+	Metric   = System("metric")
+	Imperial = System("imperial")
+)
+
+// Constants for supported units.
+const (
+	KilometresPerHour = Unit("km/h")
+	MilesPerHour      = Unit("mph")
+	MetresPerSecond   = Unit("m/s")
+	Celsius           = Unit("°C")
+	Fahrenheit        = Unit("°F")
+	Bar               = Unit("bar")
+	Kilopascal        = Unit("kPa")
+	PoundsPerSqInch   = Unit("psi")
+	Kilometres        = Unit("km")
+	Miles             = Unit("mi")
+	Metres            = Unit("m")
+	Feet              = Unit("ft")
+	Litres            = Unit("l")
+	Gallons           = Unit("gal")
+)
+
+var (
+	// ErrUnknownUnit is the error given when attempting to use a unit that cannot be converted.
+	ErrUnknownUnit = errors.New("unknown unit")
+	// ErrIncompatibleUnits is the error given when attempting to convert between units of different dimensions.
+	ErrIncompatibleUnits = errors.New("incompatible units")
+)
+
+// Each unit is converted to the base unit of its dimension using value*scale + offset. The base units are metres per
+// second, degrees celsius, bar, metres and litres.
+var definitions = map[Unit]definition{
+	KilometresPerHour: {dimension: "speed", scale: 1 / 3.6, metric: KilometresPerHour, imperial: MilesPerHour},
+	MilesPerHour:      {dimension: "speed", scale: 0.44704, metric: KilometresPerHour, imperial: MilesPerHour},
+	MetresPerSecond:   {dimension: "speed", scale: 1, metric: MetresPerSecond, imperial: MilesPerHour},
+	Celsius:           {dimension: "temperature", scale: 1, metric: Celsius, imperial: Fahrenheit},
+	Fahrenheit:        {dimension: "temperature", scale: 5.0 / 9.0, offset: -160.0 / 9.0, metric: Celsius, imperial: Fahrenheit},
+	Bar:               {dimension: "pressure", scale: 1, metric: Bar, imperial: PoundsPerSqInch},
+	Kilopascal:        {dimension: "pressure", scale: 0.01, metric: Kilopascal, imperial: PoundsPerSqInch},
+	PoundsPerSqInch:   {dimension: "pressure", scale: 0.0689475729, metric: Bar, imperial: PoundsPerSqInch},
+	Kilometres:        {dimension: "length", scale: 1000, metric: Kilometres, imperial: Miles},
+	Miles:             {dimension: "length", scale: 1609.344, metric: Kilometres, imperial: Miles},
+	Metres:            {dimension: "length", scale: 1, metric: Metres, imperial: Feet},
+	Feet:              {dimension: "length", scale: 0.3048, metric: Metres, imperial: Feet},
+	Litres:            {dimension: "volume", scale: 1, metric: Litres, imperial: Gallons},
+	Gallons:           {dimension: "volume", scale: 3.785411784, metric: Litres, imperial: Gallons},
+}
+
+// Alternative names for units whose symbols are awkward to type or URL encode.
+var aliases = map[string]Unit{
+	"kph":        KilometresPerHour,
+	"kmh":        KilometresPerHour,
+	"c":          Celsius,
+	"celsius":    Celsius,
+	"f":          Fahrenheit,
+	"fahrenheit": Fahrenheit,
+}
+
+// Parse a Unit from its symbol or one of its aliases. Returns ErrUnknownUnit if the unit cannot be converted.
+func Parse(s string) (Unit, error) {
+	if unit, ok := aliases[strings.ToLower(s)]; ok {
+		return unit, nil
+	}
+
+	unit := Unit(s)
+	if _, ok := definitions[unit]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownUnit, s)
+	}
+
+	return unit, nil
+}
+
+// Convert a value from one Unit to another. Values are returned as-is when both units are the same, even if they are
+// unknown. Returns ErrUnknownUnit if either unit cannot be converted or ErrIncompatibleUnits if the units measure
+// different things.
+func Convert(value float64, from, to Unit) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+
+	fromDef, ok := definitions[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, from)
+	}
+
+	toDef, ok := definitions[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, to)
+	}
+
+	if fromDef.dimension != toDef.dimension {
+		return 0, fmt.Errorf("%w: %q and %q", ErrIncompatibleUnits, from, to)
+	}
+
+	base := value*fromDef.scale + fromDef.offset
+	return (base - toDef.offset) / toDef.scale, nil
+}
+
+// ConvertDifference converts a difference between two values, such as a standard deviation, from one Unit to another.
+// Unlike Convert, any offset between the units is ignored, so a difference of 10°C is converted to 18°F rather than
+// 50°F.
+func ConvertDifference(value float64, from, to Unit) (float64, error) {
+	converted, err := Convert(value, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	zero, err := Convert(0, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	return converted - zero, nil
+}
+
+// Compatible returns true if values can be converted between the two units.
+func Compatible(a, b Unit) bool {
+	if a == b {
+		return true
+	}
+
+	aDef, aOK := definitions[a]
+	bDef, bOK := definitions[b]
+	return aOK && bOK && aDef.dimension == bDef.dimension
+}
+
+// ForSystem returns the equivalent of the Unit within the System. Units that are the same in every system, such as
+// percentages, are returned as-is.
+func ForSystem(unit Unit, system System) Unit {
+	def, ok := definitions[unit]
+	if !ok {
+		return unit
+	}
+
+	switch system {
+	case Metric:
+		return def.metric
+	case Imperial:
+		return def.imperial
+	default:
+		return unit
+	}
+}
+
+// ParsePreferences parses Preferences from a list of values, typically from the query parameters of an HTTP request.
+// Each value may be the name of a System or a Unit. Only one System may be given.
+func ParsePreferences(values []string) (Preferences, error) {
+	var prefs Preferences
+	for _, value := range values {
+		switch System(value) {
+		case Metric, Imperial:
+			if prefs.System != "" && prefs.System != System(value) {
+				return prefs, fmt.Errorf("conflicting unit systems %q and %q", prefs.System, value)
+			}
+
+			prefs.System = System(value)
+			continue
+		}
+
+		unit, err := Parse(value)
+		if err != nil {
+			return prefs, err
+		}
+
+		prefs.Units = append(prefs.Units, unit)
+	}
+
+	return prefs, nil
+}
+
+// For returns the Unit a value in the canonical Unit should be converted to. The first explicit unit compatible with
+// the canonical unit is used, followed by the canonical unit's equivalent in the System. The canonical unit is
+// returned when there is no preference.
+func (p Preferences) For(canonical Unit) Unit {
+	for _, unit := range p.Units {
+		if Compatible(unit, canonical) {
+			return unit
+		}
+	}
+
+	if p.System != "" {
+		return ForSystem(canonical, p.System)
+	}
+
+	return canonical
+}
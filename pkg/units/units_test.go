@@ -0,0 +1,164 @@
+package units_test
+
+import (
+	"testing"
+
+	"github.com/cloud-lada/backend/pkg/units"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name          string
+		Value         float64
+		From          units.Unit
+		To            units.Unit
+		Expected      float64
+		ExpectedError error
+	}{
+		{
+			Name:     "It should convert kilometres per hour to miles per hour",
+			Value:    100,
+			From:     units.KilometresPerHour,
+			To:       units.MilesPerHour,
+			Expected: 62.137,
+		},
+		{
+			Name:     "It should convert celsius to fahrenheit",
+			Value:    100,
+			From:     units.Celsius,
+			To:       units.Fahrenheit,
+			Expected: 212,
+		},
+		{
+			Name:     "It should convert fahrenheit to celsius",
+			Value:    -40,
+			From:     units.Fahrenheit,
+			To:       units.Celsius,
+			Expected: -40,
+		},
+		{
+			Name:     "It should convert bar to psi",
+			Value:    1,
+			From:     units.Bar,
+			To:       units.PoundsPerSqInch,
+			Expected: 14.504,
+		},
+		{
+			Name:     "It should return the value for identical units",
+			Value:    50,
+			From:     "%",
+			To:       "%",
+			Expected: 50,
+		},
+		{
+			Name:          "It should return an error for unknown units",
+			Value:         50,
+			From:          "%",
+			To:            units.MilesPerHour,
+			ExpectedError: units.ErrUnknownUnit,
+		},
+		{
+			Name:          "It should return an error for incompatible units",
+			Value:         50,
+			From:          units.Celsius,
+			To:            units.MilesPerHour,
+			ExpectedError: units.ErrIncompatibleUnits,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := units.Convert(tc.Value, tc.From, tc.To)
+			if tc.ExpectedError != nil {
+				assert.ErrorIs(t, err, tc.ExpectedError)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.Expected, actual, 0.001)
+		})
+	}
+}
+
+func TestConvertDifference(t *testing.T) {
+	t.Parallel()
+
+	actual, err := units.ConvertDifference(10, units.Celsius, units.Fahrenheit)
+	assert.NoError(t, err)
+	assert.InDelta(t, 18, actual, 0.001)
+
+	actual, err = units.ConvertDifference(10, units.KilometresPerHour, units.MilesPerHour)
+	assert.NoError(t, err)
+	assert.InDelta(t, 6.2137, actual, 0.001)
+
+	_, err = units.ConvertDifference(10, units.Celsius, units.MilesPerHour)
+	assert.ErrorIs(t, err, units.ErrIncompatibleUnits)
+}
+
+func TestParsePreferences(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		Values       []string
+		Canonical    units.Unit
+		Expected     units.Unit
+		ExpectsError bool
+	}{
+		{
+			Name:      "It should use the canonical unit without preferences",
+			Canonical: units.KilometresPerHour,
+			Expected:  units.KilometresPerHour,
+		},
+		{
+			Name:      "It should use the equivalent unit of the system",
+			Values:    []string{"imperial"},
+			Canonical: units.Celsius,
+			Expected:  units.Fahrenheit,
+		},
+		{
+			Name:      "It should keep units that are the same in every system",
+			Values:    []string{"imperial"},
+			Canonical: "%",
+			Expected:  "%",
+		},
+		{
+			Name:      "It should prefer an explicit unit over the system",
+			Values:    []string{"imperial", "c"},
+			Canonical: units.Celsius,
+			Expected:  units.Celsius,
+		},
+		{
+			Name:      "It should ignore explicit units for other dimensions",
+			Values:    []string{"mph"},
+			Canonical: units.Celsius,
+			Expected:  units.Celsius,
+		},
+		{
+			Name:         "It should return an error for unknown units",
+			Values:       []string{"furlongs"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error for conflicting systems",
+			Values:       []string{"metric", "imperial"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			prefs, err := units.ParsePreferences(tc.Values)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.Expected, prefs.For(tc.Canonical))
+		})
+	}
+}